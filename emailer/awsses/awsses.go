@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -63,6 +64,11 @@ func (a *AWSSES) Init(ctx context.Context, opts internal.InitOpts) error {
 		a.now = time.Now
 	}
 
+	// Instrument outbound requests with OpenTelemetry unless a client was injected (e.g. by tests)
+	if a.httpClient == nil {
+		a.httpClient = internal.NewHTTPClient(opts)
+	}
+
 	// Preserve the caller's display name in the From header when one is provided
 	a.from = internal.FormatFromAddress(fromName, fromAddress)
 
@@ -71,9 +77,29 @@ func (a *AWSSES) Init(ctx context.Context, opts internal.InitOpts) error {
 
 // SendEmail posts a simple SES v2 payload and signs the request with AWS Signature Version 4
 func (a AWSSES) SendEmail(ctx context.Context, toEmail string, subject string, message internal.SendEmailMessage) error {
+	// Use the injected clock in tests while remaining safe for manually constructed instances
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+
 	err := internal.ValidateEmailAddress("recipient address", toEmail)
 	if err != nil {
-		return err
+		return internal.Permanent(err)
+	}
+
+	// SES delivers messages right away, so it can't honor a send time in the future
+	if message.IsScheduled(now()) {
+		return internal.Permanent(internal.ErrScheduledSendingNotSupported)
+	}
+
+	customHeaders, err := message.CustomHeaders()
+	if err != nil {
+		return internal.Permanent(err)
+	}
+	tags, err := messageTags(message)
+	if err != nil {
+		return internal.Permanent(err)
 	}
 
 	// Build the smallest SES v2 payload that matches the Emailer interface
@@ -96,6 +122,13 @@ func (a AWSSES) SendEmail(ctx context.Context, toEmail string, subject string, m
 			ToAddresses: []string{toEmail},
 		},
 		FromEmailAddress: a.from,
+		EmailTags:        tags,
+	}
+	for _, h := range customHeaders {
+		payloadBody.Content.Simple.Headers = append(payloadBody.Content.Simple.Headers, messageHeader{
+			Name:  h.Name,
+			Value: h.Value,
+		})
 	}
 	if message.HTML != "" {
 		payloadBody.Content.Simple.Body.HTML = &sendEmailContentValue{
@@ -119,12 +152,7 @@ func (a AWSSES) SendEmail(ctx context.Context, toEmail string, subject string, m
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Use the injected clock in tests while remaining safe for manually constructed instances
-	requestTime := time.Now()
-	if a.now != nil {
-		requestTime = a.now()
-	}
-	requestTime = requestTime.UTC()
+	requestTime := now().UTC()
 
 	// Sign the final request bytes so SES can authenticate the caller without the AWS SDK
 	err = a.signRequest(req, payload, requestTime)
@@ -151,8 +179,68 @@ func (a AWSSES) SendEmail(ctx context.Context, toEmail string, subject string, m
 	// Bubble up the SES response body because it usually contains the rejection reason
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
-		return fmt.Errorf("failed to send email (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		err = fmt.Errorf("failed to send email (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		if isPermanentError(resp) {
+			return internal.Permanent(err)
+		}
+		return err
 	}
 
 	return nil
 }
+
+// messageTags returns the SES message tags for the categories and tags of the message
+// Categories are added as tags with value "true"
+func messageTags(message internal.SendEmailMessage) ([]messageTag, error) {
+	if len(message.Categories) == 0 && len(message.Tags) == 0 {
+		return nil, nil
+	}
+
+	tags := make([]messageTag, 0, len(message.Categories)+len(message.Tags))
+	for _, c := range message.Categories {
+		if !isValidTagValue(c) {
+			return nil, fmt.Errorf("invalid category '%s': must contain only ASCII letters, numbers, underscores, or dashes, and be at most 256 characters", c)
+		}
+		tags = append(tags, messageTag{Name: c, Value: "true"})
+	}
+	for name, value := range message.Tags {
+		if !isValidTagValue(name) || !isValidTagValue(value) {
+			return nil, fmt.Errorf("invalid tag '%s': names and values must contain only ASCII letters, numbers, underscores, or dashes, and be at most 256 characters", name)
+		}
+		tags = append(tags, messageTag{Name: name, Value: value})
+	}
+
+	// Sort tags so the payload is deterministic
+	slices.SortStableFunc(tags, func(a, b messageTag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return tags, nil
+}
+
+// isValidTagValue returns true if the value is allowed as name or value of a SES message tag
+func isValidTagValue(v string) bool {
+	if v == "" || len(v) > 256 {
+		return false
+	}
+	for _, r := range v {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isPermanentError returns true if the SES error response indicates that the message itself was rejected
+// SES returns 400 also for errors that are specific to the account, such as when sending is paused, so the error type is checked when present
+func isPermanentError(resp *http.Response) bool {
+	// The header may contain additional data after a colon, e.g. "MessageRejected:http://internal.amazon.com/..."
+	errType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-ErrorType"), ":")
+	switch errType {
+	case "MessageRejected", "BadRequestException":
+		return true
+	case "":
+		return internal.IsPermanentHTTPStatus(resp.StatusCode)
+	default:
+		return false
+	}
+}
@@ -143,6 +143,79 @@ func TestSendEmail(t *testing.T) {
 	require.NoError(t, <-handlerErrCh)
 }
 
+func TestSendEmailMessageOptions(t *testing.T) {
+	bodyCh := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodyCh <- body
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"MessageId":"msg-123"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	emailer := AWSSES{
+		accessKeyID:     "access-key",
+		secretAccessKey: "secret-key",
+		region:          "us-east-1",
+		from:            "sender@example.com",
+		endpoint:        server.URL,
+		httpClient:      server.Client(),
+		now:             func() time.Time { return now },
+	}
+
+	t.Run("headers and tags", func(t *testing.T) {
+		err := emailer.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+			Text:    "Plain body",
+			Headers: map[string]string{"X-Entity-Ref-ID": "abc123"},
+			ListUnsubscribe: &internal.ListUnsubscribe{
+				URL:      "https://example.com/unsub",
+				OneClick: true,
+			},
+			Categories: []string{"welcome"},
+			Tags:       map[string]string{"campaign": "spring-2024"},
+			// Past send times are ignored
+			SendAt: now.Add(-time.Minute),
+		})
+		require.NoError(t, err)
+
+		var payload sendEmailRequest
+		err = json.Unmarshal(<-bodyCh, &payload)
+		require.NoError(t, err)
+
+		require.NotNil(t, payload.Content.Simple)
+		assert.Equal(t, []messageHeader{
+			{Name: "List-Unsubscribe", Value: "<https://example.com/unsub>"},
+			{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+			{Name: "X-Entity-Ref-Id", Value: "abc123"},
+		}, payload.Content.Simple.Headers)
+		assert.Equal(t, []messageTag{
+			{Name: "campaign", Value: "spring-2024"},
+			{Name: "welcome", Value: "true"},
+		}, payload.EmailTags)
+	})
+
+	t.Run("invalid tags are rejected", func(t *testing.T) {
+		err := emailer.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+			Text: "Plain body",
+			Tags: map[string]string{"campaign": "spring 2024"},
+		})
+		require.ErrorContains(t, err, "invalid tag 'campaign'")
+		assert.True(t, internal.IsPermanent(err))
+	})
+
+	t.Run("scheduled sending is not supported", func(t *testing.T) {
+		err := emailer.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+			Text:   "Plain body",
+			SendAt: now.Add(time.Hour),
+		})
+		require.ErrorIs(t, err, internal.ErrScheduledSendingNotSupported)
+		assert.True(t, internal.IsPermanent(err))
+	})
+
+	assert.Empty(t, bodyCh, "invalid messages must not be sent")
+}
+
 func TestSendEmailReturnsRemoteErrors(t *testing.T) {
 	// Return an SES-like rejection so the test can verify error propagation from the response body
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -166,4 +239,24 @@ func TestSendEmailReturnsRemoteErrors(t *testing.T) {
 	require.Error(t, err)
 	require.ErrorContains(t, err, "failed to send email (400):")
 	require.ErrorContains(t, err, "MessageRejected")
+	assert.True(t, internal.IsPermanent(err))
+}
+
+func TestIsPermanentError(t *testing.T) {
+	newResponse := func(statusCode int, errType string) *http.Response {
+		res := &http.Response{
+			StatusCode: statusCode,
+			Header:     make(http.Header),
+		}
+		if errType != "" {
+			res.Header.Set("X-Amzn-ErrorType", errType)
+		}
+		return res
+	}
+
+	assert.True(t, isPermanentError(newResponse(http.StatusBadRequest, "MessageRejected:http://internal.amazon.com/coral/com.amazonaws.sesv2/")))
+	assert.True(t, isPermanentError(newResponse(http.StatusBadRequest, "")))
+	assert.False(t, isPermanentError(newResponse(http.StatusBadRequest, "SendingPausedException")))
+	assert.False(t, isPermanentError(newResponse(http.StatusTooManyRequests, "")))
+	assert.False(t, isPermanentError(newResponse(http.StatusInternalServerError, "")))
 }
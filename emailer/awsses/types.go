@@ -4,6 +4,7 @@ type sendEmailRequest struct {
 	Content          sendEmailContent     `json:"Content"`
 	Destination      sendEmailDestination `json:"Destination"`
 	FromEmailAddress string               `json:"FromEmailAddress"`
+	EmailTags        []messageTag         `json:"EmailTags,omitempty"`
 }
 
 type sendEmailContent struct {
@@ -13,6 +14,7 @@ type sendEmailContent struct {
 type sendEmailMessage struct {
 	Body    sendEmailBody         `json:"Body"`
 	Subject sendEmailContentValue `json:"Subject"`
+	Headers []messageHeader       `json:"Headers,omitempty"`
 }
 
 type sendEmailBody struct {
@@ -28,3 +30,13 @@ type sendEmailContentValue struct {
 type sendEmailDestination struct {
 	ToAddresses []string `json:"ToAddresses,omitempty"`
 }
+
+type messageHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type messageTag struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
@@ -0,0 +1,255 @@
+// Package capture contains an Emailer that records every message in memory instead of delivering it.
+// It is meant to be used in tests, where the recorded messages can be inspected with assertions, and during local development, where they can be browsed with the built-in web UI.
+package capture
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+// CapturedEmail is a message recorded by CaptureEmailer
+type CapturedEmail struct {
+	// Sequential ID of the message, starting from 1
+	ID int64
+	// Recipient address
+	To string
+	// Email subject
+	Subject string
+	// Message content
+	Message internal.SendEmailMessage
+	// Time the message was captured
+	SentAt time.Time
+}
+
+// CaptureEmailer is an object that implements the Emailer interface and records all messages in memory.
+// The zero value is ready to use, and all methods are safe for concurrent use.
+// When the object created with emailer.NewEmailer is wrapped by middlewares or instrumentation, use emailer.Unwrap to obtain the *CaptureEmailer.
+// This is meant to be used for tests and development only
+type CaptureEmailer struct {
+	lock        sync.Mutex
+	messages    []CapturedEmail
+	lastID      int64
+	maxMessages int
+	sendErr     error
+
+	// Closed and replaced every time a message is captured, to wake up waiters
+	notifyCh chan struct{}
+}
+
+// Init the object with the connection string.
+// The connection string has the format "capture://?maxMessages=<n>", where maxMessages is optional and limits the number of messages retained (oldest are dropped first).
+func (c *CaptureEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	const connStringFormat = "capture://?maxMessages=<n>"
+
+	if opts.ConnString == nil {
+		return nil
+	}
+	if opts.ConnString.Scheme != "capture" {
+		return fmt.Errorf("invalid connection string scheme; required format is '%s'", connStringFormat)
+	}
+
+	maxMessages := 0
+	maxMessagesStr := opts.ConnString.Query().Get("maxMessages")
+	if maxMessagesStr != "" {
+		var err error
+		maxMessages, err = strconv.Atoi(maxMessagesStr)
+		if err != nil || maxMessages < 0 {
+			return fmt.Errorf("invalid connection string: maxMessages must be a non-negative integer; required format is '%s'", connStringFormat)
+		}
+	}
+
+	c.lock.Lock()
+	c.maxMessages = maxMessages
+	c.lock.Unlock()
+
+	return nil
+}
+
+// SendEmail records the email in memory.
+func (c *CaptureEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message internal.SendEmailMessage) error {
+	err := internal.ValidateEmailAddress("recipient address", toEmail)
+	if err != nil {
+		return internal.Permanent(err)
+	}
+	_, err = message.CustomHeaders()
+	if err != nil {
+		return internal.Permanent(err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Return the simulated error if one was set, without recording the message
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+
+	c.lastID++
+	c.messages = append(c.messages, CapturedEmail{
+		ID:      c.lastID,
+		To:      toEmail,
+		Subject: subject,
+		Message: message,
+		SentAt:  time.Now(),
+	})
+
+	// Drop the oldest messages if we're over capacity
+	if c.maxMessages > 0 && len(c.messages) > c.maxMessages {
+		c.messages = append(c.messages[:0:0], c.messages[len(c.messages)-c.maxMessages:]...)
+	}
+
+	// Wake up all goroutines waiting for messages
+	if c.notifyCh != nil {
+		close(c.notifyCh)
+		c.notifyCh = nil
+	}
+
+	return nil
+}
+
+// SetSendError makes all subsequent calls to SendEmail return err without recording the message.
+// Pass nil to restore the normal behavior.
+// This is useful to simulate failures of the email provider in tests.
+func (c *CaptureEmailer) SetSendError(err error) {
+	c.lock.Lock()
+	c.sendErr = err
+	c.lock.Unlock()
+}
+
+// Messages returns a copy of all captured messages, in the order they were sent.
+func (c *CaptureEmailer) Messages() []CapturedEmail {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	res := make([]CapturedEmail, len(c.messages))
+	copy(res, c.messages)
+	return res
+}
+
+// Count returns the number of captured messages.
+func (c *CaptureEmailer) Count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.messages)
+}
+
+// Get returns the message with the given ID.
+func (c *CaptureEmailer) Get(id int64) (CapturedEmail, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, m := range c.messages {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return CapturedEmail{}, false
+}
+
+// Last returns the most recently captured message.
+func (c *CaptureEmailer) Last() (CapturedEmail, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.messages) == 0 {
+		return CapturedEmail{}, false
+	}
+	return c.messages[len(c.messages)-1], true
+}
+
+// Find returns all captured messages for which match returns true, in the order they were sent.
+// match is invoked without holding the lock, so it can use the other methods of the emailer.
+func (c *CaptureEmailer) Find(match func(m CapturedEmail) bool) []CapturedEmail {
+	res := make([]CapturedEmail, 0)
+	for _, m := range c.Messages() {
+		if match(m) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// MessagesTo returns all captured messages sent to the given address.
+// The comparison is case-insensitive.
+func (c *CaptureEmailer) MessagesTo(toEmail string) []CapturedEmail {
+	return c.Find(func(m CapturedEmail) bool {
+		return strings.EqualFold(m.To, toEmail)
+	})
+}
+
+// WaitForMessage blocks until a message for which match returns true has been captured, and returns it.
+// Messages that were captured before the method was invoked are considered too.
+// If match is nil, any message is matched; it's invoked without holding the lock, like in Find.
+// Returns an error if ctx is canceled before a matching message is found.
+func (c *CaptureEmailer) WaitForMessage(ctx context.Context, match func(m CapturedEmail) bool) (CapturedEmail, error) {
+	if match == nil {
+		match = func(CapturedEmail) bool { return true }
+	}
+
+	for {
+		// Get the channel together with the messages, so messages captured afterwards are not missed
+		c.lock.Lock()
+		messages := make([]CapturedEmail, len(c.messages))
+		copy(messages, c.messages)
+		ch := c.waitCh()
+		c.lock.Unlock()
+
+		for _, m := range messages {
+			if match(m) {
+				return m, nil
+			}
+		}
+
+		select {
+		case <-ch:
+			// A new message was captured: check again
+		case <-ctx.Done():
+			return CapturedEmail{}, fmt.Errorf("no matching message captured: %w", ctx.Err())
+		}
+	}
+}
+
+// WaitForCount blocks until at least n messages have been captured.
+// Returns an error if ctx is canceled before that happens.
+func (c *CaptureEmailer) WaitForCount(ctx context.Context, n int) error {
+	for {
+		c.lock.Lock()
+		if len(c.messages) >= n {
+			c.lock.Unlock()
+			return nil
+		}
+		ch := c.waitCh()
+		c.lock.Unlock()
+
+		select {
+		case <-ch:
+			// A new message was captured: check again
+		case <-ctx.Done():
+			return fmt.Errorf("captured fewer than %d messages: %w", n, ctx.Err())
+		}
+	}
+}
+
+// Reset removes all captured messages.
+// IDs of messages captured afterwards continue from the last one.
+func (c *CaptureEmailer) Reset() {
+	c.lock.Lock()
+	c.messages = nil
+	c.lock.Unlock()
+}
+
+// waitCh returns the channel that is closed when the next message is captured.
+// This must be invoked while the caller holds the lock.
+func (c *CaptureEmailer) waitCh() chan struct{} {
+	if c.notifyCh == nil {
+		c.notifyCh = make(chan struct{})
+	}
+	return c.notifyCh
+}
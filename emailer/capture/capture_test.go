@@ -0,0 +1,241 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+	"github.com/italypaleale/go-kit/httpserver"
+)
+
+func TestInit(t *testing.T) {
+	t.Run("maxMessages is parsed", func(t *testing.T) {
+		connString, err := url.Parse("capture://?maxMessages=2")
+		require.NoError(t, err)
+
+		var c CaptureEmailer
+		err = c.Init(t.Context(), internal.InitOpts{ConnString: connString})
+		require.NoError(t, err)
+		assert.Equal(t, 2, c.maxMessages)
+	})
+
+	t.Run("invalid maxMessages is rejected", func(t *testing.T) {
+		connString, err := url.Parse("capture://?maxMessages=foo")
+		require.NoError(t, err)
+
+		var c CaptureEmailer
+		err = c.Init(t.Context(), internal.InitOpts{ConnString: connString})
+		require.ErrorContains(t, err, "maxMessages must be a non-negative integer")
+	})
+
+	t.Run("wrong scheme is rejected", func(t *testing.T) {
+		connString, err := url.Parse("console://")
+		require.NoError(t, err)
+
+		var c CaptureEmailer
+		err = c.Init(t.Context(), internal.InitOpts{ConnString: connString})
+		require.ErrorContains(t, err, "invalid connection string scheme")
+	})
+}
+
+func TestSendEmail(t *testing.T) {
+	t.Run("messages are recorded in order", func(t *testing.T) {
+		var c CaptureEmailer
+		require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "First", internal.SendEmailMessage{Text: "one"}))
+		require.NoError(t, c.SendEmail(t.Context(), "b@example.com", "Second", internal.SendEmailMessage{Text: "two", HTML: "<p>two</p>"}))
+
+		messages := c.Messages()
+		require.Len(t, messages, 2)
+		assert.Equal(t, int64(1), messages[0].ID)
+		assert.Equal(t, "a@example.com", messages[0].To)
+		assert.Equal(t, "First", messages[0].Subject)
+		assert.Equal(t, "one", messages[0].Message.Text)
+		assert.Equal(t, int64(2), messages[1].ID)
+		assert.Equal(t, "<p>two</p>", messages[1].Message.HTML)
+		assert.False(t, messages[1].SentAt.IsZero())
+
+		last, ok := c.Last()
+		require.True(t, ok)
+		assert.Equal(t, "Second", last.Subject)
+
+		got, ok := c.Get(1)
+		require.True(t, ok)
+		assert.Equal(t, "First", got.Subject)
+
+		assert.Len(t, c.MessagesTo("B@example.com"), 1)
+	})
+
+	t.Run("invalid recipient is rejected", func(t *testing.T) {
+		var c CaptureEmailer
+		err := c.SendEmail(t.Context(), "not an address", "Hello", internal.SendEmailMessage{Text: "Body"})
+		require.ErrorContains(t, err, "invalid recipient address")
+		assert.Equal(t, 0, c.Count())
+	})
+
+	t.Run("match callbacks can use the emailer", func(t *testing.T) {
+		var c CaptureEmailer
+		require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "First", internal.SendEmailMessage{Text: "one"}))
+		require.NoError(t, c.SendEmail(t.Context(), "b@example.com", "Second", internal.SendEmailMessage{Text: "two"}))
+
+		// The callbacks are invoked without holding the lock, so calling other methods doesn't deadlock
+		found := c.Find(func(m CapturedEmail) bool {
+			last, _ := c.Last()
+			return m.ID == last.ID
+		})
+		require.Len(t, found, 1)
+		assert.Equal(t, "Second", found[0].Subject)
+
+		m, err := c.WaitForMessage(t.Context(), func(m CapturedEmail) bool {
+			return c.Count() == 2 && m.To == "b@example.com"
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Second", m.Subject)
+	})
+
+	t.Run("maxMessages drops the oldest messages", func(t *testing.T) {
+		c := CaptureEmailer{maxMessages: 2}
+		for range 3 {
+			require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"}))
+		}
+
+		messages := c.Messages()
+		require.Len(t, messages, 2)
+		assert.Equal(t, int64(2), messages[0].ID)
+		assert.Equal(t, int64(3), messages[1].ID)
+	})
+
+	t.Run("simulated errors are returned", func(t *testing.T) {
+		var c CaptureEmailer
+		sendErr := errors.New("simulated")
+		c.SetSendError(sendErr)
+		err := c.SendEmail(t.Context(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"})
+		require.ErrorIs(t, err, sendErr)
+		assert.Equal(t, 0, c.Count())
+
+		c.SetSendError(nil)
+		require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"}))
+		assert.Equal(t, 1, c.Count())
+	})
+
+	t.Run("reset removes all messages", func(t *testing.T) {
+		var c CaptureEmailer
+		require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"}))
+		c.Reset()
+		assert.Equal(t, 0, c.Count())
+		_, ok := c.Last()
+		assert.False(t, ok)
+	})
+}
+
+func TestWait(t *testing.T) {
+	t.Run("WaitForMessage returns a message sent later", func(t *testing.T) {
+		var c CaptureEmailer
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = c.SendEmail(context.Background(), "a@example.com", "Ignored", internal.SendEmailMessage{Text: "Body"})
+			_ = c.SendEmail(context.Background(), "b@example.com", "Wanted", internal.SendEmailMessage{Text: "Body"})
+		}()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		m, err := c.WaitForMessage(ctx, func(m CapturedEmail) bool {
+			return m.To == "b@example.com"
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Wanted", m.Subject)
+	})
+
+	t.Run("WaitForMessage returns messages captured earlier", func(t *testing.T) {
+		var c CaptureEmailer
+		require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"}))
+
+		m, err := c.WaitForMessage(t.Context(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Hello", m.Subject)
+	})
+
+	t.Run("WaitForMessage stops when the context is canceled", func(t *testing.T) {
+		var c CaptureEmailer
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.WaitForMessage(ctx, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("WaitForCount", func(t *testing.T) {
+		var c CaptureEmailer
+		go func() {
+			for range 3 {
+				_ = c.SendEmail(context.Background(), "a@example.com", "Hello", internal.SendEmailMessage{Text: "Body"})
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, c.WaitForCount(ctx, 3))
+	})
+}
+
+func TestUI(t *testing.T) {
+	var c CaptureEmailer
+	require.NoError(t, c.SendEmail(t.Context(), "a@example.com", "Hello <world>", internal.SendEmailMessage{
+		Text: "Plain body",
+		HTML: "<p>HTML body</p>",
+	}))
+
+	// Mount the UI under a prefix to verify the relative links work with groups
+	mux := httpserver.NewMux()
+	c.RegisterUI(mux.Group("/_mail"))
+
+	doRequest := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("list", func(t *testing.T) {
+		rec := doRequest(http.MethodGet, "/_mail/")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `<a href="messages/1">Hello &lt;world&gt;</a>`)
+	})
+
+	t.Run("message", func(t *testing.T) {
+		rec := doRequest(http.MethodGet, "/_mail/messages/1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `src="1/html"`)
+		assert.Contains(t, rec.Body.String(), "Plain body")
+	})
+
+	t.Run("HTML body is sandboxed", func(t *testing.T) {
+		rec := doRequest(http.MethodGet, "/_mail/messages/1/html")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "sandbox", rec.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, "<p>HTML body</p>", rec.Body.String())
+	})
+
+	t.Run("text body", func(t *testing.T) {
+		rec := doRequest(http.MethodGet, "/_mail/messages/1/text")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Plain body", rec.Body.String())
+	})
+
+	t.Run("missing message", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, doRequest(http.MethodGet, "/_mail/messages/42").Code)
+		assert.Equal(t, http.StatusBadRequest, doRequest(http.MethodGet, "/_mail/messages/foo").Code)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		rec := doRequest(http.MethodPost, "/_mail/clear")
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+		assert.Equal(t, 0, c.Count())
+	})
+}
@@ -0,0 +1,171 @@
+package capture
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/italypaleale/go-kit/httpserver"
+)
+
+// UIHandler returns a http.Handler that serves a web UI listing the captured messages.
+// The handler serves the list at "/", so to mount it under a path prefix use RegisterUI with a group instead.
+func (c *CaptureEmailer) UIHandler() http.Handler {
+	mux := httpserver.NewMux()
+	c.RegisterUI(mux)
+	return mux
+}
+
+// RegisterUI registers the routes for the web UI on the given mux.
+// The UI only uses relative links, so it can be mounted on a group with a prefix, for example:
+//
+//	c.RegisterUI(mux.Group("/_mail"))
+//
+// The list of messages is then served at "/_mail/" (with the trailing slash).
+func (c *CaptureEmailer) RegisterUI(mux *httpserver.Mux) {
+	mux.HandleFunc("GET /{$}", c.handleList)
+	mux.HandleFunc("POST /clear", c.handleClear)
+	mux.HandleFunc("GET /messages/{id}", c.handleMessage)
+	mux.HandleFunc("GET /messages/{id}/html", c.handleMessageHTML)
+	mux.HandleFunc("GET /messages/{id}/text", c.handleMessageText)
+}
+
+func (c *CaptureEmailer) handleList(w http.ResponseWriter, r *http.Request) {
+	// Show the newest messages first
+	messages := c.Messages()
+	slices.Reverse(messages)
+
+	renderTemplate(w, r, uiListTemplate, messages)
+}
+
+func (c *CaptureEmailer) handleClear(w http.ResponseWriter, r *http.Request) {
+	c.Reset()
+
+	// Redirect to the list, which is in the same folder as this route
+	http.Redirect(w, r, "./", http.StatusSeeOther)
+}
+
+func (c *CaptureEmailer) handleMessage(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.getFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	renderTemplate(w, r, uiMessageTemplate, m)
+}
+
+func (c *CaptureEmailer) handleMessageHTML(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.getFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// The HTML body is arbitrary content: sandbox it so scripts cannot run in the origin of the app
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set(httpserver.HeaderContentType, "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(m.Message.HTML))
+}
+
+func (c *CaptureEmailer) handleMessageText(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.getFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set(httpserver.HeaderContentType, "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(m.Message.Text))
+}
+
+// getFromRequest returns the message whose ID is in the request path
+// If the message can't be found, it writes an error response and returns false
+func (c *CaptureEmailer) getFromRequest(w http.ResponseWriter, r *http.Request) (CapturedEmail, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return CapturedEmail{}, false
+	}
+
+	m, ok := c.Get(id)
+	if !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return CapturedEmail{}, false
+	}
+
+	return m, true
+}
+
+func renderTemplate(w http.ResponseWriter, r *http.Request, tpl *template.Template, data any) {
+	w.Header().Set(httpserver.HeaderContentType, "text/html; charset=utf-8")
+	err := tpl.Execute(w, data)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error rendering captured emails UI", slog.Any("error", err))
+	}
+}
+
+const uiStyle = `<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.4rem 0.8rem; border-bottom: 1px solid #ddd; }
+dt { font-weight: bold; }
+dd { margin: 0 0 0.6rem 0; }
+iframe { width: 100%; height: 60vh; border: 1px solid #ddd; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: 1rem; }
+</style>`
+
+var uiListTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Captured emails</title>
+` + uiStyle + `
+</head>
+<body>
+<h1>Captured emails</h1>
+<form method="post" action="clear"><button type="submit">Clear all</button></form>
+{{if .}}
+<table>
+<thead><tr><th>#</th><th>Sent at</th><th>To</th><th>Subject</th></tr></thead>
+<tbody>
+{{range .}}<tr><td>{{.ID}}</td><td>{{.SentAt.Format "2006-01-02 15:04:05"}}</td><td>{{.To}}</td><td><a href="messages/{{.ID}}">{{.Subject}}</a></td></tr>
+{{end}}
+</tbody>
+</table>
+{{else}}
+<p>No messages captured yet.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var uiMessageTemplate = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+` + uiStyle + `
+</head>
+<body>
+<p><a href="../">&larr; All messages</a></p>
+<h1>{{.Subject}}</h1>
+<dl>
+<dt>To</dt><dd>{{.To}}</dd>
+<dt>Sent at</dt><dd>{{.SentAt.Format "2006-01-02 15:04:05"}}</dd>
+{{if not .Message.SendAt.IsZero}}<dt>Send at</dt><dd>{{.Message.SendAt.Format "2006-01-02 15:04:05"}}</dd>
+{{end}}{{range $name, $value := .Message.Headers}}<dt>{{$name}}</dt><dd>{{$value}}</dd>
+{{end}}{{with .Message.ListUnsubscribe}}<dt>List-Unsubscribe</dt><dd>{{.URL}} {{.Mailto}}{{if .OneClick}} (one-click){{end}}</dd>
+{{end}}{{with .Message.Categories}}<dt>Categories</dt><dd>{{range $i, $c := .}}{{if $i}}, {{end}}{{$c}}{{end}}</dd>
+{{end}}{{range $name, $value := .Message.Tags}}<dt>Tag {{$name}}</dt><dd>{{$value}}</dd>
+{{end}}</dl>
+{{if .Message.HTML}}
+<h2>HTML</h2>
+<iframe sandbox src="{{.ID}}/html"></iframe>
+{{end}}
+<h2>Text</h2>
+<pre>{{.Message.Text}}</pre>
+</body>
+</html>
+`))
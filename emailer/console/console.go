@@ -22,11 +22,28 @@ func (s *ConsoleEmailer) Init(ctx context.Context, opts internal.InitOpts) error
 // SendEmail sends an email using SendGrid.
 func (s *ConsoleEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message internal.SendEmailMessage) error {
 	// Print the email as log
-	s.log.InfoContext(ctx, "Invoked SendEmail on ConsoleEmailer",
+	attrs := []any{
 		slog.String("to", toEmail),
 		slog.String("subject", subject),
 		slog.String("text", message.Text),
 		slog.String("html", message.HTML),
-	)
+	}
+	headers, err := message.CustomHeaders()
+	if err != nil {
+		return internal.Permanent(err)
+	}
+	if len(headers) > 0 {
+		attrs = append(attrs, slog.Any("headers", headers))
+	}
+	if len(message.Categories) > 0 {
+		attrs = append(attrs, slog.Any("categories", message.Categories))
+	}
+	if len(message.Tags) > 0 {
+		attrs = append(attrs, slog.Any("tags", message.Tags))
+	}
+	if !message.SendAt.IsZero() {
+		attrs = append(attrs, slog.Time("sendAt", message.SendAt))
+	}
+	s.log.InfoContext(ctx, "Invoked SendEmail on ConsoleEmailer", attrs...)
 	return nil
 }
@@ -7,7 +7,12 @@ import (
 	"log/slog"
 	"net/url"
 
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/italypaleale/go-kit/emailer/awsses"
+	"github.com/italypaleale/go-kit/emailer/capture"
 	"github.com/italypaleale/go-kit/emailer/console"
 	"github.com/italypaleale/go-kit/emailer/internal"
 	"github.com/italypaleale/go-kit/emailer/sendgrid"
@@ -20,6 +25,21 @@ type Emailer = internal.Emailer
 // SendEmailMessage is the content of an email
 type SendEmailMessage = internal.SendEmailMessage
 
+// ListUnsubscribe contains the options for the List-Unsubscribe header of a message
+type ListUnsubscribe = internal.ListUnsubscribe
+
+// ErrScheduledSendingNotSupported is returned (wrapped in a PermanentError) by emailers that cannot deliver messages at a later time, when SendEmailMessage.SendAt is in the future
+var ErrScheduledSendingNotSupported = internal.ErrScheduledSendingNotSupported
+
+// PermanentError is returned by emailers when a message was rejected because of its content or recipient
+// Sending the same message again, even with a different provider, is expected to fail the same way
+type PermanentError = internal.PermanentError
+
+// IsPermanentError returns true if err indicates that the message was rejected and should not be retried
+func IsPermanentError(err error) bool {
+	return internal.IsPermanent(err)
+}
+
 // NewEmailerOpts is the options struct for NewEmailer
 type NewEmailerOpts struct {
 	// Connection string
@@ -27,17 +47,59 @@ type NewEmailerOpts struct {
 	// Optional logger
 	// Uses the default slog if unset
 	Logger *slog.Logger
+	// If true, the returned Emailer does not record traces and metrics for each message sent, nor for the requests made to the providers' APIs
+	DisableInstrumentation bool
+	// Optional meter used to record metrics for sent emails, such as the one returned by observability.InitMetrics
+	// If unset, no metrics are recorded
+	Meter metric.Meter
+	// Optional tracer provider used to record spans for sent emails and for the requests made to the providers' APIs
+	// Uses the global tracer provider if unset
+	TracerProvider trace.TracerProvider
+	// Optional meter provider used to record metrics for the requests made to the providers' APIs
+	// Uses the global meter provider if unset
+	MeterProvider metric.MeterProvider
+	// Optional middlewares applied to the emailer, such as WithHTMLProcessing or WithSuppressionList
+	Middlewares []Middleware
 }
 
 // NewEmailer returns a configured Emailer object based on the connection string
+// Unless DisableInstrumentation is set, the returned Emailer is instrumented with OpenTelemetry traces and metrics, so it is not the provider-specific object
+//
+// Migrating from earlier versions, which returned the provider-specific object: code that type-asserts the result, such as e.(*sendgrid.SendGridEmailer), must call Unwrap first, as in Unwrap(e).(*sendgrid.SendGridEmailer)
+// Alternatively, set DisableInstrumentation (and don't set Middlewares) to get the provider-specific object as before
 func NewEmailer(ctx context.Context, opts NewEmailerOpts) (Emailer, error) {
+	e, provider, err := newProviderEmailer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DisableInstrumentation {
+		return Use(e, opts.Middlewares...), nil
+	}
+
+	// Wrap the emailer to add traces and metrics
+	meter := opts.Meter
+	if meter == nil {
+		meter = noop.Meter{}
+	}
+	metrics, err := newEmailerMetrics(meter)
+	if err != nil {
+		return nil, err
+	}
+
+	instrumented := newInstrumentedEmailer(e, provider, getTracer(opts.TracerProvider), metrics)
+	return Use(instrumented, opts.Middlewares...), nil
+}
+
+// newProviderEmailer returns the initialized, provider-specific Emailer for the connection string, and the name of the provider
+func newProviderEmailer(ctx context.Context, opts NewEmailerOpts) (Emailer, string, error) {
 	// Parse the connection string
 	if opts.ConnString == "" {
-		return nil, errors.New("emailer connection string is empty")
+		return nil, "", errors.New("emailer connection string is empty")
 	}
 	connString, err := url.Parse(opts.ConnString)
 	if err != nil {
-		return nil, fmt.Errorf("emailer connection string is invalid: %w", err)
+		return nil, "", fmt.Errorf("emailer connection string is invalid: %w", err)
 	}
 
 	// Set default logger
@@ -57,18 +119,24 @@ func NewEmailer(ctx context.Context, opts NewEmailerOpts) (Emailer, error) {
 	case "console":
 		opts.Logger.WarnContext(ctx, "The 'console' emailer is meant to be used for development only")
 		e = &console.ConsoleEmailer{}
+	case "capture":
+		opts.Logger.WarnContext(ctx, "The 'capture' emailer is meant to be used for tests and development only")
+		e = &capture.CaptureEmailer{}
 	default:
-		return nil, fmt.Errorf("invalid email sender type '%s'", connString.Scheme)
+		return nil, "", fmt.Errorf("invalid email sender type '%s'", connString.Scheme)
 	}
 
 	// Init the emailer
 	err = e.Init(ctx, internal.InitOpts{
-		ConnString: connString,
-		Logger:     opts.Logger,
+		ConnString:             connString,
+		Logger:                 opts.Logger,
+		TracerProvider:         opts.TracerProvider,
+		MeterProvider:          opts.MeterProvider,
+		DisableInstrumentation: opts.DisableInstrumentation,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to init email sender '%s': %w", connString.Scheme, err)
+		return nil, "", fmt.Errorf("failed to init email sender '%s': %w", connString.Scheme, err)
 	}
 
-	return e, nil
+	return e, connString.Scheme, nil
 }
@@ -16,6 +16,6 @@ func TestNewEmailerSMTP(t *testing.T) {
 	require.NoError(t, err)
 
 	// A successful construction proves the parsed connection string reached the SMTP initializer
-	_, ok := emailer.(*smtpemailer.SMTPEmailer)
+	_, ok := Unwrap(emailer).(*smtpemailer.SMTPEmailer)
 	assert.True(t, ok)
 }
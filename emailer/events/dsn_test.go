@@ -0,0 +1,197 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+const testDSN = "From: Mail Delivery Subsystem <MAILER-DAEMON@mx.example.com>\r\n" +
+	"To: sender@example.org\r\n" +
+	"Subject: Delivery Status Notification (Failure)\r\n" +
+	"Date: Mon, 01 Jan 2024 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your message could not be delivered.\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Mon, 01 Jan 2024 09:59:00 +0000\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; hard@example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n" +
+	"Last-Attempt-Date: Mon, 01 Jan 2024 09:59:30 +0000\r\n" +
+	"\r\n" +
+	"Original-Recipient: rfc822; <slow@example.com>\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.2.2\r\n" +
+	"Diagnostic-Code: smtp; 452 4.2.2 Mailbox full\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"Message-ID: <original@example.org>\r\n" +
+	"Subject: Hello\r\n" +
+	"\r\n" +
+	"--BOUNDARY--\r\n"
+
+func TestParseDSN(t *testing.T) {
+	t.Run("delivery status notification", func(t *testing.T) {
+		events, err := ParseDSN(strings.NewReader(testDSN))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+
+		assert.Equal(t, EventTypeBounce, events[0].Type)
+		assert.Equal(t, "dsn", events[0].Provider)
+		assert.Equal(t, "hard@example.com", events[0].Recipient)
+		assert.True(t, events[0].Permanent)
+		assert.Equal(t, "550 5.1.1 User unknown", events[0].Reason)
+		assert.Equal(t, "5.1.1", events[0].Status)
+		assert.Equal(t, "original@example.org", events[0].MessageID)
+		assert.True(t, events[0].Timestamp.Equal(time.Date(2024, 1, 1, 9, 59, 30, 0, time.UTC)))
+
+		assert.Equal(t, EventTypeDeferred, events[1].Type)
+		assert.Equal(t, "slow@example.com", events[1].Recipient)
+		assert.False(t, events[1].Permanent)
+		assert.Equal(t, "452 4.2.2 Mailbox full", events[1].Reason)
+		assert.True(t, events[1].Timestamp.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("not a DSN", func(t *testing.T) {
+		msg := "From: someone@example.com\r\nSubject: Hi\r\nContent-Type: text/plain\r\n\r\nHello\r\n"
+		_, err := ParseDSN(strings.NewReader(msg))
+		require.ErrorIs(t, err, ErrNotDSN)
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		_, err := ParseDSN(strings.NewReader("not a message"))
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrNotDSN)
+	})
+}
+
+func TestDSNHandler(t *testing.T) {
+	var received []Event
+	sink := func(_ context.Context, events []Event) error {
+		received = append(received, events...)
+		return nil
+	}
+	clock := clocktesting.NewFakeClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	newRequest := func(body io.Reader) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/dsn", body)
+		req.SetBasicAuth("user", "secret")
+		return req
+	}
+
+	t.Run("raw body", func(t *testing.T) {
+		received = nil
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, Secret: "secret"})
+		require.NoError(t, err)
+
+		req := newRequest(strings.NewReader(testDSN))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		require.Equal(t, http.StatusNoContent, res.Code)
+		assert.Len(t, received, 2)
+	})
+
+	t.Run("form field", func(t *testing.T) {
+		received = nil
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, Secret: "secret", FormField: "email"})
+		require.NoError(t, err)
+
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		require.NoError(t, mw.WriteField("to", "bounces@example.org"))
+		require.NoError(t, mw.WriteField("email", testDSN))
+		require.NoError(t, mw.Close())
+
+		req := newRequest(body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		require.Equal(t, http.StatusNoContent, res.Code)
+		assert.Len(t, received, 2)
+	})
+
+	t.Run("messages that are not DSNs are ignored", func(t *testing.T) {
+		received = nil
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, Secret: "secret"})
+		require.NoError(t, err)
+
+		req := newRequest(strings.NewReader("Subject: Hi\r\n\r\nHello\r\n"))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		require.Equal(t, http.StatusNoContent, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("DSNs without a date use the current time", func(t *testing.T) {
+		received = nil
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, Secret: "secret", clock: clock})
+		require.NoError(t, err)
+
+		msg := strings.Replace(testDSN, "Date: Mon, 01 Jan 2024 10:00:00 +0000\r\n", "", 1)
+		req := newRequest(strings.NewReader(msg))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		require.Equal(t, http.StatusNoContent, res.Code)
+		require.Len(t, received, 2)
+		assert.True(t, received[1].Timestamp.Equal(clock.Now()))
+	})
+
+	t.Run("missing or invalid secret", func(t *testing.T) {
+		received = nil
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, Secret: "secret"})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/dsn", strings.NewReader(testDSN))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		req = httptest.NewRequest(http.MethodPost, "/dsn", strings.NewReader(testDSN))
+		req.SetBasicAuth("user", "wrong")
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		assert.Empty(t, received)
+	})
+}
+
+func TestNewDSNHandler(t *testing.T) {
+	sink := func(context.Context, []Event) error { return nil }
+
+	t.Run("secret is required", func(t *testing.T) {
+		_, err := NewDSNHandler(DSNHandlerOpts{Sink: sink})
+		require.Error(t, err)
+	})
+
+	t.Run("skip verification", func(t *testing.T) {
+		h, err := NewDSNHandler(DSNHandlerOpts{Sink: sink, InsecureSkipVerification: true})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/dsn", strings.NewReader(testDSN))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+	})
+}
@@ -0,0 +1,117 @@
+// Package events contains HTTP handlers that receive delivery events from email providers, such as bounces, complaints, and unsubscribes.
+// Events from SendGrid's Event Webhook, from AWS SES via SNS notifications, and from generic delivery status notification (DSN) emails are normalized into a single Event type.
+// Events can be used to maintain a suppression list, so messages are not sent to addresses that bounced or complained.
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/italypaleale/go-kit/emailer"
+	"github.com/italypaleale/go-kit/httpserver"
+)
+
+// EventType is the type of a delivery event
+type EventType string
+
+const (
+	// EventTypeBounce is for messages that could not be delivered
+	// Check Event.Permanent to know if it was a hard bounce
+	EventTypeBounce EventType = "bounce"
+	// EventTypeComplaint is for messages that the recipient marked as spam
+	EventTypeComplaint EventType = "complaint"
+	// EventTypeUnsubscribe is for recipients that unsubscribed
+	EventTypeUnsubscribe EventType = "unsubscribe"
+	// EventTypeGroupUnsubscribe is for recipients that unsubscribed from a group of messages only
+	// Event.GroupID contains the ID of the group
+	EventTypeGroupUnsubscribe EventType = "group_unsubscribe"
+	// EventTypeDropped is for messages that the provider refused to send, for example because the recipient is in its own suppression list
+	EventTypeDropped EventType = "dropped"
+	// EventTypeDeferred is for messages whose delivery was delayed, and that will be retried by the provider
+	EventTypeDeferred EventType = "deferred"
+	// EventTypeDelivered is for messages that were accepted by the recipient's server
+	EventTypeDelivered EventType = "delivered"
+)
+
+// Event is a delivery event, normalized across providers
+type Event struct {
+	// Type of the event
+	Type EventType
+	// Provider that reported the event: "sendgrid", "awsses", or "dsn"
+	Provider string
+	// Address of the recipient
+	Recipient string
+	// For bounces, true if the failure is permanent (i.e. a hard bounce)
+	Permanent bool
+	// Reason reported by the provider, if any
+	// For bounces, this is usually the diagnostic message from the recipient's server
+	Reason string
+	// Enhanced SMTP status code, if any (e.g. "5.1.1")
+	Status string
+	// ID of the message the event refers to, as assigned by the provider, if available
+	MessageID string
+	// Unique ID of the event, as assigned by the provider, if available
+	EventID string
+	// For group unsubscribes, ID of the group the recipient unsubscribed from (for SendGrid, the ID of the unsubscribe group)
+	GroupID int64
+	// Time of the event
+	Timestamp time.Time
+}
+
+// EventSink is a function invoked with the events received by the handlers
+// Events received in the same request are passed in the same call
+// If the function returns an error, the handler responds with a 5xx status code, so the provider can re-deliver the events
+type EventSink func(ctx context.Context, events []Event) error
+
+// SuppressionSink returns an EventSink that adds recipients to the suppression list when they hard-bounce, complain, or unsubscribe
+// Other events, including soft bounces and group unsubscribes, are ignored
+// Recipients that unsubscribe from a group can still receive messages that don't belong to the group, so they need to be handled by the application
+func SuppressionSink(store emailer.SuppressionStore) EventSink {
+	return func(ctx context.Context, events []Event) error {
+		errs := make([]error, 0)
+		for _, e := range events {
+			var reason emailer.SuppressionReason
+			switch {
+			case e.Type == EventTypeBounce && e.Permanent:
+				reason = emailer.SuppressionReasonBounce
+			case e.Type == EventTypeComplaint:
+				reason = emailer.SuppressionReasonComplaint
+			case e.Type == EventTypeUnsubscribe:
+				reason = emailer.SuppressionReasonUnsubscribe
+			default:
+				continue
+			}
+
+			if e.Recipient == "" {
+				continue
+			}
+			err := store.Suppress(ctx, e.Recipient, reason)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+var (
+	errBodyInvalid       = httpserver.NewApiError("InvalidBody", http.StatusBadRequest, "Request body is invalid")
+	errBodyTooLarge      = httpserver.NewApiError("BodyTooLarge", http.StatusRequestEntityTooLarge, "Request body is too large")
+	errSignatureInvalid  = httpserver.NewApiError("InvalidSignature", http.StatusUnauthorized, "Signature is missing or invalid")
+	errSecretInvalid     = httpserver.NewApiError("InvalidSecret", http.StatusUnauthorized, "Secret is missing or invalid")
+	errTopicNotAllowed   = httpserver.NewApiError("TopicNotAllowed", http.StatusForbidden, "Notifications from this topic are not allowed")
+	errSubscriptionError = httpserver.NewApiError("SubscriptionError", http.StatusBadGateway, "Failed to confirm the subscription")
+	errSinkFailed        = httpserver.NewApiError("ProcessingFailed", http.StatusInternalServerError, "Failed to process the events")
+)
+
+// writeBodyError writes the response for errors returned while reading the request body
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		errBodyTooLarge.WriteResponse(w, r)
+		return
+	}
+	errBodyInvalid.Clone(httpserver.WithInnerError(err)).WriteResponse(w, r)
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/go-kit/emailer"
+)
+
+func TestSuppressionSink(t *testing.T) {
+	store := emailer.NewMemorySuppressionStore()
+	sink := SuppressionSink(store)
+
+	err := sink(t.Context(), []Event{
+		{Type: EventTypeBounce, Recipient: "hard@example.com", Permanent: true},
+		{Type: EventTypeBounce, Recipient: "soft@example.com"},
+		{Type: EventTypeComplaint, Recipient: "spam@example.com"},
+		{Type: EventTypeUnsubscribe, Recipient: "unsub@example.com"},
+		{Type: EventTypeGroupUnsubscribe, Recipient: "group@example.com", GroupID: 42},
+		{Type: EventTypeDelivered, Recipient: "ok@example.com"},
+	})
+	require.NoError(t, err)
+
+	expect := map[string]emailer.SuppressionReason{
+		"hard@example.com":  emailer.SuppressionReasonBounce,
+		"spam@example.com":  emailer.SuppressionReasonComplaint,
+		"unsub@example.com": emailer.SuppressionReasonUnsubscribe,
+	}
+	for addr, reason := range expect {
+		entry, found, err := store.GetSuppression(t.Context(), addr)
+		require.NoError(t, err)
+		require.True(t, found, addr)
+		assert.Equal(t, reason, entry.Reason)
+	}
+
+	for _, addr := range []string{"soft@example.com", "group@example.com", "ok@example.com"} {
+		_, found, err := store.GetSuppression(t.Context(), addr)
+		require.NoError(t, err)
+		assert.False(t, found, addr)
+	}
+}
@@ -0,0 +1,241 @@
+package events
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	kclock "k8s.io/utils/clock"
+
+	"github.com/italypaleale/go-kit/httpserver"
+)
+
+const (
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+
+	// SendGrid posts events in batches, which can be large
+	sendGridMaxBodySize = 8 << 20
+
+	sendGridDefaultTimestampTolerance = 5 * time.Minute
+)
+
+// SendGridHandlerOpts is the options struct for NewSendGridHandler
+type SendGridHandlerOpts struct {
+	// Function invoked with the events received (required)
+	Sink EventSink
+	// Public key used to verify the signature of the requests, as shown in the SendGrid settings for the signed Event Webhook (base64-encoded)
+	// This is required unless InsecureSkipVerification is true
+	VerificationKey string
+	// If true, allows accepting requests without verifying their signature
+	// This should only be used for development
+	InsecureSkipVerification bool
+	// Requests whose signed timestamp differs from the current time by more than this are rejected, to protect against replay attacks
+	// Defaults to 5 minutes; set to a negative value to disable the check
+	TimestampTolerance time.Duration
+	// Optional logger
+	// Uses the default slog if unset
+	Logger *slog.Logger
+
+	clock kclock.Clock
+}
+
+// SendGridHandler is a http.Handler that receives events from SendGrid's Event Webhook
+type SendGridHandler struct {
+	sink      EventSink
+	publicKey *ecdsa.PublicKey
+	tolerance time.Duration
+	log       *slog.Logger
+	clock     kclock.Clock
+}
+
+// NewSendGridHandler returns a http.Handler that receives events from SendGrid's Event Webhook.
+// Bounces, blocks, drops, spam reports, unsubscribes (including from unsubscribe groups), deferrals, and deliveries are passed to the sink; other events (such as opens and clicks) are ignored.
+func NewSendGridHandler(opts SendGridHandlerOpts) (*SendGridHandler, error) {
+	if opts.Sink == nil {
+		return nil, errors.New("option Sink is required")
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.clock == nil {
+		opts.clock = kclock.RealClock{}
+	}
+	if opts.TimestampTolerance == 0 {
+		opts.TimestampTolerance = sendGridDefaultTimestampTolerance
+	}
+
+	h := &SendGridHandler{
+		sink:      opts.Sink,
+		tolerance: opts.TimestampTolerance,
+		log:       opts.Logger,
+		clock:     opts.clock,
+	}
+
+	switch {
+	case opts.VerificationKey != "":
+		var err error
+		h.publicKey, err = parseSendGridVerificationKey(opts.VerificationKey)
+		if err != nil {
+			return nil, err
+		}
+	case !opts.InsecureSkipVerification:
+		return nil, errors.New("option VerificationKey is required unless InsecureSkipVerification is true")
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *SendGridHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, sendGridMaxBodySize))
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	if h.publicKey != nil {
+		err = h.verifySignature(r.Header.Get(sendGridSignatureHeader), r.Header.Get(sendGridTimestampHeader), body)
+		if err != nil {
+			h.log.WarnContext(r.Context(), "Rejected SendGrid event webhook request", slog.Any("error", err))
+			errSignatureInvalid.WriteResponse(w, r)
+			return
+		}
+	}
+
+	var payload []sendGridEvent
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		errBodyInvalid.Clone(httpserver.WithInnerError(err)).WriteResponse(w, r)
+		return
+	}
+
+	events := make([]Event, 0, len(payload))
+	for _, e := range payload {
+		ev, ok := e.toEvent()
+		if ok {
+			events = append(events, ev)
+		}
+	}
+
+	if len(events) > 0 {
+		err = h.sink(r.Context(), events)
+		if err != nil {
+			h.log.ErrorContext(r.Context(), "Failed to process SendGrid events", slog.Any("error", err))
+			errSinkFailed.WriteResponse(w, r)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifySignature checks the ECDSA signature computed by SendGrid over the timestamp and the raw body
+func (h *SendGridHandler) verifySignature(signature string, timestamp string, body []byte) error {
+	if signature == "" || timestamp == "" {
+		return errors.New("signature or timestamp header is missing")
+	}
+
+	if h.tolerance > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+		diff := h.clock.Since(time.Unix(ts, 0))
+		if diff > h.tolerance || diff < -h.tolerance {
+			return errors.New("timestamp is outside of the allowed tolerance")
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(timestamp))
+	hasher.Write(body)
+	if !ecdsa.VerifyASN1(h.publicKey, hasher.Sum(nil), sig) {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
+
+// parseSendGridVerificationKey parses the base64-encoded, DER-encoded ECDSA public key
+func parseSendGridVerificationKey(key string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification key encoding: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification key: %w", err)
+	}
+	pub, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid verification key: not an ECDSA public key")
+	}
+	return pub, nil
+}
+
+// sendGridEvent is an item in the payload sent by SendGrid's Event Webhook
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Timestamp   int64  `json:"timestamp"`
+	Event       string `json:"event"`
+	Type        string `json:"type"`
+	Reason      string `json:"reason"`
+	Response    string `json:"response"`
+	Status      string `json:"status"`
+	SGEventID   string `json:"sg_event_id"`
+	SGMessageID string `json:"sg_message_id"`
+	ASMGroupID  int64  `json:"asm_group_id"`
+}
+
+func (e sendGridEvent) toEvent() (Event, bool) {
+	ev := Event{
+		Provider:  "sendgrid",
+		Recipient: e.Email,
+		Reason:    e.Reason,
+		Status:    e.Status,
+		MessageID: e.SGMessageID,
+		EventID:   e.SGEventID,
+		Timestamp: time.Unix(e.Timestamp, 0),
+	}
+
+	switch e.Event {
+	case "bounce":
+		ev.Type = EventTypeBounce
+		// Blocks (type "blocked") are temporary rejections, usually caused by the sender's reputation
+		ev.Permanent = e.Type != "blocked"
+	case "dropped":
+		ev.Type = EventTypeDropped
+	case "spamreport":
+		ev.Type = EventTypeComplaint
+	case "unsubscribe":
+		ev.Type = EventTypeUnsubscribe
+	case "group_unsubscribe":
+		ev.Type = EventTypeGroupUnsubscribe
+		ev.GroupID = e.ASMGroupID
+	case "deferred":
+		ev.Type = EventTypeDeferred
+		ev.Reason = e.Response
+	case "delivered":
+		ev.Type = EventTypeDelivered
+		ev.Reason = e.Response
+	default:
+		return Event{}, false
+	}
+
+	return ev, true
+}
@@ -0,0 +1,168 @@
+package events
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+const sendGridTestPayload = `[
+	{"email":"hard@example.com","timestamp":1700000000,"event":"bounce","type":"bounce","reason":"550 5.1.1 User unknown","status":"5.1.1","sg_event_id":"ev1","sg_message_id":"msg1"},
+	{"email":"blocked@example.com","timestamp":1700000000,"event":"bounce","type":"blocked","reason":"421 Try again later","status":"4.0.0","sg_event_id":"ev2","sg_message_id":"msg2"},
+	{"email":"spam@example.com","timestamp":1700000000,"event":"spamreport","sg_event_id":"ev3","sg_message_id":"msg3"},
+	{"email":"unsub@example.com","timestamp":1700000000,"event":"group_unsubscribe","asm_group_id":42,"sg_event_id":"ev4","sg_message_id":"msg4"},
+	{"email":"slow@example.com","timestamp":1700000000,"event":"deferred","response":"451 Greylisted","sg_event_id":"ev5","sg_message_id":"msg5"},
+	{"email":"open@example.com","timestamp":1700000000,"event":"open","sg_event_id":"ev6","sg_message_id":"msg6"}
+]`
+
+func TestSendGridHandler(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	clock := clocktesting.NewFakeClock(time.Unix(1700000000, 0))
+
+	var received []Event
+	h, err := NewSendGridHandler(SendGridHandlerOpts{
+		Sink: func(_ context.Context, events []Event) error {
+			received = append(received, events...)
+			return nil
+		},
+		VerificationKey: base64.StdEncoding.EncodeToString(der),
+		clock:           clock,
+	})
+	require.NoError(t, err)
+
+	sign := func(timestamp string, body string) string {
+		digest := sha256.Sum256([]byte(timestamp + body))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	doRequest := func(signature string, timestamp string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sendgrid", strings.NewReader(body))
+		req.Header.Set(sendGridSignatureHeader, signature)
+		req.Header.Set(sendGridTimestampHeader, timestamp)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		received = nil
+		ts := strconv.FormatInt(clock.Now().Unix(), 10)
+		res := doRequest(sign(ts, sendGridTestPayload), ts, sendGridTestPayload)
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		require.Len(t, received, 5)
+		assert.Equal(t, Event{
+			Type:      EventTypeBounce,
+			Provider:  "sendgrid",
+			Recipient: "hard@example.com",
+			Permanent: true,
+			Reason:    "550 5.1.1 User unknown",
+			Status:    "5.1.1",
+			MessageID: "msg1",
+			EventID:   "ev1",
+			Timestamp: time.Unix(1700000000, 0),
+		}, received[0])
+		assert.Equal(t, EventTypeBounce, received[1].Type)
+		assert.False(t, received[1].Permanent)
+		assert.Equal(t, EventTypeComplaint, received[2].Type)
+		assert.Equal(t, EventTypeGroupUnsubscribe, received[3].Type)
+		assert.Equal(t, int64(42), received[3].GroupID)
+		assert.Equal(t, EventTypeDeferred, received[4].Type)
+		assert.Equal(t, "451 Greylisted", received[4].Reason)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		received = nil
+		ts := strconv.FormatInt(clock.Now().Unix(), 10)
+		res := doRequest(sign(ts, "[]"), ts, sendGridTestPayload)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		received = nil
+		res := doRequest("", "", sendGridTestPayload)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("timestamp outside of tolerance", func(t *testing.T) {
+		received = nil
+		ts := strconv.FormatInt(clock.Now().Add(-10*time.Minute).Unix(), 10)
+		res := doRequest(sign(ts, sendGridTestPayload), ts, sendGridTestPayload)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("timestamp check can be disabled", func(t *testing.T) {
+		received = nil
+		h, err := NewSendGridHandler(SendGridHandlerOpts{
+			Sink: func(_ context.Context, events []Event) error {
+				received = append(received, events...)
+				return nil
+			},
+			VerificationKey:    base64.StdEncoding.EncodeToString(der),
+			TimestampTolerance: -1,
+			clock:              clock,
+		})
+		require.NoError(t, err)
+
+		ts := strconv.FormatInt(clock.Now().Add(-10*time.Minute).Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/sendgrid", strings.NewReader(sendGridTestPayload))
+		req.Header.Set(sendGridSignatureHeader, sign(ts, sendGridTestPayload))
+		req.Header.Set(sendGridTimestampHeader, ts)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Len(t, received, 5)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		ts := strconv.FormatInt(clock.Now().Unix(), 10)
+		res := doRequest(sign(ts, "not json"), ts, "not json")
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+	})
+}
+
+func TestNewSendGridHandler(t *testing.T) {
+	sink := func(context.Context, []Event) error { return nil }
+
+	t.Run("verification key is required", func(t *testing.T) {
+		_, err := NewSendGridHandler(SendGridHandlerOpts{Sink: sink})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid verification key", func(t *testing.T) {
+		_, err := NewSendGridHandler(SendGridHandlerOpts{Sink: sink, VerificationKey: "bm90IGEga2V5"})
+		require.Error(t, err)
+	})
+
+	t.Run("skip verification", func(t *testing.T) {
+		h, err := NewSendGridHandler(SendGridHandlerOpts{Sink: sink, InsecureSkipVerification: true})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/sendgrid", strings.NewReader(sendGridTestPayload))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+	})
+}
@@ -0,0 +1,548 @@
+package events
+
+import (
+	"container/list"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	kclock "k8s.io/utils/clock"
+
+	"github.com/italypaleale/go-kit/httpserver"
+)
+
+const (
+	snsMaxBodySize = 1 << 20
+	snsHTTPTimeout = 20 * time.Second
+
+	// SNS uses few signing certificates at a time, so the cache can be small
+	snsMaxCachedCerts = 16
+
+	snsDefaultMaxMessageAge = time.Hour
+	// Allowed difference for messages whose timestamp is in the future
+	snsClockSkew = 5 * time.Minute
+
+	snsTypeNotification             = "Notification"
+	snsTypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	snsTypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// Signing certificates and subscription URLs must be on a SNS endpoint
+var snsHostRegexp = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSHandlerOpts is the options struct for NewSNSHandler
+type SNSHandlerOpts struct {
+	// Function invoked with the events received (required)
+	Sink EventSink
+	// List of ARNs of the SNS topics that notifications are accepted from
+	// If empty, notifications from any topic are accepted, as long as they're signed by SNS
+	TopicARNs []string
+	// If true, subscription confirmation requests are confirmed automatically
+	// Otherwise, they're logged and must be confirmed manually
+	AutoConfirmSubscriptions bool
+	// Messages whose timestamp is older than this are rejected, to protect against replay attacks
+	// This should be longer than the time SNS keeps retrying deliveries, according to the delivery policy of the subscription
+	// Defaults to 1 hour; set to a negative value to disable the check
+	MaxMessageAge time.Duration
+	// Optional logger
+	// Uses the default slog if unset
+	Logger *slog.Logger
+
+	clock kclock.Clock
+}
+
+// SNSHandler is a http.Handler that receives AWS SES notifications for bounces, complaints, and deliveries via SNS
+type SNSHandler struct {
+	sink        EventSink
+	topicARNs   []string
+	autoConfirm bool
+	maxAge      time.Duration
+	log         *slog.Logger
+	httpClient  *http.Client
+	clock       kclock.Clock
+
+	// Cache of signing certificates, by URL
+	certs *certCache
+}
+
+// NewSNSHandler returns a http.Handler that receives AWS SES notifications via SNS.
+// The signature of each SNS message is verified using the certificate published by AWS.
+// Both the notification format used by SES identities and the one used by configuration set event destinations are supported.
+func NewSNSHandler(opts SNSHandlerOpts) (*SNSHandler, error) {
+	if opts.Sink == nil {
+		return nil, errors.New("option Sink is required")
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.clock == nil {
+		opts.clock = kclock.RealClock{}
+	}
+	if opts.MaxMessageAge == 0 {
+		opts.MaxMessageAge = snsDefaultMaxMessageAge
+	}
+
+	return &SNSHandler{
+		sink:        opts.Sink,
+		topicARNs:   opts.TopicARNs,
+		autoConfirm: opts.AutoConfirmSubscriptions,
+		maxAge:      opts.MaxMessageAge,
+		log:         opts.Logger,
+		clock:       opts.clock,
+		httpClient: &http.Client{
+			Timeout: snsHTTPTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				// Do not follow redirects, which could point to hosts that are not SNS endpoints
+				return http.ErrUseLastResponse
+			},
+		},
+		certs: newCertCache(snsMaxCachedCerts),
+	}, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *SNSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, snsMaxBodySize))
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	var msg snsMessage
+	err = json.Unmarshal(body, &msg)
+	if err != nil {
+		errBodyInvalid.Clone(httpserver.WithInnerError(err)).WriteResponse(w, r)
+		return
+	}
+
+	err = h.verifySignature(r.Context(), &msg)
+	if err != nil {
+		h.log.WarnContext(r.Context(), "Rejected SNS message", slog.Any("error", err))
+		errSignatureInvalid.WriteResponse(w, r)
+		return
+	}
+
+	if len(h.topicARNs) > 0 && !slices.Contains(h.topicARNs, msg.TopicArn) {
+		h.log.WarnContext(r.Context(), "Rejected SNS message from topic that is not allowed", slog.String("topic", msg.TopicArn))
+		errTopicNotAllowed.WriteResponse(w, r)
+		return
+	}
+
+	switch msg.Type {
+	case snsTypeSubscriptionConfirmation:
+		if !h.autoConfirm {
+			h.log.InfoContext(r.Context(), "Received SNS subscription confirmation request; confirm it by visiting the URL",
+				slog.String("topic", msg.TopicArn),
+				slog.String("url", msg.SubscribeURL),
+			)
+			break
+		}
+		err = h.confirmSubscription(r.Context(), msg.SubscribeURL)
+		if err != nil {
+			h.log.ErrorContext(r.Context(), "Failed to confirm SNS subscription", slog.String("topic", msg.TopicArn), slog.Any("error", err))
+			errSubscriptionError.WriteResponse(w, r)
+			return
+		}
+		h.log.InfoContext(r.Context(), "Confirmed SNS subscription", slog.String("topic", msg.TopicArn))
+
+	case snsTypeNotification:
+		var events []Event
+		events, err = parseSESNotification([]byte(msg.Message))
+		if err != nil {
+			errBodyInvalid.Clone(httpserver.WithInnerError(err)).WriteResponse(w, r)
+			return
+		}
+		if len(events) > 0 {
+			err = h.sink(r.Context(), events)
+			if err != nil {
+				h.log.ErrorContext(r.Context(), "Failed to process SES events", slog.Any("error", err))
+				errSinkFailed.WriteResponse(w, r)
+				return
+			}
+		}
+
+	case snsTypeUnsubscribeConfirmation:
+		h.log.WarnContext(r.Context(), "SNS subscription was removed", slog.String("topic", msg.TopicArn))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifySignature verifies the timestamp and the signature of the SNS message
+// See: https://docs.aws.amazon.com/sns/latest/dg/sns-verify-signature-of-message.html
+func (h *SNSHandler) verifySignature(ctx context.Context, msg *snsMessage) error {
+	var (
+		hash    crypto.Hash
+		content []byte
+	)
+
+	// Check the timestamp first, so old messages don't cause the certificate to be fetched
+	err := h.verifyTimestamp(msg.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	stringToSign, err := msg.stringToSign()
+	if err != nil {
+		return err
+	}
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+		sum := sha1.Sum([]byte(stringToSign)) //nolint:gosec
+		content = sum[:]
+	case "2":
+		hash = crypto.SHA256
+		sum := sha256.Sum256([]byte(stringToSign))
+		content = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature version '%s'", msg.SignatureVersion)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	cert, err := h.getCertificate(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate does not contain a RSA public key")
+	}
+
+	err = rsa.VerifyPKCS1v15(pub, hash, content, sig)
+	if err != nil {
+		return fmt.Errorf("signature does not match: %w", err)
+	}
+	return nil
+}
+
+// verifyTimestamp returns an error if the timestamp of the message is too old or in the future
+func (h *SNSHandler) verifyTimestamp(timestamp string) error {
+	if h.maxAge < 0 {
+		return nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	age := h.clock.Since(ts)
+	if age > h.maxAge || age < -snsClockSkew {
+		return errors.New("timestamp is outside of the allowed range")
+	}
+	return nil
+}
+
+// getCertificate returns the signing certificate from the URL, using a cached copy if possible
+func (h *SNSHandler) getCertificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	err := validateSNSURL(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate URL: %w", err)
+	}
+
+	cert, ok := h.certs.get(certURL)
+	if ok {
+		return cert, nil
+	}
+
+	body, err := h.httpGet(ctx, certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM-encoded")
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+
+	h.certs.add(certURL, cert)
+
+	return cert, nil
+}
+
+// certCache is a LRU cache of signing certificates, by URL, with a maximum size
+type certCache struct {
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	lock  sync.Mutex
+}
+
+type certCacheEntry struct {
+	url  string
+	cert *x509.Certificate
+}
+
+func newCertCache(size int) *certCache {
+	return &certCache{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (c *certCache) get(url string) (*x509.Certificate, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, ok := c.items[url]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*certCacheEntry).cert, true
+}
+
+func (c *certCache) add(url string, cert *x509.Certificate) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, ok := c.items[url]
+	if ok {
+		el.Value.(*certCacheEntry).cert = cert
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[url] = c.order.PushFront(&certCacheEntry{url: url, cert: cert})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*certCacheEntry).url)
+	}
+}
+
+// confirmSubscription confirms a SNS subscription by visiting the URL included in the request
+func (h *SNSHandler) confirmSubscription(ctx context.Context, subscribeURL string) error {
+	err := validateSNSURL(subscribeURL)
+	if err != nil {
+		return fmt.Errorf("invalid subscribe URL: %w", err)
+	}
+
+	_, err = h.httpGet(ctx, subscribeURL)
+	return err
+}
+
+func (h *SNSHandler) httpGet(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 64<<10))
+}
+
+// validateSNSURL returns an error if the URL is not a HTTPS URL on a SNS endpoint
+func validateSNSURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" {
+		return errors.New("URL must use HTTPS")
+	}
+	if !snsHostRegexp.MatchString(parsed.Host) {
+		return fmt.Errorf("host '%s' is not a SNS endpoint", parsed.Host)
+	}
+	return nil
+}
+
+// snsMessage is the body of a request sent by SNS to HTTP/HTTPS endpoints
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// stringToSign returns the canonical string that SNS signs, which depends on the message type
+func (m *snsMessage) stringToSign() (string, error) {
+	var fields [][2]string
+	switch m.Type {
+	case snsTypeNotification:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+			{"Subject", m.Subject},
+			{"Timestamp", m.Timestamp},
+			{"TopicArn", m.TopicArn},
+			{"Type", m.Type},
+		}
+	case snsTypeSubscriptionConfirmation, snsTypeUnsubscribeConfirmation:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+			{"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp},
+			{"Token", m.Token},
+			{"TopicArn", m.TopicArn},
+			{"Type", m.Type},
+		}
+	default:
+		return "", fmt.Errorf("unsupported message type '%s'", m.Type)
+	}
+
+	var b strings.Builder
+	for _, f := range fields {
+		// The subject is included only when present
+		if f[0] == "Subject" && f[1] == "" {
+			continue
+		}
+		b.WriteString(f[0])
+		b.WriteByte('\n')
+		b.WriteString(f[1])
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// sesNotification is the content of SES notifications
+// Notifications configured on identities use "notificationType", while configuration set event destinations use "eventType"
+type sesNotification struct {
+	NotificationType string        `json:"notificationType"`
+	EventType        string        `json:"eventType"`
+	Mail             sesMail       `json:"mail"`
+	Bounce           *sesBounce    `json:"bounce"`
+	Complaint        *sesComplaint `json:"complaint"`
+	Delivery         *sesDelivery  `json:"delivery"`
+}
+
+type sesMail struct {
+	MessageID string `json:"messageId"`
+}
+
+type sesBounce struct {
+	BounceType        string         `json:"bounceType"`
+	BounceSubType     string         `json:"bounceSubType"`
+	BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+	Timestamp         time.Time      `json:"timestamp"`
+	FeedbackID        string         `json:"feedbackId"`
+}
+
+type sesComplaint struct {
+	ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+	ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+	Timestamp             time.Time      `json:"timestamp"`
+	FeedbackID            string         `json:"feedbackId"`
+}
+
+type sesDelivery struct {
+	Recipients   []string  `json:"recipients"`
+	SMTPResponse string    `json:"smtpResponse"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type sesRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+// parseSESNotification parses the message included in a SNS notification sent by SES
+// Notification types other than bounces, complaints, and deliveries are ignored
+func parseSESNotification(message []byte) ([]Event, error) {
+	var n sesNotification
+	err := json.Unmarshal(message, &n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SES notification: %w", err)
+	}
+
+	typ := n.NotificationType
+	if typ == "" {
+		typ = n.EventType
+	}
+
+	var events []Event
+	switch {
+	case typ == "Bounce" && n.Bounce != nil:
+		events = make([]Event, len(n.Bounce.BouncedRecipients))
+		for i, r := range n.Bounce.BouncedRecipients {
+			reason := r.DiagnosticCode
+			if reason == "" {
+				reason = n.Bounce.BounceSubType
+			}
+			events[i] = Event{
+				Type:      EventTypeBounce,
+				Recipient: r.EmailAddress,
+				Permanent: n.Bounce.BounceType == "Permanent",
+				Reason:    reason,
+				Status:    r.Status,
+				EventID:   n.Bounce.FeedbackID,
+				Timestamp: n.Bounce.Timestamp,
+			}
+		}
+	case typ == "Complaint" && n.Complaint != nil:
+		events = make([]Event, len(n.Complaint.ComplainedRecipients))
+		for i, r := range n.Complaint.ComplainedRecipients {
+			events[i] = Event{
+				Type:      EventTypeComplaint,
+				Recipient: r.EmailAddress,
+				Reason:    n.Complaint.ComplaintFeedbackType,
+				EventID:   n.Complaint.FeedbackID,
+				Timestamp: n.Complaint.Timestamp,
+			}
+		}
+	case typ == "Delivery" && n.Delivery != nil:
+		events = make([]Event, len(n.Delivery.Recipients))
+		for i, r := range n.Delivery.Recipients {
+			events[i] = Event{
+				Type:      EventTypeDelivered,
+				Recipient: r,
+				Reason:    n.Delivery.SMTPResponse,
+				Timestamp: n.Delivery.Timestamp,
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	for i := range events {
+		events[i].Provider = "awsses"
+		events[i].MessageID = n.Mail.MessageID
+	}
+	return events, nil
+}
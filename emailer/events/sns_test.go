@@ -0,0 +1,276 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/italypaleale/go-kit/testutils"
+)
+
+const (
+	snsTestCertURL  = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+	snsTestTopicARN = "arn:aws:sns:us-east-1:123456789012:ses-events"
+)
+
+func TestSNSHandler(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	clock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC))
+
+	var received []Event
+	newHandler := func(t *testing.T, opts SNSHandlerOpts) *SNSHandler {
+		t.Helper()
+		received = nil
+		opts.clock = clock
+		opts.Sink = func(_ context.Context, events []Event) error {
+			received = append(received, events...)
+			return nil
+		}
+		h, err := NewSNSHandler(opts)
+		require.NoError(t, err)
+		h.certs.add(snsTestCertURL, cert)
+		return h
+	}
+
+	sign := func(t *testing.T, msg *snsMessage) {
+		t.Helper()
+		msg.SignatureVersion = "2"
+		msg.SigningCertURL = snsTestCertURL
+		stringToSign, err := msg.stringToSign()
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(stringToSign))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	}
+
+	doRequest := func(t *testing.T, h *SNSHandler, msg snsMessage) *httptest.ResponseRecorder {
+		t.Helper()
+		body, err := json.Marshal(msg)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/sns", bytes.NewReader(body))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	notification := func(t *testing.T, message string) snsMessage {
+		t.Helper()
+		msg := snsMessage{
+			Type:      snsTypeNotification,
+			MessageID: "b2a5c1d0-0000-0000-0000-000000000000",
+			TopicArn:  snsTestTopicARN,
+			Message:   message,
+			Timestamp: "2024-01-01T00:00:00.000Z",
+		}
+		sign(t, &msg)
+		return msg
+	}
+
+	t.Run("bounce notification", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{TopicARNs: []string{snsTestTopicARN}})
+		res := doRequest(t, h, notification(t, `{
+			"notificationType": "Bounce",
+			"mail": {"messageId": "ses-msg-1"},
+			"bounce": {
+				"bounceType": "Permanent",
+				"bounceSubType": "General",
+				"timestamp": "2024-01-01T00:00:00Z",
+				"feedbackId": "feedback-1",
+				"bouncedRecipients": [
+					{"emailAddress": "hard@example.com", "status": "5.1.1", "diagnosticCode": "smtp; 550 5.1.1 user unknown"}
+				]
+			}
+		}`))
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		require.Len(t, received, 1)
+		assert.Equal(t, Event{
+			Type:      EventTypeBounce,
+			Provider:  "awsses",
+			Recipient: "hard@example.com",
+			Permanent: true,
+			Reason:    "smtp; 550 5.1.1 user unknown",
+			Status:    "5.1.1",
+			MessageID: "ses-msg-1",
+			EventID:   "feedback-1",
+			Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, received[0])
+	})
+
+	t.Run("complaint from configuration set event", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		res := doRequest(t, h, notification(t, `{
+			"eventType": "Complaint",
+			"mail": {"messageId": "ses-msg-2"},
+			"complaint": {
+				"complaintFeedbackType": "abuse",
+				"timestamp": "2024-01-01T00:00:00Z",
+				"complainedRecipients": [{"emailAddress": "spam@example.com"}]
+			}
+		}`))
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		require.Len(t, received, 1)
+		assert.Equal(t, EventTypeComplaint, received[0].Type)
+		assert.Equal(t, "spam@example.com", received[0].Recipient)
+		assert.Equal(t, "abuse", received[0].Reason)
+	})
+
+	t.Run("other notification types are ignored", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		res := doRequest(t, h, notification(t, `{"eventType": "Open", "mail": {"messageId": "ses-msg-3"}}`))
+		require.Equal(t, http.StatusNoContent, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		msg := notification(t, `{"notificationType": "Complaint"}`)
+		msg.Message = `{"notificationType": "Bounce"}`
+		res := doRequest(t, h, msg)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, received)
+	})
+
+	t.Run("old messages are rejected", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		rtt := &testutils.RoundTripperTest{}
+		reqCh := make(chan *http.Request, 1)
+		rtt.SetReqCh(reqCh)
+		h.httpClient.Transport = rtt
+
+		msg := notification(t, `{"notificationType": "Complaint"}`)
+		msg.Timestamp = "2023-12-31T22:00:00.000Z"
+		msg.SigningCertURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-other.pem"
+		res := doRequest(t, h, msg)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, received)
+
+		// The certificate is not fetched
+		assert.Empty(t, reqCh)
+	})
+
+	t.Run("messages with a timestamp in the future are rejected", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		msg := notification(t, `{"notificationType": "Complaint"}`)
+		msg.Timestamp = "2024-01-01T01:00:00.000Z"
+		res := doRequest(t, h, msg)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("signing certificate must be on a SNS endpoint", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		msg := notification(t, `{"notificationType": "Complaint"}`)
+		msg.SigningCertURL = "https://sns.us-east-1.amazonaws.com.evil.example/cert.pem"
+		res := doRequest(t, h, msg)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("topic not allowed", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{TopicARNs: []string{"arn:aws:sns:us-east-1:123456789012:other"}})
+		res := doRequest(t, h, notification(t, `{"notificationType": "Complaint"}`))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		assert.Empty(t, received)
+	})
+
+	subscriptionConfirmation := func(t *testing.T) snsMessage {
+		t.Helper()
+		msg := snsMessage{
+			Type:         snsTypeSubscriptionConfirmation,
+			MessageID:    "c3b6d2e1-0000-0000-0000-000000000000",
+			Token:        "token",
+			TopicArn:     snsTestTopicARN,
+			Message:      "You have chosen to subscribe to the topic",
+			SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=token",
+			Timestamp:    "2024-01-01T00:00:00.000Z",
+		}
+		sign(t, &msg)
+		return msg
+	}
+
+	t.Run("auto-confirm subscriptions", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{AutoConfirmSubscriptions: true})
+		rtt := &testutils.RoundTripperTest{}
+		reqCh := make(chan *http.Request, 1)
+		rtt.SetReqCh(reqCh)
+		h.httpClient.Transport = rtt
+
+		res := doRequest(t, h, subscriptionConfirmation(t))
+		require.Equal(t, http.StatusNoContent, res.Code)
+
+		select {
+		case r := <-reqCh:
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, "sns.us-east-1.amazonaws.com", r.URL.Host)
+			assert.Equal(t, "ConfirmSubscription", r.URL.Query().Get("Action"))
+		default:
+			t.Fatal("subscription was not confirmed")
+		}
+	})
+
+	t.Run("subscriptions are not confirmed by default", func(t *testing.T) {
+		h := newHandler(t, SNSHandlerOpts{})
+		rtt := &testutils.RoundTripperTest{}
+		reqCh := make(chan *http.Request, 1)
+		rtt.SetReqCh(reqCh)
+		h.httpClient.Transport = rtt
+
+		res := doRequest(t, h, subscriptionConfirmation(t))
+		require.Equal(t, http.StatusNoContent, res.Code)
+		assert.Empty(t, reqCh)
+	})
+}
+
+func TestCertCache(t *testing.T) {
+	certs := make([]*x509.Certificate, 3)
+	for i := range certs {
+		certs[i] = &x509.Certificate{SerialNumber: big.NewInt(int64(i))}
+	}
+
+	c := newCertCache(2)
+	c.add("a", certs[0])
+	c.add("b", certs[1])
+
+	// Reading "a" makes "b" the least recently used
+	cert, ok := c.get("a")
+	require.True(t, ok)
+	assert.Same(t, certs[0], cert)
+
+	c.add("c", certs[2])
+	assert.Equal(t, 2, c.order.Len())
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+}
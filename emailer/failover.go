@@ -0,0 +1,334 @@
+package emailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	kclock "k8s.io/utils/clock"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+// FailoverStrategy is the strategy used by the failover emailer to pick the order in which providers are tried
+type FailoverStrategy string
+
+const (
+	// FailoverStrategyPriority tries providers in the order they're listed
+	FailoverStrategyPriority FailoverStrategy = "priority"
+	// FailoverStrategyWeighted picks providers randomly, proportionally to their weight, to spread the load
+	// If the first provider picked fails, the others are tried in a weighted random order too
+	FailoverStrategyWeighted FailoverStrategy = "weighted"
+)
+
+const (
+	defaultFailoverFailureThreshold = 3
+	defaultFailoverCooldown         = 30 * time.Second
+)
+
+// FailoverProvider contains the options for a provider used by the failover emailer
+type FailoverProvider struct {
+	// Connection string for the provider, in the same format as NewEmailerOpts.ConnString
+	ConnString string
+	// Weight of the provider, used with the weighted strategy only
+	// Providers with a weight of 0 are only used when all other providers failed
+	// Defaults to 1 when all providers have a weight of 0
+	Weight int
+}
+
+// NewFailoverEmailerOpts is the options struct for NewFailoverEmailer
+type NewFailoverEmailerOpts struct {
+	// List of providers
+	// At least one is required
+	Providers []FailoverProvider
+	// Strategy used to pick the providers
+	// Defaults to FailoverStrategyPriority
+	Strategy FailoverStrategy
+	// Number of consecutive failures after which a provider is considered unhealthy and skipped until CooldownPeriod has passed
+	// Defaults to 3
+	FailureThreshold int
+	// Time an unhealthy provider is skipped for
+	// After this period, the provider is tried again, and a single additional failure makes it unhealthy again
+	// Defaults to 30s
+	CooldownPeriod time.Duration
+	// Optional middlewares applied to each provider, such as WithRateLimit to limit the rate of each provider independently
+	Middlewares []Middleware
+	// Optional logger
+	// Uses the default slog if unset
+	Logger *slog.Logger
+	// If true, the providers do not record traces and metrics for each message sent, nor for the requests made to their APIs
+	DisableInstrumentation bool
+	// Optional meter used to record metrics for sent emails
+	// In addition to the metrics recorded by NewEmailer, the failover emailer records "emailer.retried", which counts the messages sent again with another provider
+	// If unset, no metrics are recorded
+	Meter metric.Meter
+	// Optional tracer provider
+	// Uses the global tracer provider if unset
+	TracerProvider trace.TracerProvider
+	// Optional meter provider used to record metrics for the requests made to the providers' APIs
+	// Uses the global meter provider if unset
+	MeterProvider metric.MeterProvider
+
+	clock kclock.Clock
+}
+
+// failoverEmailer is an Emailer that sends messages using one of multiple providers, failing over to the next one on transient errors
+type failoverEmailer struct {
+	providers        []*failoverProviderState
+	strategy         FailoverStrategy
+	failureThreshold int
+	cooldown         time.Duration
+	log              *slog.Logger
+	clock            kclock.Clock
+	lock             sync.Mutex
+	retried          metric.Int64Counter
+}
+
+type failoverProviderState struct {
+	// Emailer for the provider, which is instrumented unless instrumentation is disabled
+	emailer  Emailer
+	provider string
+	// Emailer used to send messages, which includes the middlewares
+	sender Emailer
+	weight int
+
+	// Health of the provider
+	// These are protected by the lock in failoverEmailer
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+}
+
+// NewFailoverEmailer returns an Emailer that sends messages using multiple providers.
+// When a provider returns a transient error, the message is sent with the next one; permanent errors (see IsPermanentError) are returned right away.
+// Providers that fail repeatedly are skipped for a cool-down period, unless all providers are unhealthy.
+func NewFailoverEmailer(ctx context.Context, opts NewFailoverEmailerOpts) (Emailer, error) {
+	opts.clock = kclock.RealClock{}
+	return newFailoverEmailerInternal(ctx, opts)
+}
+
+func newFailoverEmailerInternal(ctx context.Context, opts NewFailoverEmailerOpts) (*failoverEmailer, error) {
+	// Validate options
+	if len(opts.Providers) == 0 {
+		return nil, errors.New("at least one provider is required")
+	}
+	switch opts.Strategy {
+	case FailoverStrategyPriority, FailoverStrategyWeighted:
+		// All good
+	case "":
+		opts.Strategy = FailoverStrategyPriority
+	default:
+		return nil, fmt.Errorf("invalid failover strategy: %q", opts.Strategy)
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailoverFailureThreshold
+	}
+	if opts.CooldownPeriod <= 0 {
+		opts.CooldownPeriod = defaultFailoverCooldown
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Meter == nil || opts.DisableInstrumentation {
+		opts.Meter = noop.Meter{}
+	}
+
+	// Create all emailers
+	// The instruments are shared by all providers
+	metrics, err := newEmailerMetrics(opts.Meter)
+	if err != nil {
+		return nil, err
+	}
+	retried, err := opts.Meter.Int64Counter(
+		"emailer.retried",
+		metric.WithDescription("Number of times sending an email was retried with another provider"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emailer.retried counter: %w", err)
+	}
+	tracer := getTracer(opts.TracerProvider)
+	providers := make([]*failoverProviderState, len(opts.Providers))
+	allZeroWeights := true
+	for i, p := range opts.Providers {
+		if p.Weight < 0 {
+			return nil, fmt.Errorf("provider %d has a negative weight", i)
+		}
+		if p.Weight > 0 {
+			allZeroWeights = false
+		}
+
+		e, provider, err := newProviderEmailer(ctx, NewEmailerOpts{
+			ConnString:             p.ConnString,
+			Logger:                 opts.Logger,
+			TracerProvider:         opts.TracerProvider,
+			MeterProvider:          opts.MeterProvider,
+			DisableInstrumentation: opts.DisableInstrumentation,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create emailer for provider %d: %w", i, err)
+		}
+
+		if !opts.DisableInstrumentation {
+			e = newInstrumentedEmailer(e, provider, tracer, metrics)
+		}
+		providers[i] = &failoverProviderState{
+			emailer:  e,
+			provider: provider,
+			sender:   Use(e, opts.Middlewares...),
+			weight:   p.Weight,
+		}
+	}
+
+	if allZeroWeights {
+		for _, p := range providers {
+			p.weight = 1
+		}
+	}
+
+	return &failoverEmailer{
+		providers:        providers,
+		strategy:         opts.Strategy,
+		failureThreshold: opts.FailureThreshold,
+		cooldown:         opts.CooldownPeriod,
+		log:              opts.Logger,
+		clock:            opts.clock,
+		retried:          retried,
+	}, nil
+}
+
+// Init is not supported, as the providers are initialized by NewFailoverEmailer.
+func (f *failoverEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	return errors.New("failover emailer is initialized by NewFailoverEmailer")
+}
+
+// SendEmail sends the email with the first healthy provider, failing over to the next ones on transient errors.
+func (f *failoverEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message SendEmailMessage) error {
+	ctx = withSendState(ctx)
+	errs := make([]error, 0, len(f.providers))
+	for i, p := range f.pickOrder() {
+		if i > 0 {
+			f.recordRetry(ctx, p)
+		}
+
+		err := p.sender.SendEmail(ctx, toEmail, subject, message)
+		if err == nil {
+			f.recordSuccess(p)
+			return nil
+		}
+
+		// Do not fail over if the caller gave up or if the message itself was rejected
+		if ctx.Err() != nil || IsPermanentError(err) {
+			return err
+		}
+
+		// Throttling by a rate limiter does not indicate that the provider is unhealthy
+		// Domain limits are shared by all providers, so there's no point in failing over
+		var throttledErr *ThrottledError
+		if errors.As(err, &throttledErr) {
+			if throttledErr.Scope == ThrottleScopeDomain {
+				return err
+			}
+		} else {
+			f.recordFailure(ctx, p)
+		}
+		errs = append(errs, fmt.Errorf("provider '%s': %w", p.provider, err))
+		f.log.WarnContext(ctx, "Failed to send email with provider; trying the next one",
+			slog.String("provider", p.provider),
+			slog.Any("error", err),
+		)
+	}
+
+	return fmt.Errorf("failed to send email with all providers: %w", errors.Join(errs...))
+}
+
+// pickOrder returns the providers in the order they should be tried
+// Unhealthy providers are left out while they are cooling down, unless all providers are unhealthy, in which case they are all tried
+func (f *failoverEmailer) pickOrder() []*failoverProviderState {
+	var ordered []*failoverProviderState
+	switch f.strategy {
+	case FailoverStrategyWeighted:
+		ordered = weightedShuffle(f.providers)
+	default:
+		ordered = slices.Clone(f.providers)
+	}
+
+	now := f.clock.Now()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	healthy := slices.DeleteFunc(slices.Clone(ordered), func(p *failoverProviderState) bool {
+		return p.unhealthyUntil.After(now)
+	})
+	if len(healthy) == 0 {
+		return ordered
+	}
+	return healthy
+}
+
+// recordRetry increments the counter of retried messages for the provider that a message is failed over to.
+func (f *failoverEmailer) recordRetry(ctx context.Context, p *failoverProviderState) {
+	f.retried.Add(ctx, 1, metric.WithAttributes(attrProvider.String(p.provider)))
+}
+
+func (f *failoverEmailer) recordSuccess(p *failoverProviderState) {
+	f.lock.Lock()
+	p.consecutiveFailures = 0
+	p.unhealthyUntil = time.Time{}
+	f.lock.Unlock()
+}
+
+func (f *failoverEmailer) recordFailure(ctx context.Context, p *failoverProviderState) {
+	f.lock.Lock()
+	p.consecutiveFailures++
+	tripped := p.consecutiveFailures >= f.failureThreshold
+	if tripped {
+		p.unhealthyUntil = f.clock.Now().Add(f.cooldown)
+	}
+	f.lock.Unlock()
+
+	if tripped {
+		f.log.WarnContext(ctx, "Email provider is unhealthy and will be skipped",
+			slog.String("provider", p.provider),
+			slog.Duration("cooldown", f.cooldown),
+		)
+	}
+}
+
+// weightedShuffle returns the providers in a random order, where each provider is picked with a probability proportional to its weight
+// Providers with a weight of 0 are placed last
+func weightedShuffle(providers []*failoverProviderState) []*failoverProviderState {
+	remaining := slices.Clone(providers)
+	res := make([]*failoverProviderState, 0, len(providers))
+
+	total := 0
+	for _, p := range remaining {
+		total += p.weight
+	}
+
+	for total > 0 {
+		n := rand.IntN(total) //nolint:gosec
+		for i, p := range remaining {
+			if p.weight == 0 {
+				continue
+			}
+			n -= p.weight
+			if n < 0 {
+				res = append(res, p)
+				total -= p.weight
+				remaining = slices.Delete(remaining, i, i+1)
+				break
+			}
+		}
+	}
+
+	// Append the providers with no weight, which are the only ones left
+	return append(res, remaining...)
+}
@@ -0,0 +1,221 @@
+package emailer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/italypaleale/go-kit/emailer/capture"
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+func newTestFailoverEmailer(t *testing.T, opts NewFailoverEmailerOpts) (*failoverEmailer, []*capture.CaptureEmailer, *clocktesting.FakeClock) {
+	t.Helper()
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	opts.clock = clock
+	f, err := newFailoverEmailerInternal(t.Context(), opts)
+	require.NoError(t, err)
+
+	captured := make([]*capture.CaptureEmailer, len(f.providers))
+	for i, p := range f.providers {
+		var ok bool
+		captured[i], ok = Unwrap(p.emailer).(*capture.CaptureEmailer)
+		require.True(t, ok)
+	}
+
+	return f, captured, clock
+}
+
+func sendTestEmail(t *testing.T, e Emailer) error {
+	t.Helper()
+	return e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{Text: "Body"})
+}
+
+func TestFailoverEmailer(t *testing.T) {
+	t.Run("uses the first provider when healthy", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		})
+
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 1, captured[0].Count())
+		assert.Equal(t, 0, captured[1].Count())
+	})
+
+	t.Run("fails over on transient errors", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		})
+		captured[0].SetSendError(errors.New("simulated outage"))
+
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 1, captured[1].Count())
+	})
+
+	t.Run("does not fail over on permanent errors", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		})
+		captured[0].SetSendError(internal.Permanent(errors.New("rejected")))
+
+		err := sendTestEmail(t, f)
+		require.Error(t, err)
+		assert.True(t, IsPermanentError(err))
+		assert.Equal(t, 0, captured[1].Count())
+	})
+
+	t.Run("returns all errors when every provider fails", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		})
+		captured[0].SetSendError(errors.New("first failed"))
+		captured[1].SetSendError(errors.New("second failed"))
+
+		err := sendTestEmail(t, f)
+		require.ErrorContains(t, err, "first failed")
+		require.ErrorContains(t, err, "second failed")
+	})
+
+	t.Run("skips unhealthy providers until the cooldown ends", func(t *testing.T) {
+		f, captured, clock := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers:        []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+			FailureThreshold: 2,
+			CooldownPeriod:   time.Minute,
+		})
+		outage := errors.New("simulated outage")
+		captured[0].SetSendError(outage)
+
+		// After 2 failures, the first provider is marked as unhealthy
+		require.NoError(t, sendTestEmail(t, f))
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 2, captured[1].Count())
+
+		// The first provider is now skipped, even if it recovered
+		captured[0].SetSendError(nil)
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 0, captured[0].Count())
+		assert.Equal(t, 3, captured[1].Count())
+
+		// After the cooldown, the first provider is tried again
+		clock.Step(time.Minute)
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 1, captured[0].Count())
+	})
+
+	t.Run("does not fall back to providers in cooldown", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers:        []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+			FailureThreshold: 1,
+			CooldownPeriod:   time.Minute,
+		})
+
+		// The first provider becomes unhealthy
+		captured[0].SetSendError(errors.New("simulated outage"))
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 1, captured[1].Count())
+
+		// When the healthy provider fails, the one in cooldown is not tried
+		captured[0].SetSendError(nil)
+		captured[1].SetSendError(errors.New("second failed"))
+		require.ErrorContains(t, sendTestEmail(t, f), "second failed")
+		assert.Equal(t, 0, captured[0].Count())
+	})
+
+	t.Run("tries unhealthy providers when all are unhealthy", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers:        []FailoverProvider{{ConnString: "capture://"}},
+			FailureThreshold: 1,
+		})
+		captured[0].SetSendError(errors.New("simulated outage"))
+		require.Error(t, sendTestEmail(t, f))
+
+		captured[0].SetSendError(nil)
+		require.NoError(t, sendTestEmail(t, f))
+		assert.Equal(t, 1, captured[0].Count())
+	})
+
+	t.Run("weighted strategy spreads the load", func(t *testing.T) {
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{
+				{ConnString: "capture://", Weight: 3},
+				{ConnString: "capture://", Weight: 1},
+				{ConnString: "capture://", Weight: 0},
+			},
+			Strategy: FailoverStrategyWeighted,
+		})
+
+		for range 400 {
+			require.NoError(t, sendTestEmail(t, f))
+		}
+
+		// With these weights, the expected counts are 300 and 100
+		assert.InDelta(t, 300, captured[0].Count(), 60)
+		assert.InDelta(t, 100, captured[1].Count(), 60)
+		assert.Equal(t, 0, captured[2].Count())
+	})
+
+	t.Run("records retries when failing over", func(t *testing.T) {
+		reader := sdkMetric.NewManualReader()
+		mp := sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader))
+		f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+			Meter:     mp.Meter("test"),
+		})
+
+		require.NoError(t, sendTestEmail(t, f))
+		captured[0].SetSendError(errors.New("simulated outage"))
+		require.NoError(t, sendTestEmail(t, f))
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(t.Context(), &rm))
+		require.Len(t, rm.ScopeMetrics, 1)
+		var retried metricdata.Sum[int64]
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			if m.Name == "emailer.retried" {
+				retried, _ = m.Data.(metricdata.Sum[int64])
+			}
+		}
+		require.Len(t, retried.DataPoints, 1)
+		assert.Equal(t, int64(1), retried.DataPoints[0].Value)
+		provider, _ := retried.DataPoints[0].Attributes.Value(attrProvider)
+		assert.Equal(t, "capture", provider.AsString())
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewFailoverEmailer(t.Context(), NewFailoverEmailerOpts{})
+		require.ErrorContains(t, err, "at least one provider is required")
+
+		_, err = NewFailoverEmailer(t.Context(), NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "capture://"}},
+			Strategy:  "foo",
+		})
+		require.ErrorContains(t, err, "invalid failover strategy")
+
+		_, err = NewFailoverEmailer(t.Context(), NewFailoverEmailerOpts{
+			Providers: []FailoverProvider{{ConnString: "invalid://"}},
+		})
+		require.ErrorContains(t, err, "failed to create emailer for provider 0")
+	})
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	providers := []*failoverProviderState{
+		{weight: 1},
+		{weight: 0},
+		{weight: 5},
+	}
+
+	res := weightedShuffle(providers)
+	require.Len(t, res, 3)
+	assert.ElementsMatch(t, providers, res)
+
+	// The provider with weight 0 is always last
+	assert.Same(t, providers[1], res[2])
+}
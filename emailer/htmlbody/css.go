@@ -0,0 +1,302 @@
+package htmlbody
+
+import (
+	"strings"
+)
+
+// cssDeclaration is a single "property: value" pair
+type cssDeclaration struct {
+	Property  string
+	Value     string
+	Important bool
+}
+
+func (d cssDeclaration) String() string {
+	if d.Important {
+		return d.Property + ": " + d.Value + " !important"
+	}
+	return d.Property + ": " + d.Value
+}
+
+// cssRule is a rule in a stylesheet
+// It is either a style rule (selectors and declarations), or an at-rule
+type cssRule struct {
+	// Selector list, as written in the stylesheet
+	Selectors string
+	// Declarations of style rules and of at-rules such as @font-face
+	Declarations []cssDeclaration
+
+	// Prelude of at-rules, including the at-keyword (e.g. "@media screen and (max-width: 600px)")
+	AtRule string
+	// Rules nested in at-rules such as @media
+	Rules []cssRule
+}
+
+// At-rules whose block contains other rules
+var cssNestingAtRules = map[string]bool{
+	"@media":    true,
+	"@supports": true,
+}
+
+// At-rules whose block contains declarations
+var cssDeclarationAtRules = map[string]bool{
+	"@font-face": true,
+	"@page":      true,
+}
+
+// parseStylesheet parses a CSS stylesheet
+// The parser is lenient and skips anything it doesn't understand. At-rules other than the ones listed in cssNestingAtRules and cssDeclarationAtRules, including @import, are dropped.
+func parseStylesheet(css string) []cssRule {
+	css = stripCSSComments(css)
+
+	rules := make([]cssRule, 0)
+	for len(css) > 0 {
+		css = strings.TrimLeft(css, " \t\r\n\f")
+		if css == "" {
+			break
+		}
+
+		// HTML comment delimiters are allowed at the top level of stylesheets, for legacy reasons
+		if strings.HasPrefix(css, "<!--") {
+			css = css[4:]
+			continue
+		}
+		if strings.HasPrefix(css, "-->") {
+			css = css[3:]
+			continue
+		}
+
+		// Find the end of the prelude, which is either a block or (for at-rules) a semicolon
+		end := indexCSSDelimiter(css, "{;")
+		if end < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:end])
+		if css[end] == ';' {
+			// Statement at-rules such as @import and @charset are dropped
+			css = css[end+1:]
+			continue
+		}
+
+		blockEnd := matchingBrace(css, end)
+		if blockEnd < 0 {
+			// Unterminated block: treat everything until the end as the block's content
+			blockEnd = len(css)
+		}
+		block := css[end+1 : blockEnd]
+		if blockEnd < len(css) {
+			css = css[blockEnd+1:]
+		} else {
+			css = ""
+		}
+
+		if !strings.HasPrefix(prelude, "@") {
+			if prelude != "" {
+				rules = append(rules, cssRule{
+					Selectors:    prelude,
+					Declarations: parseDeclarations(block),
+				})
+			}
+			continue
+		}
+
+		keyword, _, _ := strings.Cut(prelude, " ")
+		keyword = strings.ToLower(keyword)
+		switch {
+		case cssNestingAtRules[keyword]:
+			rules = append(rules, cssRule{
+				AtRule: prelude,
+				Rules:  parseStylesheet(block),
+			})
+		case cssDeclarationAtRules[keyword]:
+			rules = append(rules, cssRule{
+				AtRule:       prelude,
+				Declarations: parseDeclarations(block),
+			})
+		}
+	}
+
+	return rules
+}
+
+// parseDeclarations parses a list of declarations separated by semicolons, such as the content of a style attribute
+func parseDeclarations(block string) []cssDeclaration {
+	decls := make([]cssDeclaration, 0)
+	for _, part := range splitCSS(stripCSSComments(block), ';') {
+		prop, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.ToLower(strings.TrimSpace(prop))
+		value = strings.TrimSpace(value)
+		if prop == "" || value == "" {
+			continue
+		}
+
+		d := cssDeclaration{Property: prop}
+		if idx := strings.LastIndexByte(value, '!'); idx >= 0 && strings.EqualFold(strings.TrimSpace(value[idx+1:]), "important") {
+			d.Important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		d.Value = value
+		if d.Value == "" {
+			continue
+		}
+
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// serializeDeclarations returns the declarations in the format used by style attributes
+func serializeDeclarations(decls []cssDeclaration) string {
+	parts := make([]string, len(decls))
+	for i, d := range decls {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// serializeStylesheet returns the text of a stylesheet
+func serializeStylesheet(rules []cssRule) string {
+	var b strings.Builder
+	writeCSSRules(&b, rules, "")
+	return b.String()
+}
+
+func writeCSSRules(b *strings.Builder, rules []cssRule, indent string) {
+	for _, r := range rules {
+		b.WriteString(indent)
+		switch {
+		case r.AtRule != "" && r.Rules != nil:
+			b.WriteString(r.AtRule)
+			b.WriteString(" {\n")
+			writeCSSRules(b, r.Rules, indent+"  ")
+			b.WriteString(indent)
+			b.WriteString("}\n")
+			continue
+		case r.AtRule != "":
+			b.WriteString(r.AtRule)
+		default:
+			b.WriteString(r.Selectors)
+		}
+		b.WriteString(" { ")
+		b.WriteString(serializeDeclarations(r.Declarations))
+		b.WriteString(" }\n")
+	}
+}
+
+// stripCSSComments removes comments from CSS, leaving strings untouched
+func stripCSSComments(css string) string {
+	if !strings.Contains(css, "/*") {
+		return css
+	}
+
+	var b strings.Builder
+	b.Grow(len(css))
+	var quote byte
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(css) {
+				b.WriteByte(c)
+				i++
+				c = css[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			// Comments separate tokens
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// indexCSSDelimiter returns the index of the first character in chars that is not inside a string, parentheses, or brackets
+func indexCSSDelimiter(css string, chars string) int {
+	var (
+		quote byte
+		depth int
+	)
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(chars, c) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// matchingBrace returns the index of the brace that closes the block opened at index start
+func matchingBrace(css string, start int) int {
+	var (
+		quote byte
+		depth int
+	)
+	for i := start; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitCSS splits the string on sep, ignoring separators inside strings, parentheses, or brackets
+// Empty parts are omitted
+func splitCSS(css string, sep byte) []string {
+	parts := make([]string, 0)
+	for {
+		idx := indexCSSDelimiter(css, string(sep))
+		part := css
+		if idx >= 0 {
+			part = css[:idx]
+		}
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+		if idx < 0 {
+			return parts
+		}
+		css = css[idx+1:]
+	}
+}
@@ -0,0 +1,80 @@
+package htmlbody
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStylesheet(t *testing.T) {
+	t.Run("style rules", func(t *testing.T) {
+		rules := parseStylesheet(`
+			/* Comment */
+			p, td { color: red; font-family: "Helvetica; Arial", sans-serif }
+			.big{font-size:20px !important;}
+		`)
+		require.Len(t, rules, 2)
+
+		assert.Equal(t, "p, td", rules[0].Selectors)
+		assert.Equal(t, []cssDeclaration{
+			{Property: "color", Value: "red"},
+			{Property: "font-family", Value: `"Helvetica; Arial", sans-serif`},
+		}, rules[0].Declarations)
+
+		assert.Equal(t, ".big", rules[1].Selectors)
+		assert.Equal(t, []cssDeclaration{
+			{Property: "font-size", Value: "20px", Important: true},
+		}, rules[1].Declarations)
+	})
+
+	t.Run("at-rules", func(t *testing.T) {
+		rules := parseStylesheet(`
+			@charset "utf-8";
+			@import url("other.css");
+			@media (max-width: 600px) { p { color: green } .a { margin: 0 } }
+			@font-face { font-family: "Custom"; src: url(font.woff2) }
+			@keyframes spin { from { opacity: 0 } to { opacity: 1 } }
+			a { color: blue }
+		`)
+		require.Len(t, rules, 3)
+
+		assert.Equal(t, "@media (max-width: 600px)", rules[0].AtRule)
+		require.Len(t, rules[0].Rules, 2)
+		assert.Equal(t, "p", rules[0].Rules[0].Selectors)
+		assert.Equal(t, ".a", rules[0].Rules[1].Selectors)
+
+		assert.Equal(t, "@font-face", rules[1].AtRule)
+		assert.Len(t, rules[1].Declarations, 2)
+
+		assert.Equal(t, "a", rules[2].Selectors)
+	})
+
+	t.Run("comments inside strings are preserved", func(t *testing.T) {
+		rules := parseStylesheet(`p { content: "/* not a comment */" }`)
+		require.Len(t, rules, 1)
+		assert.Equal(t, `"/* not a comment */"`, rules[0].Declarations[0].Value)
+	})
+
+	t.Run("unterminated block", func(t *testing.T) {
+		rules := parseStylesheet(`p { color: red`)
+		require.Len(t, rules, 1)
+		assert.Equal(t, "red", rules[0].Declarations[0].Value)
+	})
+
+	t.Run("serialize", func(t *testing.T) {
+		rules := parseStylesheet(`@media screen { p { color: red } } a:hover { color: blue !important }`)
+		assert.Equal(t, "@media screen {\n  p { color: red }\n}\na:hover { color: blue !important }\n", serializeStylesheet(rules))
+	})
+}
+
+func TestParseDeclarations(t *testing.T) {
+	decls := parseDeclarations(`COLOR: Red; background: url("data:image/png;base64,AAAA") no-repeat;; invalid; margin:  0 auto  ! important `)
+	assert.Equal(t, []cssDeclaration{
+		{Property: "color", Value: "Red"},
+		{Property: "background", Value: `url("data:image/png;base64,AAAA") no-repeat`},
+		{Property: "margin", Value: "0 auto", Important: true},
+	}, decls)
+
+	assert.Equal(t, `color: Red; background: url("data:image/png;base64,AAAA") no-repeat; margin: 0 auto !important`, serializeDeclarations(decls))
+}
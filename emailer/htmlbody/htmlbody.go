@@ -0,0 +1,110 @@
+// Package htmlbody prepares HTML email bodies for sending.
+// It can inline the CSS in <style> elements into style attributes (since many email clients ignore <style> elements), sanitize the HTML with an allow-list, and rewrite relative URLs against a base URL.
+package htmlbody
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Options is the options struct for Process
+type Options struct {
+	// If true, the rules in <style> elements are applied to the matching elements as style attributes
+	// Rules that cannot be inlined, such as media queries and rules with pseudo-classes like ":hover", are kept in a <style> element
+	InlineCSS bool
+	// If set, the HTML is sanitized using this allow-list, removing the elements, attributes, CSS, and URLs that are not allowed
+	// Use DefaultPolicy() for a policy that is suitable for most emails
+	SanitizePolicy *Policy
+	// If set, relative URLs in links, images, and CSS are resolved against this URL
+	// Email clients have no base URL, so relative URLs don't work otherwise
+	BaseURL *url.URL
+}
+
+// Enabled returns true if at least one processing step is enabled
+func (o Options) Enabled() bool {
+	return o.InlineCSS || o.SanitizePolicy != nil || o.BaseURL != nil
+}
+
+// Matches the tags that indicate the input is a full document rather than a fragment
+var fullDocumentRegexp = regexp.MustCompile(`(?i)<(!doctype|html|head|body)[\s>]`)
+
+// Process applies the processing steps enabled in the options to the HTML body of an email
+// CSS is inlined first, so the styles that are added are sanitized too.
+// If the input is a fragment rather than a full document, the result is a fragment too.
+func Process(body string, opts Options) (string, error) {
+	if body == "" || !opts.Enabled() {
+		return body, nil
+	}
+
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if opts.InlineCSS {
+		kept := inlineCSS(doc)
+		if len(kept) > 0 {
+			insertStyleElement(doc, kept)
+		}
+	}
+
+	if opts.SanitizePolicy != nil || opts.BaseURL != nil {
+		urls := urlProcessor{
+			base: opts.BaseURL,
+		}
+		if opts.SanitizePolicy != nil {
+			urls.schemes = opts.SanitizePolicy.URLSchemes
+			if urls.schemes == nil {
+				// Only relative URLs are allowed
+				urls.schemes = []string{}
+			}
+		}
+		sanitizeNode(doc, opts.SanitizePolicy, urls)
+	}
+
+	var buf bytes.Buffer
+	if fullDocumentRegexp.MatchString(body) {
+		err = html.Render(&buf, doc)
+	} else {
+		err = renderFragment(&buf, doc)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to render HTML: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// renderFragment renders the content of the body, preceded by the <style> elements in the head
+func renderFragment(buf *bytes.Buffer, doc *html.Node) error {
+	head := findElement(doc, atom.Head)
+	if head != nil {
+		for c := range head.ChildNodes() {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Style {
+				continue
+			}
+			err := html.Render(buf, c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return nil
+	}
+	for c := range body.ChildNodes() {
+		err := html.Render(buf, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package htmlbody
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	t.Run("no options", func(t *testing.T) {
+		const in = `<p onclick="x()">Hello</p>`
+		out, err := Process(in, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, in, out)
+	})
+
+	t.Run("inline CSS", func(t *testing.T) {
+		out, err := Process(`<html><head><style>
+			p { color: red; margin: 0 }
+			.big { font-size: 20px }
+			p.big { font-size: 24px }
+			#hero { color: blue !important }
+		</style></head><body><p class="big" style="color: black">A</p><p id="hero" style="color: green">B</p></body></html>`, Options{InlineCSS: true})
+		require.NoError(t, err)
+		assert.Equal(t, `<html><head></head><body>`+
+			`<p class="big" style="margin: 0; font-size: 24px; color: black">A</p>`+
+			`<p id="hero" style="margin: 0; color: blue !important">B</p>`+
+			`</body></html>`, out)
+	})
+
+	t.Run("rules that cannot be inlined are kept", func(t *testing.T) {
+		out, err := Process(`<style>
+			a { color: red }
+			a:hover, a.x { text-decoration: underline }
+			@media (max-width: 600px) { a { display: block } }
+		</style><a class="x">Link</a>`, Options{InlineCSS: true})
+		require.NoError(t, err)
+		assert.Equal(t, "<style>a:hover { text-decoration: underline }\n@media (max-width: 600px) {\n  a { display: block }\n}\n</style>"+
+			`<a class="x" style="color: red; text-decoration: underline">Link</a>`, out)
+	})
+
+	t.Run("print stylesheets are not inlined", func(t *testing.T) {
+		out, err := Process(`<style media="print">p { color: red }</style><p>A</p>`, Options{InlineCSS: true})
+		require.NoError(t, err)
+		assert.Equal(t, `<style media="print">p { color: red }</style><p>A</p>`, out)
+	})
+
+	t.Run("fragment is returned as fragment", func(t *testing.T) {
+		out, err := Process(`<p>Hello</p><table><tr><td>x</td></tr></table>`, Options{InlineCSS: true})
+		require.NoError(t, err)
+		assert.Equal(t, `<p>Hello</p><table><tbody><tr><td>x</td></tr></tbody></table>`, out)
+	})
+
+	t.Run("full document keeps the doctype", func(t *testing.T) {
+		out, err := Process(`<!DOCTYPE html><html><body><p>Hello</p></body></html>`, Options{SanitizePolicy: DefaultPolicy()})
+		require.NoError(t, err)
+		assert.Equal(t, `<!DOCTYPE html><html><head></head><body><p>Hello</p></body></html>`, out)
+	})
+
+	t.Run("rewrite relative URLs", func(t *testing.T) {
+		base, err := url.Parse("https://example.com/app/")
+		require.NoError(t, err)
+
+		out, err := Process(`<a href="/account">Account</a> <a href="#top">Top</a> <a href="mailto:hi@example.com">Mail</a>`+
+			`<img src="logo.png" style="background: url('img/bg.png')"><td background="bg.gif"></td>`, Options{BaseURL: base})
+		require.NoError(t, err)
+		assert.Equal(t, `<a href="https://example.com/account">Account</a> <a href="#top">Top</a> <a href="mailto:hi@example.com">Mail</a>`+
+			`<img src="https://example.com/app/logo.png" style="background: url(https://example.com/app/img/bg.png)"/>`, out)
+	})
+
+	t.Run("inline, sanitize, and rewrite URLs", func(t *testing.T) {
+		base, err := url.Parse("https://example.com/")
+		require.NoError(t, err)
+
+		out, err := Process(`<style>p { background: url(bg.png) } span { behavior: url(x.htc) }</style>`+
+			`<p>Hi <span onmouseover="alert(1)">there</span></p><script>alert(1)</script>`,
+			Options{InlineCSS: true, SanitizePolicy: DefaultPolicy(), BaseURL: base})
+		require.NoError(t, err)
+		assert.Equal(t, `<p style="background: url(https://example.com/bg.png)">Hi <span>there</span></p>`, out)
+	})
+}
+
+func TestOptionsEnabled(t *testing.T) {
+	assert.False(t, Options{}.Enabled())
+	assert.True(t, Options{InlineCSS: true}.Enabled())
+	assert.True(t, Options{SanitizePolicy: DefaultPolicy()}.Enabled())
+	assert.True(t, Options{BaseURL: &url.URL{}}.Enabled())
+}
@@ -0,0 +1,187 @@
+package htmlbody
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// matchedDeclaration is a declaration that applies to an element, with the information needed to compute the cascade
+type matchedDeclaration struct {
+	cssDeclaration
+	inline      bool
+	specificity specificity
+	order       int
+}
+
+// less returns true if d has lower precedence than o
+func (d matchedDeclaration) less(o matchedDeclaration) bool {
+	// Important declarations win over normal ones, including inline styles
+	if d.Important != o.Important {
+		return !d.Important
+	}
+	// Inline styles win over stylesheets
+	if d.inline != o.inline {
+		return !d.inline
+	}
+	if d.specificity != o.specificity {
+		return d.specificity.less(o.specificity)
+	}
+	return d.order < o.order
+}
+
+// inlineCSS applies the rules in the <style> elements of the document to the matching elements as style attributes
+// The <style> elements are removed; rules that cannot be inlined, such as media queries and rules with pseudo-classes like ":hover", are kept in a single <style> element.
+// Returns the rules that were kept.
+func inlineCSS(doc *html.Node) []cssRule {
+	// Collect all stylesheets, in document order, and remove the <style> elements
+	var (
+		styleNodes []*html.Node
+		sheet      strings.Builder
+	)
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style && isCSSMediaAllowed(getAttr(n, "media")) {
+			styleNodes = append(styleNodes, n)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					sheet.WriteString(c.Data)
+					sheet.WriteByte('\n')
+				}
+			}
+		}
+	}
+	for _, n := range styleNodes {
+		n.Parent.RemoveChild(n)
+	}
+
+	rules := parseStylesheet(sheet.String())
+	if len(rules) == 0 {
+		return nil
+	}
+
+	// Match each selector against the document
+	matched := make(map[*html.Node][]matchedDeclaration)
+	kept := make([]cssRule, 0)
+	order := 0
+	for _, r := range rules {
+		if r.AtRule != "" {
+			kept = append(kept, r)
+			continue
+		}
+
+		unsupported := make([]string, 0)
+		for _, selText := range splitCSS(r.Selectors, ',') {
+			sel, err := parseSelector(selText)
+			if err != nil {
+				unsupported = append(unsupported, selText)
+				continue
+			}
+
+			for n := range doc.Descendants() {
+				if n.Type != html.ElementNode || !sel.matches(n) {
+					continue
+				}
+				for _, d := range r.Declarations {
+					matched[n] = append(matched[n], matchedDeclaration{
+						cssDeclaration: d,
+						specificity:    sel.specificity,
+						order:          order,
+					})
+				}
+			}
+			order++
+		}
+
+		if len(unsupported) > 0 {
+			kept = append(kept, cssRule{
+				Selectors:    strings.Join(unsupported, ", "),
+				Declarations: r.Declarations,
+			})
+		}
+	}
+
+	// Compute the style attribute of each matched element, preserving the existing inline styles
+	for n, decls := range matched {
+		for _, d := range parseDeclarations(getAttr(n, "style")) {
+			decls = append(decls, matchedDeclaration{
+				cssDeclaration: d,
+				inline:         true,
+				order:          order,
+			})
+			order++
+		}
+
+		slices.SortStableFunc(decls, func(a, b matchedDeclaration) int {
+			switch {
+			case a.less(b):
+				return -1
+			case b.less(a):
+				return 1
+			default:
+				return 0
+			}
+		})
+
+		// Apply the declarations in order of precedence, so the ones that win are written last
+		final := make([]cssDeclaration, 0, len(decls))
+		for _, d := range decls {
+			final = slices.DeleteFunc(final, func(e cssDeclaration) bool {
+				return e.Property == d.Property
+			})
+			final = append(final, d.cssDeclaration)
+		}
+		setAttr(n, "style", serializeDeclarations(final))
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// isCSSMediaAllowed returns true if a <style> element with the given media attribute applies to screens
+// Stylesheets meant only for other media (such as print) are not inlined
+func isCSSMediaAllowed(media string) bool {
+	media = strings.ToLower(strings.TrimSpace(media))
+	if media == "" {
+		return true
+	}
+	for _, m := range strings.Split(media, ",") {
+		m = strings.TrimSpace(m)
+		if m == "all" || m == "screen" {
+			return true
+		}
+	}
+	return false
+}
+
+// insertStyleElement adds a <style> element with the rules to the head of the document
+func insertStyleElement(doc *html.Node, rules []cssRule) {
+	style := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "style",
+		DataAtom: atom.Style,
+	}
+	style.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: serializeStylesheet(rules),
+	})
+
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return
+	}
+	head.AppendChild(style)
+}
+
+// findElement returns the first element with the given tag
+func findElement(doc *html.Node, a atom.Atom) *html.Node {
+	for n := range doc.Descendants() {
+		if n.Type == html.ElementNode && n.DataAtom == a {
+			return n
+		}
+	}
+	return nil
+}
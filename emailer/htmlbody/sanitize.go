@@ -0,0 +1,402 @@
+package htmlbody
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Policy is the allow-list used to sanitize HTML
+type Policy struct {
+	// Allowed elements, with the attributes that are allowed on each of them in addition to GlobalAttributes
+	// Elements that are not allowed are removed, but their content is kept, except for elements such as <script> whose content is removed too
+	Elements map[string][]string
+	// Attributes allowed on all elements
+	GlobalAttributes []string
+	// URL schemes allowed in links, images, and CSS url() values
+	// Relative URLs are always allowed
+	URLSchemes []string
+}
+
+// DefaultPolicy returns a Policy that allows the elements and attributes commonly used in emails
+// Scripts, forms, embedded objects, and event handler attributes are not allowed, and links can only use the http, https, mailto, tel, and cid schemes.
+// The http-equiv and content attributes of <meta> are not allowed either, as a refresh can redirect to any URL.
+func DefaultPolicy() *Policy {
+	tableAttrs := []string{"align", "valign", "bgcolor", "background", "width", "height", "border", "cellpadding", "cellspacing", "colspan", "rowspan", "nowrap", "scope", "headers"}
+	return &Policy{
+		Elements: map[string][]string{
+			"html":       {"xmlns"},
+			"head":       nil,
+			"title":      nil,
+			"meta":       {"charset", "name"},
+			"style":      {"type", "media"},
+			"body":       {"bgcolor", "background", "text", "link", "vlink", "alink"},
+			"a":          {"href", "name", "target", "rel"},
+			"abbr":       nil,
+			"address":    nil,
+			"article":    nil,
+			"b":          nil,
+			"bdi":        nil,
+			"bdo":        nil,
+			"big":        nil,
+			"blockquote": {"cite"},
+			"br":         nil,
+			"caption":    {"align"},
+			"center":     nil,
+			"cite":       nil,
+			"code":       nil,
+			"col":        {"align", "valign", "span", "width"},
+			"colgroup":   {"align", "valign", "span", "width"},
+			"dd":         nil,
+			"del":        {"cite", "datetime"},
+			"div":        {"align"},
+			"dl":         nil,
+			"dt":         nil,
+			"em":         nil,
+			"figcaption": nil,
+			"figure":     nil,
+			"font":       {"color", "face", "size"},
+			"footer":     nil,
+			"h1":         {"align"},
+			"h2":         {"align"},
+			"h3":         {"align"},
+			"h4":         {"align"},
+			"h5":         {"align"},
+			"h6":         {"align"},
+			"header":     nil,
+			"hr":         {"align", "noshade", "size", "width"},
+			"i":          nil,
+			"img":        {"src", "alt", "width", "height", "border", "align", "hspace", "vspace"},
+			"ins":        {"cite", "datetime"},
+			"kbd":        nil,
+			"li":         {"value"},
+			"main":       nil,
+			"mark":       nil,
+			"nav":        nil,
+			"ol":         {"start", "type", "reversed"},
+			"p":          {"align"},
+			"pre":        nil,
+			"q":          {"cite"},
+			"s":          nil,
+			"section":    nil,
+			"small":      nil,
+			"span":       nil,
+			"strike":     nil,
+			"strong":     nil,
+			"sub":        nil,
+			"sup":        nil,
+			"table":      tableAttrs,
+			"tbody":      tableAttrs,
+			"td":         tableAttrs,
+			"tfoot":      tableAttrs,
+			"th":         tableAttrs,
+			"thead":      tableAttrs,
+			"time":       {"datetime"},
+			"tr":         tableAttrs,
+			"tt":         nil,
+			"u":          nil,
+			"ul":         {"type"},
+			"wbr":        nil,
+		},
+		GlobalAttributes: []string{"class", "id", "style", "title", "dir", "lang", "role", "aria-label", "aria-hidden"},
+		URLSchemes:       []string{"http", "https", "mailto", "tel", "cid"},
+	}
+}
+
+// Elements that are removed together with their content when they're not allowed
+var dropContentElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Title:    true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Noscript: true,
+	atom.Noembed:  true,
+	atom.Noframes: true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Audio:    true,
+	atom.Video:    true,
+	atom.Canvas:   true,
+}
+
+// Attributes whose value is a URL
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"background": true,
+	"cite":       true,
+}
+
+// CSS properties that can execute code in some (legacy) clients
+var dangerousCSSProperties = map[string]bool{
+	"behavior":     true,
+	"-moz-binding": true,
+}
+
+// urlProcessor validates and rewrites URLs in attributes and CSS
+type urlProcessor struct {
+	// If non-nil, only URLs with these schemes (and relative URLs) are allowed
+	schemes []string
+	// If non-nil, relative URLs are resolved against this URL
+	base *url.URL
+}
+
+// process returns the URL to use in place of u, and false if the URL is not allowed
+func (p urlProcessor) process(u string) (string, bool) {
+	// Browsers ignore tabs and newlines in URLs, so they must be removed before checking the scheme
+	u = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(u))
+
+	// Links to fragments in the same document are left as-is
+	if u == "" || strings.HasPrefix(u, "#") {
+		return u, true
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		// Invalid URLs are left untouched unless they need to be validated
+		if p.schemes != nil {
+			return "", false
+		}
+		return u, true
+	}
+
+	if parsed.Scheme != "" {
+		if p.schemes != nil && !slices.Contains(p.schemes, strings.ToLower(parsed.Scheme)) {
+			return "", false
+		}
+		return u, true
+	}
+
+	if p.base != nil {
+		return p.base.ResolveReference(parsed).String(), true
+	}
+	return u, true
+}
+
+// sanitizeNode removes the elements, attributes, and URLs that are not allowed by the policy from the children of n, recursively
+// If policy is nil, only URLs are processed
+func sanitizeNode(n *html.Node, policy *Policy, urls urlProcessor) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.CommentNode:
+			// Comments can contain conditional comments, which are interpreted as HTML by some clients
+			if policy != nil {
+				n.RemoveChild(c)
+			}
+
+		case html.ElementNode:
+			_, allowed := policy.allowedAttributes(c.Data)
+			switch {
+			case policy != nil && !allowed && (dropContentElements[c.DataAtom] || c.Namespace != ""):
+				// Foreign content (SVG and MathML) is removed too
+				n.RemoveChild(c)
+			case policy != nil && !allowed:
+				// Replace the element with its children, then process them
+				if c.FirstChild != nil {
+					next = c.FirstChild
+				}
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			default:
+				sanitizeAttributes(c, policy, urls)
+				if c.DataAtom == atom.Style {
+					sanitizeStyleElement(c, policy != nil, urls)
+				} else {
+					sanitizeNode(c, policy, urls)
+				}
+			}
+		}
+
+		c = next
+	}
+}
+
+// allowedAttributes returns the list of attributes allowed on the element, in addition to the global ones, and whether the element is allowed
+func (p *Policy) allowedAttributes(tag string) ([]string, bool) {
+	if p == nil {
+		return nil, true
+	}
+	// The structure of the document is always allowed, as the parser creates these elements anyway
+	if tag == "html" || tag == "head" || tag == "body" {
+		return p.Elements[tag], true
+	}
+	attrs, ok := p.Elements[tag]
+	return attrs, ok
+}
+
+func sanitizeAttributes(n *html.Node, policy *Policy, urls urlProcessor) {
+	allowedAttrs, _ := policy.allowedAttributes(n.Data)
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if policy != nil && (a.Namespace != "" || (!slices.Contains(policy.GlobalAttributes, a.Key) && !slices.Contains(allowedAttrs, a.Key))) {
+			continue
+		}
+
+		switch {
+		case urlAttributes[a.Key]:
+			val, ok := urls.process(a.Val)
+			if !ok {
+				continue
+			}
+			a.Val = val
+		case a.Key == "style" && (policy != nil || strings.Contains(strings.ToLower(a.Val), "url(")):
+			decls := sanitizeDeclarations(parseDeclarations(a.Val), policy != nil, urls)
+			if len(decls) == 0 {
+				continue
+			}
+			a.Val = serializeDeclarations(decls)
+		}
+
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+
+	// Links that open in a new window must not have access to the email's window
+	if policy != nil && n.DataAtom == atom.A && getAttr(n, "target") != "" {
+		setAttr(n, "rel", "noopener noreferrer")
+	}
+}
+
+// sanitizeStyleElement sanitizes the stylesheet in a <style> element
+// If strict is false, only URLs are processed
+func sanitizeStyleElement(n *html.Node, strict bool, urls urlProcessor) {
+	var css strings.Builder
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		if c.Type == html.TextNode {
+			css.WriteString(c.Data)
+		}
+		n.RemoveChild(c)
+	}
+
+	rules := sanitizeRules(parseStylesheet(css.String()), strict, urls)
+	if len(rules) == 0 {
+		n.Parent.RemoveChild(n)
+		return
+	}
+
+	n.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: serializeStylesheet(rules),
+	})
+}
+
+func sanitizeRules(rules []cssRule, strict bool, urls urlProcessor) []cssRule {
+	res := make([]cssRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Rules != nil {
+			r.Rules = sanitizeRules(r.Rules, strict, urls)
+			if len(r.Rules) == 0 {
+				continue
+			}
+		} else {
+			r.Declarations = sanitizeDeclarations(r.Declarations, strict, urls)
+			if len(r.Declarations) == 0 {
+				continue
+			}
+		}
+
+		// Prevent breaking out of the <style> element
+		if strings.Contains(strings.ToLower(r.Selectors+r.AtRule), "</") {
+			continue
+		}
+
+		res = append(res, r)
+	}
+	return res
+}
+
+// sanitizeDeclarations removes the declarations that can execute code or that reference URLs that are not allowed, and rewrites relative URLs
+// If strict is false, only URLs are processed
+func sanitizeDeclarations(decls []cssDeclaration, strict bool, urls urlProcessor) []cssDeclaration {
+	res := make([]cssDeclaration, 0, len(decls))
+	for _, d := range decls {
+		if strict {
+			// Remove escapes and whitespace that could be used to obfuscate the values
+			normalized := strings.ToLower(d.Value)
+			normalized = strings.NewReplacer("\\", "", " ", "", "\t", "", "\n", "", "\r", "").Replace(normalized)
+			if dangerousCSSProperties[d.Property] ||
+				strings.Contains(normalized, "expression(") ||
+				strings.Contains(normalized, "javascript:") ||
+				strings.Contains(normalized, "vbscript:") ||
+				strings.Contains(normalized, "</") {
+				continue
+			}
+		}
+
+		val, ok := rewriteCSSURLs(d.Value, urls)
+		if !ok {
+			continue
+		}
+		d.Value = val
+		res = append(res, d)
+	}
+	return res
+}
+
+// rewriteCSSURLs processes the url() values in a CSS value
+// Returns false if any URL is not allowed
+func rewriteCSSURLs(value string, urls urlProcessor) (string, bool) {
+	lower := strings.ToLower(value)
+	if !strings.Contains(lower, "url(") {
+		return value, true
+	}
+
+	var b strings.Builder
+	for {
+		idx := strings.Index(lower, "url(")
+		if idx < 0 {
+			b.WriteString(value)
+			return b.String(), true
+		}
+		end := strings.IndexByte(lower[idx:], ')')
+		if end < 0 {
+			return "", false
+		}
+		end += idx
+
+		arg := strings.TrimSpace(value[idx+4 : end])
+		if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+			arg = arg[1 : len(arg)-1]
+		}
+		u, ok := urls.process(arg)
+		if !ok {
+			return "", false
+		}
+
+		b.WriteString(value[:idx])
+		if strings.ContainsAny(u, " \t\"'()\\") {
+			b.WriteString(`url("`)
+			b.WriteString(strings.ReplaceAll(u, `"`, `%22`))
+			b.WriteString(`")`)
+		} else {
+			// Unquoted URLs avoid escaping the quotes in style attributes
+			b.WriteString("url(")
+			b.WriteString(u)
+			b.WriteString(")")
+		}
+
+		value = value[end+1:]
+		lower = lower[end+1:]
+	}
+}
@@ -0,0 +1,98 @@
+package htmlbody
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	sanitize := func(t *testing.T, in string, policy *Policy) string {
+		t.Helper()
+		if policy == nil {
+			policy = DefaultPolicy()
+		}
+		out, err := Process(in, Options{SanitizePolicy: policy})
+		require.NoError(t, err)
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		in     string
+		expect string
+	}{
+		{
+			name:   "allowed content is unchanged",
+			in:     `<table width="100%" cellpadding="0"><tr><td align="center"><b>Hi</b> <a href="https://example.com">link</a></td></tr></table>`,
+			expect: `<table width="100%" cellpadding="0"><tbody><tr><td align="center"><b>Hi</b> <a href="https://example.com">link</a></td></tr></tbody></table>`,
+		},
+		{
+			name:   "scripts are removed with their content",
+			in:     `<p>A</p><script>alert(1)</script><iframe src="https://evil.example"></iframe><p>B</p>`,
+			expect: `<p>A</p><p>B</p>`,
+		},
+		{
+			name:   "unknown elements are unwrapped",
+			in:     `<form action="/x"><custom-el>Keep <b>me</b></custom-el><input name="a"></form>`,
+			expect: `Keep <b>me</b>`,
+		},
+		{
+			name:   "foreign content is removed",
+			in:     `<p>A<svg><circle r="1"></circle><text>hidden</text></svg></p>`,
+			expect: `<p>A</p>`,
+		},
+		{
+			name:   "event handlers and unknown attributes are removed",
+			in:     `<img src="https://example.com/a.png" onerror="alert(1)" data-x="1" alt="A">`,
+			expect: `<img src="https://example.com/a.png" alt="A"/>`,
+		},
+		{
+			name:   "URLs with disallowed schemes are removed",
+			in:     `<a href="javascript:alert(1)">a</a><a href=" jav&#x09;ascript:alert(1)">b</a><img src="data:image/png;base64,AAAA"><a href="cid:logo">c</a>`,
+			expect: `<a>a</a><a>b</a><img/><a href="cid:logo">c</a>`,
+		},
+		{
+			name:   "links opening in new windows get rel noopener",
+			in:     `<a href="https://example.com" target="_blank" rel="opener">x</a>`,
+			expect: `<a href="https://example.com" rel="noopener noreferrer" target="_blank">x</a>`,
+		},
+		{
+			name:   "dangerous CSS is removed",
+			in:     `<p style="color: red; width: expression(alert(1)); background: url(javascript:alert(1)); behavior: url(x.htc)">x</p><p style="width: e\xpression(1)">y</p>`,
+			expect: `<p style="color: red">x</p><p>y</p>`,
+		},
+		{
+			name:   "style elements are sanitized",
+			in:     `<style>p { color: red; background: url("javascript:x") } a { -moz-binding: url(x.xml) } @import url(evil.css);</style><p>x</p>`,
+			expect: "<style>p { color: red }\n</style><p>x</p>",
+		},
+		{
+			name:   "meta refresh is removed",
+			in:     `<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="0;url=javascript:alert(1)"></head><body><p>x</p></body></html>`,
+			expect: `<html><head><meta charset="utf-8"/><meta/></head><body><p>x</p></body></html>`,
+		},
+		{
+			name:   "comments are removed",
+			in:     `<p>A<!--[if mso]><script>x</script><![endif]--></p>`,
+			expect: `<p>A</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, sanitize(t, tt.in, nil))
+		})
+	}
+
+	t.Run("custom policy", func(t *testing.T) {
+		policy := &Policy{
+			Elements: map[string][]string{
+				"a": {"href"},
+			},
+			URLSchemes: []string{"https"},
+		}
+		out := sanitize(t, `<p class="x"><a href="http://example.com" title="t">a</a><a href="https://example.com">b</a><a href="/rel">c</a></p>`, policy)
+		assert.Equal(t, `<a>a</a><a href="https://example.com">b</a><a href="/rel">c</a>`, out)
+	})
+}
@@ -0,0 +1,457 @@
+package htmlbody
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var errUnsupportedSelector = errors.New("unsupported selector")
+
+// selector is a complex selector, such as "table.main > tr td"
+// Compound selectors are stored right-to-left: parts[0] is the subject of the selector
+type selector struct {
+	parts       []compoundSelector
+	specificity specificity
+}
+
+// combinator is the relationship between a compound selector and the one before it
+type combinator byte
+
+const (
+	combinatorNone       combinator = 0
+	combinatorDescendant combinator = ' '
+	combinatorChild      combinator = '>'
+	combinatorAdjacent   combinator = '+'
+	combinatorSibling    combinator = '~'
+)
+
+// compoundSelector is a sequence of simple selectors that apply to the same element, such as "td.cell[align]"
+type compoundSelector struct {
+	// Element name, or empty for any element
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+	pseudos []string
+	// Combinator that relates this compound selector with the next one in the list (i.e. the one on its left)
+	combinator combinator
+}
+
+type attrSelector struct {
+	name string
+	// One of "", "=", "~=", "|=", "^=", "$=", "*="
+	op    string
+	value string
+}
+
+// specificity of a selector, as (IDs, classes/attributes/pseudo-classes, elements)
+type specificity [3]int
+
+func (s specificity) less(o specificity) bool {
+	for i := range s {
+		if s[i] != o[i] {
+			return s[i] < o[i]
+		}
+	}
+	return false
+}
+
+// Pseudo-classes that can be evaluated statically, without user interaction or layout
+var supportedPseudoClasses = map[string]bool{
+	"first-child":   true,
+	"last-child":    true,
+	"only-child":    true,
+	"first-of-type": true,
+	"last-of-type":  true,
+}
+
+// parseSelector parses a complex selector
+// Returns errUnsupportedSelector for selectors that cannot be evaluated statically, such as those with ":hover" or pseudo-elements
+func parseSelector(sel string) (*selector, error) {
+	sel = strings.TrimSpace(sel)
+	if sel == "" {
+		return nil, errUnsupportedSelector
+	}
+
+	// Parse left-to-right, then reverse
+	parts := make([]compoundSelector, 0, 2)
+	var (
+		cur     compoundSelector
+		hasCur  bool
+		pending combinator
+	)
+	flush := func() {
+		if hasCur {
+			parts = append(parts, cur)
+		}
+		cur = compoundSelector{}
+		hasCur = false
+	}
+
+	for i := 0; i < len(sel); {
+		c := sel[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			if hasCur && pending == combinatorNone {
+				pending = combinatorDescendant
+			}
+			continue
+		case c == '>' || c == '+' || c == '~':
+			if !hasCur && len(parts) == 0 {
+				return nil, errUnsupportedSelector
+			}
+			pending = combinator(c)
+			i++
+			continue
+		}
+
+		// Start of a new compound selector after a combinator
+		if pending != combinatorNone {
+			if !hasCur {
+				return nil, errUnsupportedSelector
+			}
+			flush()
+			cur.combinator = pending
+			pending = combinatorNone
+		}
+
+		switch {
+		case c == '*':
+			if hasCur {
+				return nil, errUnsupportedSelector
+			}
+			i++
+		case c == '#':
+			name, n := readCSSIdent(sel[i+1:])
+			if n == 0 {
+				return nil, errUnsupportedSelector
+			}
+			cur.id = name
+			i += n + 1
+		case c == '.':
+			name, n := readCSSIdent(sel[i+1:])
+			if n == 0 {
+				return nil, errUnsupportedSelector
+			}
+			cur.classes = append(cur.classes, name)
+			i += n + 1
+		case c == '[':
+			end := strings.IndexByte(sel[i:], ']')
+			if end < 0 {
+				return nil, errUnsupportedSelector
+			}
+			attr, err := parseAttrSelector(sel[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			cur.attrs = append(cur.attrs, attr)
+			i += end + 1
+		case c == ':':
+			name, n := readCSSIdent(sel[i+1:])
+			if n == 0 || !supportedPseudoClasses[strings.ToLower(name)] {
+				// This includes pseudo-elements ("::before") and functional pseudo-classes (":not(...)")
+				return nil, errUnsupportedSelector
+			}
+			cur.pseudos = append(cur.pseudos, strings.ToLower(name))
+			i += n + 1
+		default:
+			if hasCur {
+				// Type selectors must come first in a compound selector
+				return nil, errUnsupportedSelector
+			}
+			name, n := readCSSIdent(sel[i:])
+			if n == 0 {
+				return nil, errUnsupportedSelector
+			}
+			cur.tag = strings.ToLower(name)
+			i += n
+		}
+		hasCur = true
+	}
+
+	if pending != combinatorNone && pending != combinatorDescendant {
+		// Dangling combinator
+		return nil, errUnsupportedSelector
+	}
+	flush()
+	if len(parts) == 0 {
+		return nil, errUnsupportedSelector
+	}
+
+	// Reverse so the subject is first
+	// Each part already stores the combinator that relates it to the part on its left
+	s := &selector{
+		parts: make([]compoundSelector, len(parts)),
+	}
+	for i := range parts {
+		p := parts[len(parts)-1-i]
+		s.parts[i] = p
+
+		if p.id != "" {
+			s.specificity[0]++
+		}
+		s.specificity[1] += len(p.classes) + len(p.attrs) + len(p.pseudos)
+		if p.tag != "" {
+			s.specificity[2]++
+		}
+	}
+
+	return s, nil
+}
+
+func parseAttrSelector(s string) (attrSelector, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, "=~|^$*")
+	if idx < 0 {
+		if s == "" {
+			return attrSelector{}, errUnsupportedSelector
+		}
+		return attrSelector{name: strings.ToLower(s)}, nil
+	}
+
+	a := attrSelector{
+		name: strings.ToLower(strings.TrimSpace(s[:idx])),
+	}
+	rest := s[idx:]
+	switch {
+	case rest[0] == '=':
+		a.op = "="
+		rest = rest[1:]
+	case len(rest) > 1 && rest[1] == '=':
+		a.op = rest[:2]
+		rest = rest[2:]
+	default:
+		return attrSelector{}, errUnsupportedSelector
+	}
+
+	rest = strings.TrimSpace(rest)
+	// Case-insensitive flag (e.g. [type="a" i]) is not supported
+	if len(rest) >= 2 && (rest[0] == '"' || rest[0] == '\'') {
+		if rest[len(rest)-1] != rest[0] {
+			return attrSelector{}, errUnsupportedSelector
+		}
+		rest = rest[1 : len(rest)-1]
+	} else if strings.ContainsAny(rest, " \t\"'") {
+		return attrSelector{}, errUnsupportedSelector
+	}
+	a.value = rest
+
+	if a.name == "" {
+		return attrSelector{}, errUnsupportedSelector
+	}
+	return a, nil
+}
+
+// readCSSIdent reads an identifier at the beginning of s, returning it and the number of bytes consumed
+// Escape sequences are not supported
+func readCSSIdent(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '-' || c == '_' || c >= 0x80 ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			n++
+			continue
+		}
+		break
+	}
+	return s[:n], n
+}
+
+// matches returns true if the element matches the selector
+func (s *selector) matches(n *html.Node) bool {
+	return matchParts(s.parts, n)
+}
+
+func matchParts(parts []compoundSelector, n *html.Node) bool {
+	if !parts[0].matches(n) {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+
+	rest := parts[1:]
+	switch parts[0].combinator {
+	case combinatorDescendant:
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if matchParts(rest, p) {
+				return true
+			}
+		}
+	case combinatorChild:
+		p := parentElement(n)
+		return p != nil && matchParts(rest, p)
+	case combinatorAdjacent:
+		p := prevElement(n)
+		return p != nil && matchParts(rest, p)
+	case combinatorSibling:
+		for p := prevElement(n); p != nil; p = prevElement(p) {
+			if matchParts(rest, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *compoundSelector) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && getAttr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(getAttr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, have := range classes {
+				if have == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.matches(n) {
+			return false
+		}
+	}
+	for _, p := range c.pseudos {
+		if !matchPseudo(p, n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) matches(n *html.Node) bool {
+	var (
+		val   string
+		found bool
+	)
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == a.name {
+			val = attr.Val
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return val == a.value
+	case "~=":
+		for _, f := range strings.Fields(val) {
+			if f == a.value {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return val == a.value || strings.HasPrefix(val, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(val, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(val, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(val, a.value)
+	}
+	return false
+}
+
+func matchPseudo(pseudo string, n *html.Node) bool {
+	switch pseudo {
+	case "first-child":
+		return prevElement(n) == nil
+	case "last-child":
+		return nextElement(n) == nil
+	case "only-child":
+		return prevElement(n) == nil && nextElement(n) == nil
+	case "first-of-type":
+		for p := prevElement(n); p != nil; p = prevElement(p) {
+			if p.Data == n.Data {
+				return false
+			}
+		}
+		return true
+	case "last-of-type":
+		for p := nextElement(n); p != nil; p = nextElement(p) {
+			if p.Data == n.Data {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func parentElement(n *html.Node) *html.Node {
+	p := n.Parent
+	if p == nil || p.Type != html.ElementNode {
+		return nil
+	}
+	return p
+}
+
+func prevElement(n *html.Node) *html.Node {
+	for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+func nextElement(n *html.Node) *html.Node {
+	for p := n.NextSibling; p != nil; p = p.NextSibling {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key string, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(n *html.Node, key string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package htmlbody
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestParseSelector(t *testing.T) {
+	t.Run("specificity", func(t *testing.T) {
+		tests := map[string]specificity{
+			"*":                    {0, 0, 0},
+			"td":                   {0, 0, 1},
+			"table td":             {0, 0, 2},
+			".a.b":                 {0, 2, 0},
+			"#main > p.intro":      {1, 1, 1},
+			"a[href^='https']":     {0, 1, 1},
+			"li:first-child + li":  {0, 1, 2},
+			"div ~ p:last-of-type": {0, 1, 2},
+		}
+		for sel, expect := range tests {
+			s, err := parseSelector(sel)
+			require.NoError(t, err, sel)
+			assert.Equal(t, expect, s.specificity, sel)
+		}
+	})
+
+	t.Run("unsupported selectors", func(t *testing.T) {
+		for _, sel := range []string{"", "a:hover", "p::before", "li:not(.a)", "> p", "p >", "p.a div#b.c:nth-child(2)", ".a*"} {
+			_, err := parseSelector(sel)
+			require.ErrorIs(t, err, errUnsupportedSelector, sel)
+		}
+	})
+}
+
+func TestSelectorMatches(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="main" class="wrapper outer">
+		<p class="intro" lang="en-US">First</p>
+		<p data-role="note button">Second</p>
+		<table><tr><td>Cell</td></tr></table>
+		<p>Third</p>
+	</div>`))
+	require.NoError(t, err)
+
+	// Returns the text of the matching elements
+	match := func(sel string) []string {
+		s, err := parseSelector(sel)
+		require.NoError(t, err, sel)
+		res := make([]string, 0)
+		for n := range doc.Descendants() {
+			if n.Type == html.ElementNode && n.DataAtom != 0 && s.matches(n) && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+				res = append(res, strings.TrimSpace(n.FirstChild.Data))
+			}
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"First", "Second", "Third"}, match("p"))
+	assert.Equal(t, []string{"First"}, match("p.intro"))
+	assert.Equal(t, []string{"First", "Second", "Third"}, match("#main > p"))
+	assert.Equal(t, []string{"First", "Second", "Third"}, match(".wrapper.outer p"))
+	assert.Empty(t, match(".wrapper.missing p"))
+	assert.Equal(t, []string{"Cell"}, match("div table td"))
+	assert.Empty(t, match("div > td"))
+	assert.Equal(t, []string{"Second"}, match(".intro + p"))
+	assert.Equal(t, []string{"Second", "Third"}, match(".intro ~ p"))
+	assert.Equal(t, []string{"First"}, match("p:first-child"))
+	assert.Equal(t, []string{"Third"}, match("p:last-child"))
+	assert.Equal(t, []string{"Third"}, match("p:last-of-type"))
+	assert.Equal(t, []string{"First"}, match("[lang|=en]"))
+	assert.Equal(t, []string{"Second"}, match("[data-role~=note]"))
+	assert.Equal(t, []string{"Second"}, match(`[data-role^="note"]`))
+	assert.Equal(t, []string{"Second"}, match("[data-role$=button]"))
+	assert.Equal(t, []string{"Second"}, match("[data-role*='te bu']"))
+	assert.Equal(t, []string{"Second"}, match("p[data-role]"))
+	assert.Empty(t, match("[data-role=note]"))
+}
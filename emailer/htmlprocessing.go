@@ -0,0 +1,49 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/italypaleale/go-kit/emailer/htmlbody"
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+// WithHTMLProcessing returns a Middleware that processes the HTML body of messages before they're sent, for example to inline CSS and sanitize user-supplied content
+// See htmlbody.Options for the processing steps that are available
+// Messages without a HTML body are sent unchanged
+func WithHTMLProcessing(opts htmlbody.Options) Middleware {
+	return func(next Emailer) Emailer {
+		return &htmlProcessingEmailer{
+			next: next,
+			opts: opts,
+		}
+	}
+}
+
+type htmlProcessingEmailer struct {
+	next Emailer
+	opts htmlbody.Options
+}
+
+// Init initializes the inner emailer.
+func (e *htmlProcessingEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	return e.next.Init(ctx, opts)
+}
+
+// SendEmail processes the HTML body of the message, then sends it with the inner emailer.
+func (e *htmlProcessingEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message SendEmailMessage) error {
+	if message.HTML != "" {
+		html, err := htmlbody.Process(message.HTML, e.opts)
+		if err != nil {
+			return internal.Permanent(fmt.Errorf("failed to process HTML body: %w", err))
+		}
+		message.HTML = html
+	}
+
+	return e.next.SendEmail(ctx, toEmail, subject, message)
+}
+
+// Unwrap returns the inner Emailer.
+func (e *htmlProcessingEmailer) Unwrap() Emailer {
+	return e.next
+}
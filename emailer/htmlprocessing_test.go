@@ -0,0 +1,53 @@
+package emailer
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/go-kit/emailer/capture"
+	"github.com/italypaleale/go-kit/emailer/htmlbody"
+)
+
+func TestWithHTMLProcessing(t *testing.T) {
+	base, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	captured := &capture.CaptureEmailer{}
+	e := Use(captured, WithHTMLProcessing(htmlbody.Options{
+		InlineCSS:      true,
+		SanitizePolicy: htmlbody.DefaultPolicy(),
+		BaseURL:        base,
+	}))
+
+	t.Run("HTML body is processed", func(t *testing.T) {
+		captured.Reset()
+		err := e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{
+			Text: "Hello",
+			HTML: `<style>p { color: red }</style><p>Hello <a href="/welcome" onclick="x()">there</a></p><script>alert(1)</script>`,
+		})
+		require.NoError(t, err)
+
+		msg, ok := captured.Last()
+		require.True(t, ok)
+		assert.Equal(t, "Hello", msg.Message.Text)
+		assert.Equal(t, `<p style="color: red">Hello <a href="https://example.com/welcome">there</a></p>`, msg.Message.HTML)
+	})
+
+	t.Run("messages without HTML are unchanged", func(t *testing.T) {
+		captured.Reset()
+		err := e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{Text: "<b>Hello</b>"})
+		require.NoError(t, err)
+
+		msg, ok := captured.Last()
+		require.True(t, ok)
+		assert.Equal(t, "<b>Hello</b>", msg.Message.Text)
+		assert.Empty(t, msg.Message.HTML)
+	})
+
+	t.Run("unwrap returns the inner emailer", func(t *testing.T) {
+		assert.Same(t, captured, Unwrap(e))
+	})
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+)
+
+// PermanentError wraps an error caused by the message itself, such as an invalid recipient or a rejected payload
+// Sending the same message again, even with a different provider, is expected to fail the same way
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps err in a PermanentError
+// Returns nil if err is nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return PermanentError{Err: err}
+}
+
+// Error implements the error interface
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent returns true if err is or wraps a PermanentError
+func IsPermanent(err error) bool {
+	var pErr PermanentError
+	return errors.As(err, &pErr)
+}
+
+// IsPermanentHTTPStatus returns true if a response from a provider's HTTP API with the given status code indicates that the message was rejected
+// Errors with other status codes, including authentication failures, throttling, and server errors, are specific to the provider that returned them
+func IsPermanentHTTPStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// NewHTTPClient returns a HTTP client whose transport is instrumented with OpenTelemetry
+// If opts.DisableInstrumentation is set, the client uses the default transport without instrumentation
+func NewHTTPClient(opts InitOpts) *http.Client {
+	if opts.DisableInstrumentation {
+		return &http.Client{
+			Transport: http.DefaultTransport,
+		}
+	}
+
+	transportOpts := make([]otelhttp.Option, 0, 2)
+	if opts.TracerProvider != nil {
+		transportOpts = append(transportOpts, otelhttp.WithTracerProvider(opts.TracerProvider))
+	}
+	if opts.MeterProvider != nil {
+		transportOpts = append(transportOpts, otelhttp.WithMeterProvider(opts.MeterProvider))
+	}
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport, transportOpts...),
+	}
+}
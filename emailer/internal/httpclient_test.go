@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("instrumented", func(t *testing.T) {
+		client := NewHTTPClient(InitOpts{MeterProvider: noop.NewMeterProvider()})
+		assert.IsType(t, &otelhttp.Transport{}, client.Transport)
+	})
+
+	t.Run("instrumentation disabled", func(t *testing.T) {
+		client := NewHTTPClient(InitOpts{DisableInstrumentation: true})
+		assert.Same(t, http.DefaultTransport, client.Transport)
+	})
+}
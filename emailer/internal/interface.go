@@ -4,6 +4,10 @@ import (
 	"context"
 	"log/slog"
 	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // InitOpts is the options struct for the Init method
@@ -13,6 +17,14 @@ type InitOpts struct {
 	// Optional logger
 	// Uses the default slog if unset
 	Logger *slog.Logger
+	// Optional tracer provider for instrumenting outbound HTTP requests
+	// Uses the global tracer provider if unset
+	TracerProvider trace.TracerProvider
+	// Optional meter provider for instrumenting outbound HTTP requests
+	// Uses the global meter provider if unset
+	MeterProvider metric.MeterProvider
+	// If true, outbound HTTP requests are not instrumented
+	DisableInstrumentation bool
 }
 
 // Emailer is the interface for objects that send email notifications
@@ -29,4 +41,27 @@ type SendEmailMessage struct {
 	Text string
 	// Email content as HTML, which can be empty
 	HTML string
+
+	// Optional custom headers to add to the message, such as "X-Entity-Ref-ID"
+	// Headers that are set by the emailer, such as "From", "To", "Subject", and "Content-Type", cannot be set
+	Headers map[string]string
+	// Optional List-Unsubscribe header, including support for one-click unsubscribe (RFC 8058)
+	ListUnsubscribe *ListUnsubscribe
+	// Optional categories used to group messages in the provider's analytics
+	// With SendGrid, these are sent as categories; with AWS SES, each category is sent as a message tag with value "true"
+	// SMTP ignores this field
+	Categories []string
+	// Optional key-value metadata attached to the message, which is included in delivery events
+	// With SendGrid, these are sent as custom arguments; with AWS SES, as message tags
+	// SMTP ignores this field
+	Tags map[string]string
+	// If set, enables or disables open tracking for this message, overriding the provider's settings
+	// Supported by SendGrid only; with AWS SES, tracking is configured in the configuration set
+	TrackOpens *bool
+	// If set, enables or disables click tracking for this message, overriding the provider's settings
+	// Supported by SendGrid only; with AWS SES, tracking is configured in the configuration set
+	TrackClicks *bool
+	// If set to a time in the future, the provider delivers the message at that time
+	// Supported by SendGrid only (up to 72 hours in advance); other providers return a permanent error wrapping ErrScheduledSendingNotSupported
+	SendAt time.Time
 }
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrScheduledSendingNotSupported is returned by emailers that cannot deliver messages at a later time, when SendEmailMessage.SendAt is in the future
+var ErrScheduledSendingNotSupported = errors.New("scheduled sending is not supported by this emailer")
+
+// ListUnsubscribe contains the options for the List-Unsubscribe header
+// At least one of URL and Mailto is required
+type ListUnsubscribe struct {
+	// URL the recipient can visit to unsubscribe
+	// When OneClick is true, this must be a HTTPS URL that accepts POST requests with the body "List-Unsubscribe=One-Click"
+	URL string
+	// Address the recipient can send an email to in order to unsubscribe, optionally with a subject (e.g. "unsubscribe@example.com?subject=unsubscribe")
+	Mailto string
+	// If true, adds the "List-Unsubscribe-Post" header, which allows mail clients to unsubscribe the recipient with a single POST request to URL (RFC 8058)
+	// Note that RFC 8058 also requires the message to have a DKIM signature covering both headers
+	OneClick bool
+}
+
+// Header is a message header
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Headers that are set by the emailers, or by the SMTP servers, and cannot be set by callers
+var reservedHeaders = []string{
+	"Bcc",
+	"Cc",
+	"Content-Transfer-Encoding",
+	"Content-Type",
+	"Dkim-Signature",
+	"From",
+	"Mime-Version",
+	"Received",
+	"Reply-To",
+	"Return-Path",
+	"Sender",
+	"Subject",
+	"To",
+}
+
+// CustomHeaders returns the validated list of custom headers for the message, including the List-Unsubscribe headers, sorted by name
+func (m SendEmailMessage) CustomHeaders() ([]Header, error) {
+	headers := make([]Header, 0, len(m.Headers)+2)
+	for name, value := range m.Headers {
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if !isValidHeaderName(name) {
+			return nil, fmt.Errorf("invalid header name '%s'", name)
+		}
+		if slices.Contains(reservedHeaders, canonical) {
+			return nil, fmt.Errorf("header '%s' cannot be set", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid value for header '%s': must not contain CR or LF characters", name)
+		}
+		if m.ListUnsubscribe != nil && (canonical == "List-Unsubscribe" || canonical == "List-Unsubscribe-Post") {
+			return nil, fmt.Errorf("header '%s' cannot be set when ListUnsubscribe is set", name)
+		}
+		headers = append(headers, Header{Name: canonical, Value: value})
+	}
+
+	if m.ListUnsubscribe != nil {
+		lu, err := m.ListUnsubscribe.headers()
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, lu...)
+	}
+
+	slices.SortFunc(headers, func(a, b Header) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return headers, nil
+}
+
+// headers returns the List-Unsubscribe and List-Unsubscribe-Post headers
+func (l ListUnsubscribe) headers() ([]Header, error) {
+	if l.URL == "" && l.Mailto == "" {
+		return nil, errors.New("invalid ListUnsubscribe: at least one of URL and Mailto is required")
+	}
+
+	values := make([]string, 0, 2)
+	if l.URL != "" {
+		u, err := url.Parse(l.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, errors.New("invalid ListUnsubscribe: URL must be a HTTP(S) URL")
+		}
+		if l.OneClick && u.Scheme != "https" {
+			return nil, errors.New("invalid ListUnsubscribe: URL must use HTTPS for one-click unsubscribe")
+		}
+		values = append(values, "<"+u.String()+">")
+	} else if l.OneClick {
+		return nil, errors.New("invalid ListUnsubscribe: URL is required for one-click unsubscribe")
+	}
+
+	if l.Mailto != "" {
+		mailto := strings.TrimPrefix(l.Mailto, "mailto:")
+		addr, _, _ := strings.Cut(mailto, "?")
+		err := ValidateEmailAddress("ListUnsubscribe mailto address", addr)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(mailto, "\r\n<>, ") {
+			return nil, errors.New("invalid ListUnsubscribe: mailto address contains invalid characters")
+		}
+		values = append(values, "<mailto:"+mailto+">")
+	}
+
+	headers := []Header{
+		{Name: "List-Unsubscribe", Value: strings.Join(values, ", ")},
+	}
+	if l.OneClick {
+		headers = append(headers, Header{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"})
+	}
+	return headers, nil
+}
+
+// IsScheduled returns true if the message has a SendAt time in the future
+func (m SendEmailMessage) IsScheduled(now time.Time) bool {
+	return !m.SendAt.IsZero() && m.SendAt.After(now)
+}
+
+// isValidHeaderName returns true if name contains only the characters allowed in header field names (RFC 5322)
+func isValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == ':' {
+			return false
+		}
+	}
+	return true
+}
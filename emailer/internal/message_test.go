@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomHeaders(t *testing.T) {
+	t.Run("headers are canonicalized and sorted", func(t *testing.T) {
+		headers, err := SendEmailMessage{
+			Headers: map[string]string{
+				"x-entity-ref-id": "abc123",
+				"X-Campaign":      "welcome",
+			},
+		}.CustomHeaders()
+		require.NoError(t, err)
+		assert.Equal(t, []Header{
+			{Name: "X-Campaign", Value: "welcome"},
+			{Name: "X-Entity-Ref-Id", Value: "abc123"},
+		}, headers)
+	})
+
+	t.Run("no headers", func(t *testing.T) {
+		headers, err := SendEmailMessage{}.CustomHeaders()
+		require.NoError(t, err)
+		assert.Empty(t, headers)
+	})
+
+	t.Run("reserved headers are rejected", func(t *testing.T) {
+		for _, name := range []string{"From", "to", "BCC", "Subject", "content-type", "Reply-To"} {
+			_, err := SendEmailMessage{Headers: map[string]string{name: "x"}}.CustomHeaders()
+			require.ErrorContains(t, err, "cannot be set", name)
+		}
+	})
+
+	t.Run("invalid names and values are rejected", func(t *testing.T) {
+		_, err := SendEmailMessage{Headers: map[string]string{"X Bad": "x"}}.CustomHeaders()
+		require.ErrorContains(t, err, "invalid header name")
+		_, err = SendEmailMessage{Headers: map[string]string{"X-Bad:": "x"}}.CustomHeaders()
+		require.ErrorContains(t, err, "invalid header name")
+		_, err = SendEmailMessage{Headers: map[string]string{"X-Good": "x\r\nBcc: attacker@evil.example"}}.CustomHeaders()
+		require.ErrorContains(t, err, "must not contain CR or LF")
+	})
+}
+
+func TestListUnsubscribe(t *testing.T) {
+	tests := []struct {
+		name   string
+		lu     ListUnsubscribe
+		expect []Header
+		err    string
+	}{
+		{
+			name: "one-click with mailto",
+			lu:   ListUnsubscribe{URL: "https://example.com/unsub?id=1", Mailto: "unsub@example.com?subject=unsubscribe", OneClick: true},
+			expect: []Header{
+				{Name: "List-Unsubscribe", Value: "<https://example.com/unsub?id=1>, <mailto:unsub@example.com?subject=unsubscribe>"},
+				{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+			},
+		},
+		{
+			name: "URL only",
+			lu:   ListUnsubscribe{URL: "http://example.com/unsub"},
+			expect: []Header{
+				{Name: "List-Unsubscribe", Value: "<http://example.com/unsub>"},
+			},
+		},
+		{
+			name: "mailto only, with scheme",
+			lu:   ListUnsubscribe{Mailto: "mailto:unsub@example.com"},
+			expect: []Header{
+				{Name: "List-Unsubscribe", Value: "<mailto:unsub@example.com>"},
+			},
+		},
+		{
+			name: "empty",
+			lu:   ListUnsubscribe{},
+			err:  "at least one of URL and Mailto is required",
+		},
+		{
+			name: "one-click requires HTTPS",
+			lu:   ListUnsubscribe{URL: "http://example.com/unsub", OneClick: true},
+			err:  "must use HTTPS",
+		},
+		{
+			name: "one-click requires URL",
+			lu:   ListUnsubscribe{Mailto: "unsub@example.com", OneClick: true},
+			err:  "URL is required",
+		},
+		{
+			name: "invalid URL",
+			lu:   ListUnsubscribe{URL: "javascript:alert(1)"},
+			err:  "must be a HTTP(S) URL",
+		},
+		{
+			name: "invalid mailto",
+			lu:   ListUnsubscribe{Mailto: "not an address"},
+			err:  "mailto address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := SendEmailMessage{ListUnsubscribe: &tt.lu}.CustomHeaders()
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, headers)
+		})
+	}
+
+	t.Run("conflicts with custom headers", func(t *testing.T) {
+		_, err := SendEmailMessage{
+			Headers:         map[string]string{"List-Unsubscribe": "<https://example.com>"},
+			ListUnsubscribe: &ListUnsubscribe{URL: "https://example.com/unsub"},
+		}.CustomHeaders()
+		require.ErrorContains(t, err, "cannot be set when ListUnsubscribe is set")
+	})
+}
+
+func TestIsScheduled(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.False(t, SendEmailMessage{}.IsScheduled(now))
+	assert.False(t, SendEmailMessage{SendAt: now.Add(-time.Minute)}.IsScheduled(now))
+	assert.True(t, SendEmailMessage{SendAt: now.Add(time.Hour)}.IsScheduled(now))
+}
@@ -0,0 +1,45 @@
+package emailer
+
+import (
+	"github.com/italypaleale/go-kit/emailer/awsses"
+	"github.com/italypaleale/go-kit/emailer/capture"
+	"github.com/italypaleale/go-kit/emailer/console"
+	"github.com/italypaleale/go-kit/emailer/sendgrid"
+	"github.com/italypaleale/go-kit/emailer/smtp"
+)
+
+// Middleware is a function that wraps an Emailer to add behaviors before or after messages are sent
+type Middleware func(next Emailer) Emailer
+
+// Use applies middlewares to the emailer
+// The last middleware in the list is the outermost one, so it's invoked first
+func Use(e Emailer, middlewares ...Middleware) Emailer {
+	for _, middleware := range middlewares {
+		e = middleware(e)
+	}
+	return e
+}
+
+// providerName returns the name of the provider used by the emailer, if known
+func providerName(e Emailer) string {
+	for {
+		switch v := e.(type) {
+		case *instrumentedEmailer:
+			return v.provider
+		case interface{ Unwrap() Emailer }:
+			e = v.Unwrap()
+		case *awsses.AWSSES:
+			return "awsses"
+		case *sendgrid.SendGridEmailer:
+			return "sendgrid"
+		case *smtp.SMTPEmailer:
+			return "smtp"
+		case *console.ConsoleEmailer:
+			return "console"
+		case *capture.CaptureEmailer:
+			return "capture"
+		default:
+			return ""
+		}
+	}
+}
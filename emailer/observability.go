@@ -0,0 +1,160 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+const (
+	instrumentationName = "github.com/italypaleale/go-kit/emailer"
+
+	attrProvider        = attribute.Key("emailer.provider")
+	attrOutcome         = attribute.Key("emailer.outcome")
+	attrRecipientDomain = attribute.Key("emailer.recipient_domain")
+
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// emailerMetrics contains the instruments used to track sent emails
+// When the app did not provide a meter, all instruments are no-op
+type emailerMetrics struct {
+	sent     metric.Int64Counter
+	failed   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newEmailerMetrics(meter metric.Meter) (*emailerMetrics, error) {
+	var (
+		m   emailerMetrics
+		err error
+	)
+
+	m.sent, err = meter.Int64Counter(
+		"emailer.sent",
+		metric.WithDescription("Number of emails sent successfully"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emailer.sent counter: %w", err)
+	}
+
+	m.failed, err = meter.Int64Counter(
+		"emailer.failed",
+		metric.WithDescription("Number of emails that could not be sent"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emailer.failed counter: %w", err)
+	}
+
+	m.duration, err = meter.Float64Histogram(
+		"emailer.send.duration",
+		metric.WithDescription("Time taken to send an email"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emailer.send.duration histogram: %w", err)
+	}
+
+	return &m, nil
+}
+
+// instrumentedEmailer wraps an Emailer to emit traces and metrics for each message sent
+type instrumentedEmailer struct {
+	inner    Emailer
+	provider string
+	tracer   trace.Tracer
+	metrics  *emailerMetrics
+}
+
+func newInstrumentedEmailer(inner Emailer, provider string, tracer trace.Tracer, metrics *emailerMetrics) *instrumentedEmailer {
+	return &instrumentedEmailer{
+		inner:    inner,
+		provider: provider,
+		tracer:   tracer,
+		metrics:  metrics,
+	}
+}
+
+// Init initializes the inner emailer.
+func (e *instrumentedEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	return e.inner.Init(ctx, opts)
+}
+
+// SendEmail sends the email with the inner emailer, recording a span and metrics.
+func (e *instrumentedEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message SendEmailMessage) error {
+	attrs := []attribute.KeyValue{
+		attrProvider.String(e.provider),
+		attrRecipientDomain.String(recipientDomain(toEmail)),
+	}
+
+	ctx, span := e.tracer.Start(ctx, "emailer.SendEmail",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := e.inner.SendEmail(ctx, toEmail, subject, message)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		attrs = append(attrs, attrOutcome.String(outcomeFailure))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		e.metrics.failed.Add(ctx, 1, metric.WithAttributes(attrs...))
+	} else {
+		attrs = append(attrs, attrOutcome.String(outcomeSuccess))
+		e.metrics.sent.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	span.SetAttributes(attrs[len(attrs)-1])
+	e.metrics.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attrs...))
+
+	return err
+}
+
+// Unwrap returns the inner Emailer.
+func (e *instrumentedEmailer) Unwrap() Emailer {
+	return e.inner
+}
+
+// Unwrap returns the provider-specific Emailer wrapped by the objects returned by NewEmailer.
+// This is useful to access methods of a specific implementation, such as the capture emailer's.
+// If e does not wrap another Emailer, it's returned as-is.
+func Unwrap(e Emailer) Emailer {
+	for {
+		u, ok := e.(interface{ Unwrap() Emailer })
+		if !ok {
+			return e
+		}
+		e = u.Unwrap()
+	}
+}
+
+// recipientDomain returns the lowercased domain of an email address, which is safe to use as an attribute with bounded cardinality
+func recipientDomain(addr string) string {
+	idx := strings.LastIndexByte(addr, '@')
+	if idx < 0 || idx == len(addr)-1 {
+		return "unknown"
+	}
+	return strings.ToLower(addr[idx+1:])
+}
+
+// getTracer returns the tracer from the given provider, or from the global one if nil
+func getTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}
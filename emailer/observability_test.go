@@ -0,0 +1,93 @@
+package emailer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/italypaleale/go-kit/emailer/capture"
+)
+
+func TestInstrumentedEmailer(t *testing.T) {
+	reader := sdkMetric.NewManualReader()
+	mp := sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader))
+	spans := tracetest.NewSpanRecorder()
+	tp := sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(spans))
+
+	e, err := NewEmailer(t.Context(), NewEmailerOpts{
+		ConnString:     "capture://",
+		Meter:          mp.Meter("test"),
+		TracerProvider: tp,
+	})
+	require.NoError(t, err)
+
+	captured, ok := Unwrap(e).(*capture.CaptureEmailer)
+	require.True(t, ok)
+
+	// Send one message successfully and make a second one fail
+	err = e.SendEmail(t.Context(), "someone@Example.com", "Hello", SendEmailMessage{Text: "Body"})
+	require.NoError(t, err)
+	captured.SetSendError(errors.New("simulated"))
+	err = e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{Text: "Body"})
+	require.Error(t, err)
+
+	// Verify the spans
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, "emailer.SendEmail", ended[0].Name())
+	assert.Contains(t, ended[0].Attributes(), attribute.String("emailer.provider", "capture"))
+	assert.Contains(t, ended[0].Attributes(), attribute.String("emailer.recipient_domain", "example.com"))
+	assert.Contains(t, ended[0].Attributes(), attribute.String("emailer.outcome", "success"))
+	assert.Contains(t, ended[1].Attributes(), attribute.String("emailer.outcome", "failure"))
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+
+	// Verify the metrics
+	var rm metricdata.ResourceMetrics
+	err = reader.Collect(t.Context(), &rm)
+	require.NoError(t, err)
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	found := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		found[m.Name] = m.Data
+	}
+
+	sent, ok := found["emailer.sent"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, sent.DataPoints, 1)
+	assert.Equal(t, int64(1), sent.DataPoints[0].Value)
+
+	failed, ok := found["emailer.failed"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, failed.DataPoints, 1)
+	assert.Equal(t, int64(1), failed.DataPoints[0].Value)
+
+	duration, ok := found["emailer.send.duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Len(t, duration.DataPoints, 2)
+}
+
+func TestNewEmailerDisableInstrumentation(t *testing.T) {
+	e, err := NewEmailer(t.Context(), NewEmailerOpts{
+		ConnString:             "capture://",
+		DisableInstrumentation: true,
+	})
+	require.NoError(t, err)
+
+	_, ok := e.(*capture.CaptureEmailer)
+	assert.True(t, ok)
+}
+
+func TestRecipientDomain(t *testing.T) {
+	assert.Equal(t, "example.com", recipientDomain("user@EXAMPLE.com"))
+	assert.Equal(t, "unknown", recipientDomain("invalid"))
+	assert.Equal(t, "unknown", recipientDomain("invalid@"))
+}
@@ -0,0 +1,209 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	kclock "k8s.io/utils/clock"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+	"github.com/italypaleale/go-kit/internal/ratelimit"
+)
+
+// Scopes for ThrottledError
+const (
+	ThrottleScopeProvider = "provider"
+	ThrottleScopeDomain   = "domain"
+)
+
+// Interval for removing domain limiters that are not in use
+const domainLimitersPruneInterval = time.Minute
+
+// RateLimit configures a token bucket
+// Events is the number of messages that can be sent in each Period
+type RateLimit = ratelimit.Limit
+
+// RateLimitOpts is the options struct for WithRateLimit
+type RateLimitOpts struct {
+	// Limit for the provider
+	PerProvider RateLimit
+	// Limit for each recipient domain
+	// Domain limits are shared by all emailers wrapped by the same middleware
+	PerDomain RateLimit
+
+	clock kclock.Clock
+}
+
+// ThrottledError is returned when a message is not sent because it would exceed a rate limit
+// Throttled messages can be sent again after RetryAfter
+type ThrottledError struct {
+	// Scope of the limit that was exceeded: ThrottleScopeProvider or ThrottleScopeDomain
+	Scope string
+	// Name of the provider or recipient domain
+	Key string
+	// Time after which a token is available
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s '%s'; retry after %v", e.Scope, e.Key, e.RetryAfter)
+}
+
+// sendState tracks the limits that were already applied to a message
+// The failover emailer adds it to the context, so sending the same message with another provider doesn't consume the domain token again
+type sendState struct {
+	domainReserved bool
+}
+
+type sendStateKey struct{}
+
+// withSendState returns a context that tracks the limits applied to a message across all the attempts to send it
+func withSendState(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sendStateKey{}, &sendState{})
+}
+
+// getSendState returns the sendState from the context, or nil if there's none
+func getSendState(ctx context.Context) *sendState {
+	s, _ := ctx.Value(sendStateKey{}).(*sendState)
+	return s
+}
+
+// WithRateLimit returns a Middleware that limits the rate at which messages are sent, using token buckets for the provider and for each recipient domain
+// Each emailer wrapped by the returned middleware gets its own provider limit; for example, when used with NewFailoverEmailerOpts.Middlewares, each provider is limited independently
+// Messages that exceed a limit are not queued; instead, SendEmail returns a *ThrottledError right away
+// Domain limits are applied once per message: when the failover emailer sends a message with another provider, it doesn't consume another token; and when a domain is throttled, the failover emailer doesn't try other providers
+func WithRateLimit(opts RateLimitOpts) Middleware {
+	if opts.clock == nil {
+		opts.clock = kclock.RealClock{}
+	}
+
+	var domains *domainLimiters
+	if opts.PerDomain.Events > 0 {
+		domains = &domainLimiters{
+			limit:    opts.PerDomain,
+			limiters: make(map[string]*rate.Limiter),
+		}
+	}
+
+	return func(next Emailer) Emailer {
+		e := &rateLimitedEmailer{
+			next:     next,
+			provider: providerName(next),
+			domains:  domains,
+			clock:    opts.clock,
+		}
+		if opts.PerProvider.Events > 0 {
+			e.providerLimiter = opts.PerProvider.NewLimiter()
+		}
+		return e
+	}
+}
+
+type rateLimitedEmailer struct {
+	next            Emailer
+	provider        string
+	providerLimiter *rate.Limiter
+	domains         *domainLimiters
+	clock           kclock.Clock
+}
+
+// Init initializes the inner emailer.
+func (e *rateLimitedEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	return e.next.Init(ctx, opts)
+}
+
+// SendEmail sends the email with the inner emailer if it doesn't exceed the rate limits.
+func (e *rateLimitedEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message SendEmailMessage) error {
+	now := e.clock.Now()
+
+	// Reserve the tokens first, so they can be returned if the other limit is exceeded
+	var providerRes *rate.Reservation
+	if e.providerLimiter != nil {
+		providerRes = e.providerLimiter.ReserveN(now, 1)
+		delay := providerRes.DelayFrom(now)
+		if delay > 0 {
+			providerRes.CancelAt(now)
+			return &ThrottledError{
+				Scope:      ThrottleScopeProvider,
+				Key:        e.provider,
+				RetryAfter: delay,
+			}
+		}
+	}
+
+	state := getSendState(ctx)
+	if e.domains != nil && (state == nil || !state.domainReserved) {
+		domain := recipientDomain(toEmail)
+		delay := e.domains.reserve(domain, now)
+		if delay > 0 {
+			if providerRes != nil {
+				providerRes.CancelAt(now)
+			}
+			return &ThrottledError{
+				Scope:      ThrottleScopeDomain,
+				Key:        domain,
+				RetryAfter: delay,
+			}
+		}
+		if state != nil {
+			state.domainReserved = true
+		}
+	}
+
+	return e.next.SendEmail(ctx, toEmail, subject, message)
+}
+
+// Unwrap returns the inner Emailer.
+func (e *rateLimitedEmailer) Unwrap() Emailer {
+	return e.next
+}
+
+// domainLimiters contains a limiter for each recipient domain
+type domainLimiters struct {
+	limit     RateLimit
+	limiters  map[string]*rate.Limiter
+	lastPrune time.Time
+	lock      sync.Mutex
+}
+
+// reserve takes a token for the domain
+// If no token is available, it returns the delay after which one will be
+func (d *domainLimiters) reserve(domain string, now time.Time) time.Duration {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.pruneIdle(now)
+
+	l, ok := d.limiters[domain]
+	if !ok {
+		l = d.limit.NewLimiter()
+		d.limiters[domain] = l
+	}
+
+	res := l.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		res.CancelAt(now)
+	}
+	return delay
+}
+
+// pruneIdle removes limiters whose bucket is full, so the map doesn't grow without bounds
+// These are equivalent to a newly-created limiter, so removing them doesn't change the behavior
+// This must be invoked while holding the lock
+func (d *domainLimiters) pruneIdle(now time.Time) {
+	if now.Sub(d.lastPrune) < domainLimitersPruneInterval {
+		return
+	}
+	d.lastPrune = now
+
+	for domain, l := range d.limiters {
+		if l.TokensAt(now) >= float64(l.Burst()) {
+			delete(d.limiters, domain)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package emailer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/italypaleale/go-kit/emailer/capture"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	t.Run("provider limit", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(time.Now())
+		captured := &capture.CaptureEmailer{}
+		e := Use(captured, WithRateLimit(RateLimitOpts{
+			PerProvider: RateLimit{Events: 2, Period: time.Minute},
+			clock:       clock,
+		}))
+
+		require.NoError(t, sendTestEmail(t, e))
+		require.NoError(t, sendTestEmail(t, e))
+
+		// The third message exceeds the burst
+		err := sendTestEmail(t, e)
+		var throttledErr *ThrottledError
+		require.ErrorAs(t, err, &throttledErr)
+		assert.Equal(t, ThrottleScopeProvider, throttledErr.Scope)
+		assert.Equal(t, "capture", throttledErr.Key)
+		assert.Equal(t, 30*time.Second, throttledErr.RetryAfter)
+		assert.False(t, IsPermanentError(err))
+		assert.Equal(t, 2, captured.Count())
+
+		// After the tokens are refilled, messages can be sent again
+		clock.Step(30 * time.Second)
+		require.NoError(t, sendTestEmail(t, e))
+	})
+
+	t.Run("domain limit", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(time.Now())
+		captured := &capture.CaptureEmailer{}
+		e := Use(captured, WithRateLimit(RateLimitOpts{
+			PerDomain: RateLimit{Events: 1, Period: time.Minute},
+			clock:     clock,
+		}))
+
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.com", "Hello", SendEmailMessage{Text: "Body"}))
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.org", "Hello", SendEmailMessage{Text: "Body"}))
+
+		err := e.SendEmail(t.Context(), "b@EXAMPLE.com", "Hello", SendEmailMessage{Text: "Body"})
+		var throttledErr *ThrottledError
+		require.ErrorAs(t, err, &throttledErr)
+		assert.Equal(t, ThrottleScopeDomain, throttledErr.Scope)
+		assert.Equal(t, "example.com", throttledErr.Key)
+	})
+
+	t.Run("provider token is returned when the domain is throttled", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(time.Now())
+		captured := &capture.CaptureEmailer{}
+		e := Use(captured, WithRateLimit(RateLimitOpts{
+			PerProvider: RateLimit{Events: 2, Period: time.Minute},
+			PerDomain:   RateLimit{Events: 1, Period: time.Minute},
+			clock:       clock,
+		}))
+
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.com", "Hello", SendEmailMessage{Text: "Body"}))
+		require.Error(t, e.SendEmail(t.Context(), "b@example.com", "Hello", SendEmailMessage{Text: "Body"}))
+
+		// The provider still has a token because the throttled message did not consume it
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.org", "Hello", SendEmailMessage{Text: "Body"}))
+	})
+
+	t.Run("idle domain limiters are pruned", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(time.Now())
+		mw := WithRateLimit(RateLimitOpts{
+			PerDomain: RateLimit{Events: 1, Period: time.Second},
+			clock:     clock,
+		})
+		e, ok := mw(&capture.CaptureEmailer{}).(*rateLimitedEmailer)
+		require.True(t, ok)
+
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.com", "Hello", SendEmailMessage{Text: "Body"}))
+		assert.Len(t, e.domains.limiters, 1)
+
+		clock.Step(2 * time.Minute)
+		require.NoError(t, e.SendEmail(t.Context(), "a@example.org", "Hello", SendEmailMessage{Text: "Body"}))
+		assert.Len(t, e.domains.limiters, 1)
+		assert.Contains(t, e.domains.limiters, "example.org")
+	})
+}
+
+func TestFailoverWithRateLimit(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+		Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		Middlewares: []Middleware{
+			WithRateLimit(RateLimitOpts{
+				PerProvider: RateLimit{Events: 1, Period: time.Minute},
+				clock:       clock,
+			}),
+		},
+		FailureThreshold: 1,
+	})
+
+	// Each provider has its own limit, so the second message is sent by the second provider
+	require.NoError(t, sendTestEmail(t, f))
+	require.NoError(t, sendTestEmail(t, f))
+	assert.Equal(t, 1, captured[0].Count())
+	assert.Equal(t, 1, captured[1].Count())
+
+	// When all providers are throttled, the error is returned
+	err := sendTestEmail(t, f)
+	var throttledErr *ThrottledError
+	require.ErrorAs(t, err, &throttledErr)
+
+	// Throttling does not make providers unhealthy
+	for _, p := range f.providers {
+		assert.Zero(t, p.consecutiveFailures)
+	}
+
+	// Other errors still make the provider unhealthy
+	captured[0].SetSendError(errors.New("simulated outage"))
+	clock.Step(time.Minute)
+	require.NoError(t, sendTestEmail(t, f))
+	assert.Equal(t, 1, f.providers[0].consecutiveFailures)
+}
+
+func TestFailoverWithDomainRateLimit(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	f, captured, _ := newTestFailoverEmailer(t, NewFailoverEmailerOpts{
+		Providers: []FailoverProvider{{ConnString: "capture://"}, {ConnString: "capture://"}},
+		Middlewares: []Middleware{
+			WithRateLimit(RateLimitOpts{
+				PerDomain: RateLimit{Events: 1, Period: time.Minute},
+				clock:     clock,
+			}),
+		},
+	})
+
+	// The first provider consumes the domain token and fails, but the second one can send the message without another token
+	captured[0].SetSendError(errors.New("simulated outage"))
+	require.NoError(t, sendTestEmail(t, f))
+	assert.Equal(t, 1, captured[1].Count())
+
+	// When the domain is throttled, the other providers are not tried
+	captured[0].SetSendError(nil)
+	err := sendTestEmail(t, f)
+	var throttledErr *ThrottledError
+	require.ErrorAs(t, err, &throttledErr)
+	assert.Equal(t, ThrottleScopeDomain, throttledErr.Scope)
+	assert.Equal(t, 0, captured[0].Count())
+	assert.Equal(t, 1, captured[1].Count())
+}
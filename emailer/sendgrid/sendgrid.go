@@ -12,6 +12,9 @@ import (
 	"github.com/italypaleale/go-kit/emailer/internal"
 )
 
+// SendGrid does not accept messages scheduled more than 72 hours in advance
+const maxSendAtDelay = 72 * time.Hour
+
 // SendGridEmailer is an Emailer that uses SendGrid.
 type SendGridEmailer struct {
 	apiKey     string
@@ -42,6 +45,11 @@ func (s *SendGridEmailer) Init(ctx context.Context, opts internal.InitOpts) erro
 		return fmt.Errorf("invalid connection string: %w; required format is '%s'", err, connStringFormat)
 	}
 
+	// Instrument outbound requests with OpenTelemetry unless a client was injected (e.g. by tests)
+	if s.httpClient == nil {
+		s.httpClient = internal.NewHTTPClient(opts)
+	}
+
 	return nil
 }
 
@@ -49,7 +57,15 @@ func (s *SendGridEmailer) Init(ctx context.Context, opts internal.InitOpts) erro
 func (s *SendGridEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message internal.SendEmailMessage) error {
 	err := internal.ValidateEmailAddress("recipient address", toEmail)
 	if err != nil {
-		return err
+		return internal.Permanent(err)
+	}
+	customHeaders, err := message.CustomHeaders()
+	if err != nil {
+		return internal.Permanent(err)
+	}
+	now := time.Now()
+	if message.IsScheduled(now) && message.SendAt.Sub(now) > maxSendAtDelay {
+		return internal.Permanent(fmt.Errorf("invalid send time: SendGrid does not allow scheduling messages more than %v in advance", maxSendAtDelay))
 	}
 
 	// Build the v3 mail/send content array with text/plain first, adding text/html only when present
@@ -64,9 +80,29 @@ func (s *SendGridEmailer) SendEmail(ctx context.Context, toEmail string, subject
 		Personalizations: []SendGridPersonalization{
 			{To: []SendGridEmail{{Address: toEmail}}},
 		},
-		From:    s.from,
-		Subject: subject,
-		Content: content,
+		From:       s.from,
+		Subject:    subject,
+		Content:    content,
+		Categories: message.Categories,
+		CustomArgs: message.Tags,
+	}
+	if len(customHeaders) > 0 {
+		body.Headers = make(map[string]string, len(customHeaders))
+		for _, h := range customHeaders {
+			body.Headers[h.Name] = h.Value
+		}
+	}
+	if message.IsScheduled(now) {
+		body.SendAt = message.SendAt.Unix()
+	}
+	if message.TrackOpens != nil || message.TrackClicks != nil {
+		body.TrackingSettings = &SendGridTrackingSettings{}
+		if message.TrackOpens != nil {
+			body.TrackingSettings.OpenTracking = &SendGridSetting{Enable: *message.TrackOpens}
+		}
+		if message.TrackClicks != nil {
+			body.TrackingSettings.ClickTracking = &SendGridSetting{Enable: *message.TrackClicks}
+		}
 	}
 
 	payload, err := json.Marshal(body)
@@ -102,7 +138,11 @@ func (s *SendGridEmailer) SendEmail(ctx context.Context, toEmail string, subject
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
-		return fmt.Errorf("failed to send email (%d): %s", resp.StatusCode, string(body))
+		err = fmt.Errorf("failed to send email (%d): %s", resp.StatusCode, string(body))
+		if internal.IsPermanentHTTPStatus(resp.StatusCode) {
+			return internal.Permanent(err)
+		}
+		return err
 	}
 
 	return nil
@@ -132,4 +172,21 @@ type SendGridMessage struct {
 	From             SendGridEmail             `json:"from"`
 	Subject          string                    `json:"subject"`
 	Content          []SendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	Categories       []string                  `json:"categories,omitempty"`
+	CustomArgs       map[string]string         `json:"custom_args,omitempty"`
+	SendAt           int64                     `json:"send_at,omitempty"`
+	TrackingSettings *SendGridTrackingSettings `json:"tracking_settings,omitempty"`
+}
+
+// SendGridTrackingSettings contains the per-message tracking settings
+// Settings that are nil use the values configured in the SendGrid account
+type SendGridTrackingSettings struct {
+	ClickTracking *SendGridSetting `json:"click_tracking,omitempty"`
+	OpenTracking  *SendGridSetting `json:"open_tracking,omitempty"`
+}
+
+// SendGridSetting is a setting that can be enabled or disabled
+type SendGridSetting struct {
+	Enable bool `json:"enable"`
 }
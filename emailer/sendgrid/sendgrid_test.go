@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -196,6 +197,103 @@ func TestSendEmailOmitsHTMLWhenEmpty(t *testing.T) {
 	assert.Equal(t, "text/plain", c0["type"])
 }
 
+func TestSendEmailMessageOptions(t *testing.T) {
+	e, rtt := newTestEmailer()
+	reqCh := make(chan *http.Request, 1)
+	resCh := make(chan *http.Response, 1)
+	rtt.SetReqCh(reqCh)
+	rtt.SetResponsesCh(resCh)
+	resCh <- httpResponse(t, http.StatusAccepted, "") //nolint:bodyclose
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	trackOpens := false
+	trackClicks := true
+	err := e.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+		Text:    "Plain body",
+		Headers: map[string]string{"X-Entity-Ref-ID": "abc123"},
+		ListUnsubscribe: &internal.ListUnsubscribe{
+			URL:      "https://example.com/unsub",
+			OneClick: true,
+		},
+		Categories:  []string{"welcome", "onboarding"},
+		Tags:        map[string]string{"campaign": "spring"},
+		TrackOpens:  &trackOpens,
+		TrackClicks: &trackClicks,
+		SendAt:      sendAt,
+	})
+	require.NoError(t, err)
+
+	req := <-reqCh
+	t.Cleanup(func() {
+		_ = req.Body.Close()
+	})
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+
+	var payload map[string]any
+	err = json.Unmarshal(body, &payload)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"X-Entity-Ref-Id":       "abc123",
+		"List-Unsubscribe":      "<https://example.com/unsub>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}, payload["headers"])
+	assert.Equal(t, []any{"welcome", "onboarding"}, payload["categories"])
+	assert.Equal(t, map[string]any{"campaign": "spring"}, payload["custom_args"])
+	assert.InDelta(t, float64(sendAt.Unix()), payload["send_at"], 0)
+	assert.Equal(t, map[string]any{
+		"open_tracking":  map[string]any{"enable": false},
+		"click_tracking": map[string]any{"enable": true},
+	}, payload["tracking_settings"])
+}
+
+func TestSendEmailOmitsUnsetMessageOptions(t *testing.T) {
+	e, rtt := newTestEmailer()
+	reqCh := make(chan *http.Request, 1)
+	resCh := make(chan *http.Response, 1)
+	rtt.SetReqCh(reqCh)
+	rtt.SetResponsesCh(resCh)
+	resCh <- httpResponse(t, http.StatusAccepted, "") //nolint:bodyclose
+
+	// A send time in the past means the message is sent right away
+	err := e.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+		Text:   "Plain body",
+		SendAt: time.Now().Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	req := <-reqCh
+	t.Cleanup(func() {
+		_ = req.Body.Close()
+	})
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+
+	var payload map[string]any
+	err = json.Unmarshal(body, &payload)
+	require.NoError(t, err)
+
+	for _, key := range []string{"headers", "categories", "custom_args", "send_at", "tracking_settings"} {
+		assert.NotContains(t, payload, key)
+	}
+}
+
+func TestSendEmailRejectsSendAtTooFarAhead(t *testing.T) {
+	e, rtt := newTestEmailer()
+	reqCh := make(chan *http.Request, 1)
+	rtt.SetReqCh(reqCh)
+
+	// SendGrid allows scheduling messages up to 72h in advance
+	err := e.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{
+		Text:   "Body",
+		SendAt: time.Now().Add(73 * time.Hour),
+	})
+	require.ErrorContains(t, err, "invalid send time")
+	assert.True(t, internal.IsPermanent(err))
+	assert.Empty(t, reqCh, "no request must be sent")
+}
+
 func TestSendEmailReturnsRemoteErrors(t *testing.T) {
 	e, rtt := newTestEmailer()
 	reqCh := make(chan *http.Request, 1)
@@ -209,4 +307,19 @@ func TestSendEmailReturnsRemoteErrors(t *testing.T) {
 	require.Error(t, err)
 	require.ErrorContains(t, err, "failed to send email (400):")
 	require.ErrorContains(t, err, "bad request")
+	assert.True(t, internal.IsPermanent(err), "400 responses must be permanent errors")
+}
+
+func TestSendEmailTransientErrors(t *testing.T) {
+	e, rtt := newTestEmailer()
+	reqCh := make(chan *http.Request, 1)
+	resCh := make(chan *http.Response, 1)
+	rtt.SetReqCh(reqCh)
+	rtt.SetResponsesCh(resCh)
+	// Errors that are specific to the provider, such as auth failures, allow trying with a different provider
+	resCh <- httpResponse(t, http.StatusUnauthorized, `{"errors":[{"message":"unauthorized"}]}`) //nolint:bodyclose
+
+	err := e.SendEmail(t.Context(), "recipient@example.com", "Hello", internal.SendEmailMessage{Text: "Body"})
+	require.ErrorContains(t, err, "failed to send email (401):")
+	assert.False(t, internal.IsPermanent(err))
 }
@@ -13,6 +13,7 @@ import (
 	stdsmtp "net/smtp"
 	"net/textproto"
 	"strings"
+	"time"
 
 	"github.com/italypaleale/go-kit/emailer/internal"
 )
@@ -124,10 +125,15 @@ func (s *SMTPEmailer) Init(_ context.Context, opts internal.InitOpts) error {
 
 // SendEmail sends a MIME email over SMTP using the configured auth and TLS mode
 func (s SMTPEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message internal.SendEmailMessage) error {
+	// SMTP delivers messages right away, so it can't honor a send time in the future
+	if message.IsScheduled(time.Now()) {
+		return internal.Permanent(internal.ErrScheduledSendingNotSupported)
+	}
+
 	// Build the MIME message first so transport errors are not mixed with formatting errors
 	payload, err := s.buildMessage(toEmail, subject, message)
 	if err != nil {
-		return fmt.Errorf("failed to build SMTP email: %w", err)
+		return internal.Permanent(fmt.Errorf("failed to build SMTP email: %w", err))
 	}
 
 	// Establish the network connection using the requested TLS mode
@@ -176,7 +182,7 @@ func (s SMTPEmailer) SendEmail(ctx context.Context, toEmail string, subject stri
 	}
 	err = client.Rcpt(toEmail)
 	if err != nil {
-		return fmt.Errorf("failed to set SMTP recipient: %w", err)
+		return permanentIfRejected(fmt.Errorf("failed to set SMTP recipient: %w", err))
 	}
 
 	// Write the message body as a DATA segment and close the writer to finalize the message
@@ -191,7 +197,7 @@ func (s SMTPEmailer) SendEmail(ctx context.Context, toEmail string, subject stri
 	}
 	err = writer.Close()
 	if err != nil {
-		return fmt.Errorf("failed to finalize SMTP message: %w", err)
+		return permanentIfRejected(fmt.Errorf("failed to finalize SMTP message: %w", err))
 	}
 
 	// Quit cleanly so the server can commit the message before the connection closes
@@ -218,6 +224,10 @@ func (s SMTPEmailer) buildMessage(toEmail string, subject string, message intern
 	if err != nil {
 		return nil, err
 	}
+	customHeaders, err := message.CustomHeaders()
+	if err != nil {
+		return nil, err
+	}
 
 	// Build the MIME body first because the top-level headers depend on whether the message is multipart
 	body, contentType, transferEncoding, err := buildMIMEBody(message)
@@ -239,6 +249,12 @@ func (s SMTPEmailer) buildMessage(toEmail string, subject string, message intern
 	if err != nil {
 		return nil, err
 	}
+	for _, h := range customHeaders {
+		_, err = fmt.Fprintf(&payload, "%s: %s\r\n", h.Name, encodeHeader(h.Value))
+		if err != nil {
+			return nil, err
+		}
+	}
 	_, err = payload.WriteString("MIME-Version: 1.0\r\n")
 	if err != nil {
 		return nil, err
@@ -394,6 +410,16 @@ func encodeBodyPart(value string) ([]byte, error) {
 	return body.Bytes(), nil
 }
 
+// permanentIfRejected marks err as permanent if it contains a 5xx SMTP reply, which indicates that the server rejected the recipient or the message
+// 4xx replies are transient failures and are returned as-is
+func permanentIfRejected(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return internal.Permanent(err)
+	}
+	return err
+}
+
 // validateHeaderValue rejects values containing CR or LF, which could otherwise inject additional SMTP headers or a second message body
 func validateHeaderValue(field string, value string) error {
 	if strings.ContainsAny(value, "\r\n") {
@@ -0,0 +1,163 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/go-kit/emailer/internal"
+)
+
+// SuppressionReason is the reason why an address is in the suppression list
+type SuppressionReason string
+
+const (
+	// SuppressionReasonBounce is used for addresses that hard-bounced
+	SuppressionReasonBounce SuppressionReason = "bounce"
+	// SuppressionReasonComplaint is used for addresses whose owners reported a message as spam
+	SuppressionReasonComplaint SuppressionReason = "complaint"
+	// SuppressionReasonUnsubscribe is used for addresses whose owners unsubscribed
+	SuppressionReasonUnsubscribe SuppressionReason = "unsubscribe"
+	// SuppressionReasonManual is used for addresses added to the list manually
+	SuppressionReasonManual SuppressionReason = "manual"
+)
+
+// SuppressionEntry is an address in the suppression list
+type SuppressionEntry struct {
+	// Address that is suppressed, normalized to lowercase
+	Address string
+	// Reason for the suppression
+	Reason SuppressionReason
+	// Time when the address was added to the list
+	CreatedAt time.Time
+}
+
+// SuppressionStore is the interface for stores that maintain the list of addresses that messages must not be sent to
+// Implementations must be safe for concurrent use; addresses are compared case-insensitively
+type SuppressionStore interface {
+	// GetSuppression returns the entry for the address if it's suppressed
+	// The returned boolean is false if the address is not in the list
+	GetSuppression(ctx context.Context, address string) (SuppressionEntry, bool, error)
+	// Suppress adds an address to the list, replacing any existing entry
+	Suppress(ctx context.Context, address string, reason SuppressionReason) error
+	// Unsuppress removes an address from the list
+	// It's not an error if the address is not in the list
+	Unsuppress(ctx context.Context, address string) error
+}
+
+// SuppressedError is returned when a message is not sent because the recipient is in the suppression list
+// It's always wrapped in a PermanentError
+type SuppressedError struct {
+	Entry SuppressionEntry
+}
+
+// Error implements the error interface
+func (e *SuppressedError) Error() string {
+	return fmt.Sprintf("recipient address '%s' is suppressed (reason: %s)", e.Entry.Address, e.Entry.Reason)
+}
+
+// WithSuppressionList returns a Middleware that refuses to send messages to addresses in the suppression store
+// When the recipient is suppressed, SendEmail returns a *SuppressedError (wrapped in a PermanentError)
+func WithSuppressionList(store SuppressionStore) Middleware {
+	return func(next Emailer) Emailer {
+		return &suppressionEmailer{
+			next:  next,
+			store: store,
+		}
+	}
+}
+
+type suppressionEmailer struct {
+	next  Emailer
+	store SuppressionStore
+}
+
+// Init initializes the inner emailer.
+func (e *suppressionEmailer) Init(ctx context.Context, opts internal.InitOpts) error {
+	return e.next.Init(ctx, opts)
+}
+
+// SendEmail sends the email with the inner emailer if the recipient is not suppressed.
+func (e *suppressionEmailer) SendEmail(ctx context.Context, toEmail string, subject string, message SendEmailMessage) error {
+	entry, suppressed, err := e.store.GetSuppression(ctx, toEmail)
+	if err != nil {
+		return fmt.Errorf("failed to check suppression list: %w", err)
+	}
+	if suppressed {
+		return internal.Permanent(&SuppressedError{Entry: entry})
+	}
+
+	return e.next.SendEmail(ctx, toEmail, subject, message)
+}
+
+// Unwrap returns the inner Emailer.
+func (e *suppressionEmailer) Unwrap() Emailer {
+	return e.next
+}
+
+// MemorySuppressionStore is a SuppressionStore that keeps the list in memory
+// The zero value is ready to use
+type MemorySuppressionStore struct {
+	lock    sync.RWMutex
+	entries map[string]SuppressionEntry
+}
+
+// NewMemorySuppressionStore returns a new MemorySuppressionStore.
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{}
+}
+
+// GetSuppression returns the entry for the address if it's suppressed.
+func (s *MemorySuppressionStore) GetSuppression(_ context.Context, address string) (SuppressionEntry, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entry, ok := s.entries[normalizeAddress(address)]
+	return entry, ok, nil
+}
+
+// Suppress adds an address to the list, replacing any existing entry.
+func (s *MemorySuppressionStore) Suppress(_ context.Context, address string, reason SuppressionReason) error {
+	address = normalizeAddress(address)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]SuppressionEntry)
+	}
+	s.entries[address] = SuppressionEntry{
+		Address:   address,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+// Unsuppress removes an address from the list.
+func (s *MemorySuppressionStore) Unsuppress(_ context.Context, address string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.entries, normalizeAddress(address))
+	return nil
+}
+
+// List returns all entries in the list, in no particular order.
+func (s *MemorySuppressionStore) List() []SuppressionEntry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	res := make([]SuppressionEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		res = append(res, e)
+	}
+	return res
+}
+
+// normalizeAddress returns the address in the form used as key in suppression lists
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,67 @@
+package emailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/go-kit/emailer/capture"
+)
+
+func TestWithSuppressionList(t *testing.T) {
+	store := NewMemorySuppressionStore()
+	require.NoError(t, store.Suppress(t.Context(), "Bounced@Example.com", SuppressionReasonBounce))
+
+	captured := &capture.CaptureEmailer{}
+	e := Use(captured, WithSuppressionList(store))
+
+	t.Run("suppressed recipients are rejected", func(t *testing.T) {
+		err := e.SendEmail(t.Context(), "bounced@example.com", "Hello", SendEmailMessage{Text: "Body"})
+		require.Error(t, err)
+		assert.True(t, IsPermanentError(err))
+
+		var suppressedErr *SuppressedError
+		require.ErrorAs(t, err, &suppressedErr)
+		assert.Equal(t, "bounced@example.com", suppressedErr.Entry.Address)
+		assert.Equal(t, SuppressionReasonBounce, suppressedErr.Entry.Reason)
+		assert.Equal(t, 0, captured.Count())
+	})
+
+	t.Run("other recipients are allowed", func(t *testing.T) {
+		err := e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{Text: "Body"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, captured.Count())
+	})
+
+	t.Run("unsuppressed recipients are allowed", func(t *testing.T) {
+		require.NoError(t, store.Unsuppress(t.Context(), "BOUNCED@example.com"))
+		err := e.SendEmail(t.Context(), "bounced@example.com", "Hello", SendEmailMessage{Text: "Body"})
+		require.NoError(t, err)
+		assert.Empty(t, store.List())
+	})
+
+	t.Run("unwrap returns the inner emailer", func(t *testing.T) {
+		assert.Same(t, captured, Unwrap(e))
+	})
+}
+
+func TestWithSuppressionListStoreError(t *testing.T) {
+	storeErr := errors.New("store unavailable")
+	e := Use(&capture.CaptureEmailer{}, WithSuppressionList(&failingSuppressionStore{err: storeErr}))
+
+	err := e.SendEmail(t.Context(), "someone@example.com", "Hello", SendEmailMessage{Text: "Body"})
+	require.ErrorIs(t, err, storeErr)
+	assert.False(t, IsPermanentError(err))
+}
+
+type failingSuppressionStore struct {
+	MemorySuppressionStore
+	err error
+}
+
+func (s *failingSuppressionStore) GetSuppression(_ context.Context, _ string) (SuppressionEntry, bool, error) {
+	return SuppressionEntry{}, false, s.err
+}
@@ -0,0 +1,118 @@
+package eventqueue
+
+import (
+	"slices"
+	"time"
+)
+
+const defaultBatchSize = 100
+
+// Moves the item r, which is due, from the queue to the batch that is being collected.
+func (p *Processor[K, T]) addToBatch(r T, now time.Time) {
+	p.lock.Lock()
+	// Like in execute, make sure the first item is the one we peeked at
+	peek, ok := p.queue.Peek()
+	if !ok || peek != r {
+		p.lock.Unlock()
+		return
+	}
+	item, ok := p.queue.PopItem()
+	if !ok {
+		p.lock.Unlock()
+		return
+	}
+
+	// If an item with the same key is already in the batch, it was enqueued again after it was popped: the newer item replaces it, so the older one is not executed
+	key := item.value.Key()
+	idx := slices.IndexFunc(p.batch, func(b *queueItem[K, T]) bool {
+		return b.value.Key() == key
+	})
+	if idx < 0 {
+		p.inflight++
+	}
+	p.lock.Unlock()
+
+	if idx >= 0 {
+		p.batch[idx] = item
+		return
+	}
+	if len(p.batch) == 0 {
+		p.batchStart = now
+	}
+	p.batch = append(p.batch, item)
+}
+
+// Returns true if the batch must be executed now, or else the time to wait before that.
+func (p *Processor[K, T]) batchReady(now time.Time) (bool, time.Duration) {
+	if len(p.batch) >= p.batchSize {
+		return true, 0
+	}
+	flushIn := p.batchStart.Add(p.batchMaxWait).Sub(now)
+	if flushIn < 500*time.Microsecond {
+		return true, 0
+	}
+	return false, flushIn
+}
+
+// Executes the items in the batch that is being collected.
+func (p *Processor[K, T]) flushBatch() {
+	batch := p.batch
+	p.batch = nil
+
+	// Items that are executed by other replicas are dropped, and items whose owner is unknown are kept and checked again later
+	execute := make([]*queueItem[K, T], 0, len(batch))
+	notOwned := make([]*queueItem[K, T], 0)
+	unknown := make([]*queueItem[K, T], 0)
+	for _, item := range batch {
+		switch p.ownership(item) {
+		case NotOwned:
+			notOwned = append(notOwned, item)
+		case OwnershipUnknown:
+			unknown = append(unknown, item)
+		default:
+			execute = append(execute, item)
+		}
+	}
+
+	var err error
+	if len(execute) > 0 {
+		err = p.runBatch(execute)
+	}
+
+	var deadLetters []T
+	p.lock.Lock()
+	for _, item := range notOwned {
+		p.complete(item, nil)
+	}
+	for _, item := range unknown {
+		p.complete(item, errOwnershipUnknown)
+	}
+	for _, item := range execute {
+		if p.complete(item, err) {
+			deadLetters = append(deadLetters, item.value)
+		}
+	}
+	p.lock.Unlock()
+
+	if p.deadLetterFn != nil {
+		for _, r := range deadLetters {
+			p.deadLetterFn(r, err)
+		}
+	}
+}
+
+// Invokes the batch executor, recording the execution in the metrics and tracing it.
+func (p *Processor[K, T]) runBatch(items []*queueItem[K, T]) error {
+	start := p.clock.Now()
+	values := make([]T, len(items))
+	for i, item := range items {
+		p.recordLag(start, item)
+		values[i] = item.value
+	}
+
+	ctx, span := p.startExecuteSpan(items...)
+	err := p.batchExecuteFn(ctx, values)
+	p.recordExecution(span, p.clock.Since(start).Seconds(), err)
+
+	return err
+}
@@ -0,0 +1,276 @@
+package eventqueue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestProcessorBatch(t *testing.T) {
+	newProcessor := func(t *testing.T, opts Options[string, *queueableItem]) (*Processor[string, *queueableItem], *clocktesting.FakeClock, chan []string) {
+		t.Helper()
+
+		clock := clocktesting.NewFakeClock(time.Now())
+		batchCh := make(chan []string, 10)
+		if opts.BatchExecuteFn == nil && opts.BatchExecuteContextFn == nil {
+			opts.BatchExecuteFn = func(rs []*queueableItem) error {
+				names := make([]string, len(rs))
+				for i, r := range rs {
+					names[i] = r.Name
+				}
+				batchCh <- names
+				return nil
+			}
+		}
+		opts.Clock = clock
+
+		processor := NewProcessor(opts)
+		t.Cleanup(func() {
+			processor.Close()
+		})
+		return processor, clock, batchCh
+	}
+
+	assertBatch := func(t *testing.T, batchCh chan []string, expect ...string) {
+		t.Helper()
+
+		select {
+		case names := <-batchCh:
+			assert.Equal(t, expect, names)
+		case <-time.After(time.Second):
+			t.Fatal("batch was not executed in 1s")
+		}
+	}
+
+	assertNoBatch := func(t *testing.T, batchCh chan []string) {
+		t.Helper()
+
+		select {
+		case names := <-batchCh:
+			t.Fatalf("batch was executed unexpectedly: %v", names)
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+	}
+
+	t.Run("batches are limited to BatchSize items", func(t *testing.T) {
+		processor, clock, batchCh := newProcessor(t, Options[string, *queueableItem]{
+			BatchSize: 3,
+		})
+
+		items := make([]*queueableItem, 5)
+		for i := range items {
+			items[i] = newTestItem(i+1, clock.Now())
+		}
+		require.NoError(t, processor.Enqueue(items...))
+
+		assertBatch(t, batchCh, "1", "2", "3")
+		assertBatch(t, batchCh, "4", "5")
+		assertNoBatch(t, batchCh)
+	})
+
+	t.Run("items owned by other replicas are dropped", func(t *testing.T) {
+		processor, clock, batchCh := newProcessor(t, Options[string, *queueableItem]{
+			Coordinator: CoordinatorFunc[string](func(key string) Ownership {
+				if key == "2" {
+					return Owned
+				}
+				return NotOwned
+			}),
+		})
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now()),
+			newTestItem(2, clock.Now()),
+			newTestItem(3, clock.Now()),
+		))
+		assertBatch(t, batchCh, "2")
+		assertNoBatch(t, batchCh)
+		assert.Equal(t, 0, processor.Count())
+	})
+
+	t.Run("items whose owner is unknown are checked again", func(t *testing.T) {
+		var ownsAll atomic.Bool
+		processor, clock, batchCh := newProcessor(t, Options[string, *queueableItem]{
+			Coordinator: CoordinatorFunc[string](func(key string) Ownership {
+				if ownsAll.Load() || key == "2" {
+					return Owned
+				}
+				return OwnershipUnknown
+			}),
+			CoordinatorRecheckInterval: time.Second,
+		})
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now()),
+			newTestItem(2, clock.Now()),
+			newTestItem(3, clock.Now()),
+		))
+		assertBatch(t, batchCh, "2")
+		assertNoBatch(t, batchCh)
+		assert.Equal(t, 2, processor.Count())
+
+		ownsAll.Store(true)
+		clock.Step(time.Second)
+		assertBatch(t, batchCh, "1", "3")
+	})
+
+	t.Run("items wait up to BatchMaxWait", func(t *testing.T) {
+		processor, clock, batchCh := newProcessor(t, Options[string, *queueableItem]{
+			BatchMaxWait: 10 * time.Second,
+		})
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now()),
+			newTestItem(2, clock.Now().Add(5*time.Second)),
+			newTestItem(3, clock.Now().Add(20*time.Second)),
+		))
+
+		// Item 2 joins the batch when it's due
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(5 * time.Second)
+		assertNoBatch(t, batchCh)
+
+		// The batch is executed 10s after item 1 was added to it
+		clock.Step(5 * time.Second)
+		assertBatch(t, batchCh, "1", "2")
+
+		// Item 3 waits for 10s too
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(10 * time.Second)
+		assertNoBatch(t, batchCh)
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(10 * time.Second)
+		assertBatch(t, batchCh, "3")
+		assert.Equal(t, 0, processor.Count())
+	})
+
+	t.Run("items enqueued again replace the older item in the batch", func(t *testing.T) {
+		executedCh := make(chan []*queueableItem, 10)
+		processor, clock, _ := newProcessor(t, Options[string, *queueableItem]{
+			BatchMaxWait: 10 * time.Second,
+			BatchExecuteFn: func(rs []*queueableItem) error {
+				executedCh <- rs
+				return nil
+			},
+		})
+
+		older := newTestItem(1, clock.Now())
+		require.NoError(t, processor.Enqueue(older))
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+
+		// The item is in the batch, so enqueueing it again adds a new item with the same key, which is due immediately
+		newer := newTestItem(1, clock.Now())
+		require.NoError(t, processor.Enqueue(newer))
+		assert.Eventually(t, func() bool {
+			return processor.Count() == 0
+		}, time.Second, 10*time.Millisecond)
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+
+		clock.Step(10 * time.Second)
+		select {
+		case rs := <-executedCh:
+			require.Len(t, rs, 1)
+			assert.Same(t, newer, rs[0])
+		case <-time.After(time.Second):
+			t.Fatal("batch was not executed in 1s")
+		}
+		assert.Equal(t, 0, processor.Count())
+	})
+
+	t.Run("context is passed to BatchExecuteContextFn", func(t *testing.T) {
+		startedCh := make(chan []string)
+		errCh := make(chan error, 1)
+		processor, clock, _ := newProcessor(t, Options[string, *queueableItem]{
+			BatchExecuteContextFn: func(ctx context.Context, rs []*queueableItem) error {
+				names := make([]string, len(rs))
+				for i, r := range rs {
+					names[i] = r.Name
+				}
+				startedCh <- names
+				<-ctx.Done()
+				errCh <- ctx.Err()
+				return nil
+			},
+		})
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now()),
+			newTestItem(2, clock.Now()),
+		))
+		select {
+		case names := <-startedCh:
+			assert.Equal(t, []string{"1", "2"}, names)
+		case <-time.After(time.Second):
+			t.Fatal("batch was not executed in 1s")
+		}
+
+		// The context is canceled when the processor is closed
+		require.NoError(t, processor.Close())
+		require.ErrorIs(t, <-errCh, context.Canceled)
+	})
+
+	t.Run("failed batches are retried", func(t *testing.T) {
+		var (
+			failed      = false
+			deadLetters = make(chan string, 10)
+		)
+		batchCh := make(chan []string, 10)
+		processor, clock, _ := newProcessor(t, Options[string, *queueableItem]{
+			BatchExecuteFn: func(rs []*queueableItem) error {
+				names := make([]string, len(rs))
+				for i, r := range rs {
+					names[i] = r.Name
+				}
+				batchCh <- names
+				if !failed {
+					failed = true
+					return errors.New("simulated")
+				}
+				return nil
+			},
+			RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Second},
+			DeadLetterFn: func(r *queueableItem, err error) {
+				deadLetters <- r.Name
+			},
+		})
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now()),
+			newTestItem(2, clock.Now()),
+		))
+		assertBatch(t, batchCh, "1", "2")
+
+		// Both items are retried together
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(time.Second)
+		assertBatch(t, batchCh, "1", "2")
+		assert.Empty(t, deadLetters)
+	})
+
+	t.Run("batches are rate-limited", func(t *testing.T) {
+		processor, clock, batchCh := newProcessor(t, Options[string, *queueableItem]{
+			BatchSize: 2,
+			RateLimit: &RateLimit{Events: 1, Period: time.Minute},
+		})
+
+		items := make([]*queueableItem, 4)
+		for i := range items {
+			items[i] = newTestItem(i+1, clock.Now())
+		}
+		require.NoError(t, processor.Enqueue(items...))
+
+		assertBatch(t, batchCh, "1", "2")
+		assertNoBatch(t, batchCh)
+
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(time.Minute)
+		assertBatch(t, batchCh, "3", "4")
+	})
+}
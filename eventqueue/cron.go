@@ -0,0 +1,245 @@
+package eventqueue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a Schedule based on a cron expression.
+type CronSchedule struct {
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// If true, both the day of month and day of week fields are restricted, and days matching either one are included
+	domOrDow bool
+	loc      *time.Location
+	expr     string
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Both 0 and 7 are Sunday
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression, whose times are evaluated in the given location (or UTC if nil).
+// The location can also be set in the expression with a "CRON_TZ=<time zone> " prefix, which takes precedence.
+// Expressions have 5 fields (minute, hour, day of month, month, day of week), or 6 if the first one is for seconds.
+// Fields support "*", lists ("1,2"), ranges ("1-5"), steps ("*/15", "0-30/10"), and names for months and days of week ("JAN", "MON").
+// The descriptors "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", and "@hourly" are supported too.
+func ParseCron(expr string, loc *time.Location) (*CronSchedule, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	expr = strings.TrimSpace(expr)
+	if tz, ok := strings.CutPrefix(expr, "CRON_TZ="); ok {
+		tz, expr, _ = strings.Cut(tz, " ")
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone '%s' in cron expression: %w", tz, err)
+		}
+		expr = strings.TrimSpace(expr)
+	}
+
+	s := &CronSchedule{loc: loc, expr: expr}
+	if strings.HasPrefix(expr, "@") {
+		d, ok := cronDescriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("invalid cron expression '%s': unknown descriptor", expr)
+		}
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+		// Nop
+	default:
+		return nil, fmt.Errorf("invalid cron expression '%s': must have 5 or 6 fields", expr)
+	}
+
+	var err error
+	parsed := []struct {
+		dest  *uint64
+		field cronField
+	}{
+		{&s.second, cronSecond},
+		{&s.minute, cronMinute},
+		{&s.hour, cronHour},
+		{&s.dom, cronDom},
+		{&s.month, cronMonth},
+		{&s.dow, cronDow},
+	}
+	for i, p := range parsed {
+		*p.dest, err = p.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+		}
+	}
+
+	// Sunday can be either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domOrDow = !strings.HasPrefix(fields[3], "*") && !strings.HasPrefix(fields[5], "*")
+
+	return s, nil
+}
+
+// Next implements Schedule.
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	// Start from the next second
+	t := after.In(s.loc).Truncate(time.Second).Add(time.Second)
+
+	// Give up if there are no matches within 8 years, which means the expression can never match (e.g. "0 0 30 2 *")
+	// Leap days can be up to 8 years apart, as years divisible by 100 but not by 400 (like 2100) are not leap years
+	limit := t.Year() + 8
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// String implements fmt.Stringer.
+func (s *CronSchedule) String() string {
+	if s.loc == time.UTC {
+		return s.expr
+	}
+	return "CRON_TZ=" + s.loc.String() + " " + s.expr
+}
+
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domOrDow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Parses a field in a cron expression, returning a bitmask of the values that match.
+func (f cronField) parse(value string) (uint64, error) {
+	var res uint64
+	for part := range strings.SplitSeq(value, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		var start, end int
+		switch {
+		case rng == "*":
+			start, end = f.min, f.max
+		case strings.Contains(rng, "-"):
+			startStr, endStr, _ := strings.Cut(rng, "-")
+			var err error
+			start, err = f.value(startStr)
+			if err != nil {
+				return 0, err
+			}
+			end, err = f.value(endStr)
+			if err != nil {
+				return 0, err
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range '%s' for %s", rng, f.name)
+			}
+		default:
+			var err error
+			start, err = f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			// "5/10" means starting at 5, every 10
+			if hasStep {
+				end = f.max
+			}
+		}
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s' for %s", stepStr, f.name)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			res |= 1 << uint(i)
+		}
+	}
+
+	return res, nil
+}
+
+// Parses a single value in a cron field, which can be a number or a name.
+func (f cronField) value(str string) (int, error) {
+	if str == "" {
+		return 0, errors.New("empty value for " + f.name)
+	}
+	if v, ok := f.names[strings.ToLower(str)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(str)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value '%s' for %s", str, f.name)
+	}
+	return v, nil
+}
@@ -0,0 +1,165 @@
+package eventqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	t.Run("invalid expressions", func(t *testing.T) {
+		for _, expr := range []string{
+			"",
+			"* * * *",
+			"* * * * * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 8",
+			"5-1 * * * *",
+			"*/0 * * * *",
+			"a * * * *",
+			"@often",
+			"CRON_TZ=Not/AZone * * * * *",
+		} {
+			_, err := ParseCron(expr, nil)
+			require.Error(t, err, expr)
+		}
+	})
+
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	after := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC) // Monday
+	tests := []struct {
+		expr   string
+		loc    *time.Location
+		expect []time.Time
+	}{
+		{
+			expr: "*/15 * * * *",
+			expect: []time.Time{
+				time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 11, 15, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "*/20 * * * * *",
+			expect: []time.Time{
+				time.Date(2024, 1, 1, 10, 30, 20, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 30, 40, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "0 9-17/4 * * MON-FRI",
+			expect: []time.Time{
+				time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "0 0 * * 7",
+			expect: []time.Time{
+				time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Day of month and day of week are both restricted, so either one matches
+			expr: "0 0 13 * FRI",
+			expect: []time.Time{
+				time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "0 0 29 feb *",
+			expect: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "@monthly",
+			expect: []time.Time{
+				time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			expr: "0 9 * * *",
+			loc:  rome,
+			expect: []time.Time{
+				time.Date(2024, 1, 2, 9, 0, 0, 0, rome),
+				time.Date(2024, 1, 3, 9, 0, 0, 0, rome),
+			},
+		},
+		{
+			expr: "CRON_TZ=Europe/Rome 0 12 * * *",
+			expect: []time.Time{
+				time.Date(2024, 1, 1, 12, 0, 0, 0, rome),
+				time.Date(2024, 1, 2, 12, 0, 0, 0, rome),
+			},
+		},
+		{
+			expr: "0 0 30 2 *",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, tt.loc)
+			require.NoError(t, err)
+
+			next := after
+			for _, expect := range tt.expect {
+				next = s.Next(next)
+				assert.True(t, expect.Equal(next), "expected %v, got %v", expect, next)
+			}
+			if len(tt.expect) == 0 {
+				assert.True(t, s.Next(after).IsZero())
+			}
+		})
+	}
+
+	t.Run("leap day across a century", func(t *testing.T) {
+		s, err := ParseCron("0 0 29 2 *", time.UTC)
+		require.NoError(t, err)
+
+		// 2100 is not a leap year, so the next leap day after 2096 is 8 years later
+		next := s.Next(time.Date(2096, 3, 1, 0, 0, 0, 0, time.UTC))
+		assert.True(t, time.Date(2104, 2, 29, 0, 0, 0, 0, time.UTC).Equal(next), "got %v", next)
+	})
+
+	t.Run("daylight saving time", func(t *testing.T) {
+		s, err := ParseCron("0 30 * * * *", rome)
+		require.NoError(t, err)
+
+		// On March 31, 2024, clocks in Rome moved from 02:00 to 03:00
+		next := s.Next(time.Date(2024, 3, 31, 1, 45, 0, 0, rome))
+		assert.True(t, time.Date(2024, 3, 31, 3, 30, 0, 0, rome).Equal(next), next)
+
+		// On October 27, 2024, clocks moved from 03:00 back to 02:00, so 02:30 happens twice
+		first := s.Next(time.Date(2024, 10, 27, 2, 0, 0, 0, rome))
+		second := s.Next(first)
+		third := s.Next(second)
+		assert.Equal(t, time.Hour, second.Sub(first))
+		assert.Equal(t, time.Hour, third.Sub(second))
+	})
+
+	t.Run("string", func(t *testing.T) {
+		s, err := ParseCron(" 0 9 * * MON ", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "0 9 * * MON", s.String())
+
+		s, err = ParseCron("@daily", rome)
+		require.NoError(t, err)
+		assert.Equal(t, "CRON_TZ=Europe/Rome @daily", s.String())
+	})
+}
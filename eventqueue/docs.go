@@ -1,5 +1,46 @@
 // Package eventqueue implements a queue processor for delayed events.
 // Events are maintained in an in-memory queue, where items are in the order of when they are to be executed.
+// Items that are due at the same time, or that are overdue, are executed in order of priority (for items that implement Prioritized) and then in the order they were enqueued.
 // Users should interact with the Processor to process events in the queue.
 // When the queue has at least 1 item, the processor uses a single background goroutine to wait on the next item to be executed.
+// By default, enqueueing an item replaces any item with the same key; EnqueueWithPolicy can keep the earliest or latest one, or merge them.
+//
+// # Persistence
+//
+// Changes to the queue can be recorded in a Store, so the queue can be rebuilt after a restart with NewPersistentProcessor.
+// FileStore is a Store that uses an append-only log file.
+//
+// # Retries
+//
+// Items executed with Options.ExecuteErrFn or Options.ExecuteContextFn that return an error are retried according to Options.RetryPolicy, and passed to Options.DeadLetterFn when no more attempts are left.
+//
+// # Workers
+//
+// By default, items are executed in the processing goroutine.
+// Options.Concurrency dispatches them to a bounded pool of workers instead; items with the same key are never executed concurrently.
+// Close stops the processor right away, canceling the context passed to the executor; Shutdown (or Run, as a servicerunner.Service) can drain the items that are due first.
+//
+// # Recurring items
+//
+// Items that implement Recurring are enqueued again after they're executed.
+// Schedules can be fixed intervals (Every), cron expressions (ParseCron), or ISO 8601 repeating intervals (ParseRepeatingInterval).
+//
+// # Coordination
+//
+// When multiple replicas have the same items, Options.Coordinator determines which replica executes each item.
+// Items can be sharded across replicas (HashRing) or executed by a leader (LeaderElector and LeaderOnly).
+// Replicas drop the items owned by other replicas, and keep the items whose owner is unknown (for example, while there's no leader), checking the coordinator again after Options.CoordinatorRecheckInterval.
+//
+// # Batching and rate limiting
+//
+// Options.BatchExecuteFn (or Options.BatchExecuteContextFn) receives due items in batches instead of one at a time.
+// Options.RateLimit caps how often the executor is invoked.
+//
+// # Backends
+//
+// Items are stored in a binary heap by default; for very large queues, Options.QueueBackend can select a hierarchical timing wheel instead.
+//
+// # Observability
+//
+// Processors can record metrics (Options.Meter) and trace each execution (Options.TracerProvider); items added with EnqueueContext are linked to the span that enqueued them.
 package eventqueue
@@ -0,0 +1,484 @@
+package eventqueue
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	fileStoreOpSave   byte = 'S'
+	fileStoreOpDelete byte = 'D'
+
+	// Size of the header of each record: 4 bytes for the length of the payload, and 4 for the CRC32 checksum
+	fileStoreHeaderSize = 8
+	// Maximum size of a record's payload
+	fileStoreMaxRecordSize = 64 << 20
+
+	defaultCompactThreshold = 1000
+)
+
+// ErrFileStoreClosed is returned when the FileStore is closed.
+var ErrFileStoreClosed = errors.New("file store is closed")
+
+// ErrFileStoreCorrupted is returned when opening a FileStore whose log file contains a corrupted record that is not the last one.
+var ErrFileStoreCorrupted = errors.New("log file is corrupted")
+
+// Returned when reading a record that is incomplete because it's the last one in the file, such as after a crash during a write.
+var errFileStoreTornRecord = errors.New("incomplete record at the end of the log file")
+
+// FileStoreOptions contains the options for NewFileStore.
+type FileStoreOptions struct {
+	// Path to the log file
+	// The file is created if it doesn't exist
+	Path string
+	// Codec used to serialize items and keys
+	// Defaults to JSONCodec
+	Codec Codec
+	// If true, does not invoke fsync after each write
+	// This is faster, but records may be lost if the system crashes
+	NoSync bool
+	// Number of obsolete records in the log after which the file is compacted
+	// Defaults to 1000
+	CompactThreshold int
+	// Optional function invoked when the log file can't be compacted after a change
+	// The change is still recorded in the log, and compaction is attempted again after the next change
+	// Defaults to otel.Handle
+	OnCompactError func(err error)
+}
+
+// FileStore is a Store that persists items in an append-only log file (write-ahead log).
+// Each change to the queue is appended to the file as a record; the file is compacted when it opens and when it contains too many obsolete records.
+// An incomplete or corrupted record at the end of the log, such as one caused by a crash during a write, is discarded; a corrupted record anywhere else causes NewFileStore to return ErrFileStoreCorrupted.
+// If a write fails, the log is truncated to remove the partial record; if that is not possible, all further changes are rejected.
+// Items are loaded in the order they were last saved, which is preserved when the file is compacted.
+type FileStore[K comparable, T Queueable[K]] struct {
+	path             string
+	codec            Codec
+	noSync           bool
+	compactThreshold int
+	onCompactError   func(err error)
+
+	lock sync.Mutex
+	file *os.File
+	// Size of the log file, which is where the next record is appended
+	size     int64
+	items    map[K]fileStoreItem[T]
+	obsolete int
+	// If set, the log file could not be restored after a failed write, and all further changes are rejected with this error
+	failed error
+	// Sequence number for the next item that is saved
+	seq uint64
+}
+
+// Item in a FileStore, with the sequence number that reflects the order in which items were saved.
+type fileStoreItem[T any] struct {
+	value T
+	seq   uint64
+}
+
+// NewFileStore returns a new FileStore, loading the existing items from the log file if present.
+func NewFileStore[K comparable, T Queueable[K]](opts FileStoreOptions) (*FileStore[K, T], error) {
+	if opts.Path == "" {
+		return nil, errors.New("option Path is required")
+	}
+
+	s := &FileStore[K, T]{
+		path:             opts.Path,
+		codec:            opts.Codec,
+		noSync:           opts.NoSync,
+		compactThreshold: opts.CompactThreshold,
+		onCompactError:   opts.OnCompactError,
+		items:            make(map[K]fileStoreItem[T]),
+	}
+	if s.codec == nil {
+		s.codec = JSONCodec{}
+	}
+	if s.compactThreshold <= 0 {
+		s.compactThreshold = defaultCompactThreshold
+	}
+	if s.onCompactError == nil {
+		s.onCompactError = otel.Handle
+	}
+
+	err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compact the file right away, which also removes any incomplete record at the end
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Save implements Store.
+// Errors compacting the log file are not returned, as the item was saved: they're reported to OnCompactError.
+func (s *FileStore[K, T]) Save(r T) error {
+	data, err := s.codec.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to serialize item: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err = s.append(fileStoreOpSave, data)
+	if err != nil {
+		return err
+	}
+
+	s.put(r)
+	s.maybeCompact()
+
+	return nil
+}
+
+// Delete implements Store.
+// Errors compacting the log file are not returned, as the deletion was recorded: they're reported to OnCompactError.
+func (s *FileStore[K, T]) Delete(key K) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return ErrFileStoreClosed
+	}
+
+	// If the item is not in the store, this is a nop
+	if _, ok := s.items[key]; !ok {
+		return nil
+	}
+
+	data, err := s.codec.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to serialize key: %w", err)
+	}
+
+	err = s.append(fileStoreOpDelete, data)
+	if err != nil {
+		return err
+	}
+
+	delete(s.items, key)
+	// Both the save and delete records are now obsolete
+	s.obsolete += 2
+	s.maybeCompact()
+
+	return nil
+}
+
+// Load implements Store.
+// Items are returned in the order they were last saved.
+func (s *FileStore[K, T]) Load() ([]T, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil, ErrFileStoreClosed
+	}
+
+	sorted := s.sortedItems()
+	res := make([]T, len(sorted))
+	for i, item := range sorted {
+		res[i] = item.value
+	}
+	return res, nil
+}
+
+// Adds or replaces an item, assigning it a new sequence number.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) put(r T) {
+	key := r.Key()
+	if _, ok := s.items[key]; ok {
+		s.obsolete++
+	}
+	s.items[key] = fileStoreItem[T]{value: r, seq: s.seq}
+	s.seq++
+}
+
+// Returns the items in the order they were saved.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) sortedItems() []fileStoreItem[T] {
+	res := make([]fileStoreItem[T], 0, len(s.items))
+	for _, item := range s.items {
+		res = append(res, item)
+	}
+	slices.SortFunc(res, func(a, b fileStoreItem[T]) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return res
+}
+
+// Close closes the log file.
+func (s *FileStore[K, T]) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Appends a record to the log file.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) append(op byte, data []byte) error {
+	if s.file == nil {
+		return ErrFileStoreClosed
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+
+	rec := encodeFileStoreRecord(op, data)
+	_, err := s.file.Write(rec)
+	if err != nil {
+		err = fmt.Errorf("failed to write to log file: %w", err)
+		s.rollback(err)
+		return err
+	}
+
+	if !s.noSync {
+		err = s.file.Sync()
+		if err != nil {
+			err = fmt.Errorf("failed to sync log file: %w", err)
+			s.rollback(err)
+			return err
+		}
+	}
+
+	s.size += int64(len(rec))
+	return nil
+}
+
+// Truncates the log file to its size before a failed append, so records appended later do not follow a partial one.
+// If the file cannot be truncated, the store is marked as failed and rejects all further changes.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) rollback(cause error) {
+	err := s.file.Truncate(s.size)
+	if err == nil {
+		_, err = s.file.Seek(s.size, io.SeekStart)
+	}
+	if err != nil {
+		s.failed = fmt.Errorf("log file could not be restored after a failed write: %w", errors.Join(cause, err))
+	}
+}
+
+// Compacts the log file if there are too many obsolete records.
+// Errors are reported to onCompactError; the log file is left unchanged, so compaction is attempted again after the next change.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) maybeCompact() {
+	if s.obsolete < s.compactThreshold || s.obsolete < len(s.items) {
+		return
+	}
+	err := s.compact()
+	if err != nil {
+		s.onCompactError(fmt.Errorf("failed to compact log file: %w", err))
+	}
+}
+
+// Rewrites the log file so it contains only the items currently in the store, in the order they were saved.
+// The new file is written to a temporary location and then renamed, so the log is never in an inconsistent state.
+// This must be invoked while the caller has a lock.
+func (s *FileStore[K, T]) compact() (err error) {
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	for _, item := range s.sortedItems() {
+		data, err := s.codec.Marshal(item.value)
+		if err != nil {
+			return fmt.Errorf("failed to serialize item: %w", err)
+		}
+		_, err = w.Write(encodeFileStoreRecord(fileStoreOpSave, data))
+		if err != nil {
+			return fmt.Errorf("failed to write to temporary file: %w", err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write to temporary file: %w", err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace log file: %w", err)
+	}
+	if !s.noSync {
+		syncDir(dir)
+	}
+
+	// The temporary file is now the log file; keep it open for appending
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek log file: %w", err)
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = tmp
+	s.size = size
+	s.obsolete = 0
+
+	return nil
+}
+
+// Reads the log file and rebuilds the list of items.
+func (s *FileStore[K, T]) replay() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		op, data, n, err := readFileStoreRecord(r)
+		switch {
+		case errors.Is(err, io.EOF):
+			// Reached the end of the file
+			return nil
+		case errors.Is(err, errFileStoreTornRecord):
+			// The last record is incomplete, as caused by a crash during a write
+			return nil
+		case errors.Is(err, ErrFileStoreCorrupted):
+			// Discarding a damaged record that is not the last one would silently lose all the records that follow
+			return fmt.Errorf("%w: invalid record at offset %d", err, offset)
+		case err != nil:
+			return fmt.Errorf("failed to read log file: %w", err)
+		}
+		offset += n
+
+		switch op {
+		case fileStoreOpSave:
+			var item T
+			err = s.codec.Unmarshal(data, &item)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize item: %w", err)
+			}
+			s.put(item)
+		case fileStoreOpDelete:
+			var key K
+			err = s.codec.Unmarshal(data, &key)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize key: %w", err)
+			}
+			delete(s.items, key)
+			s.obsolete += 2
+		default:
+			return fmt.Errorf("invalid record type '%c' in log file", op)
+		}
+	}
+}
+
+// Encodes a record: length of the payload, CRC32 checksum of the payload, and payload (operation followed by the data).
+func encodeFileStoreRecord(op byte, data []byte) []byte {
+	rec := make([]byte, fileStoreHeaderSize+1+len(data))
+	rec[fileStoreHeaderSize] = op
+	copy(rec[fileStoreHeaderSize+1:], data)
+	payload := rec[fileStoreHeaderSize:]
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload))) //nolint:gosec
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	return rec
+}
+
+// Reads the next record from the log, returning its size.
+// It returns io.EOF if there are no more records, errFileStoreTornRecord if the last record in the file is incomplete, and ErrFileStoreCorrupted if the record is damaged and it's not the last one.
+func readFileStoreRecord(r *bufio.Reader) (op byte, data []byte, n int64, err error) {
+	var header [fileStoreHeaderSize]byte
+	_, err = io.ReadFull(r, header[:])
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, nil, 0, errFileStoreTornRecord
+	} else if err != nil {
+		return 0, nil, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size == 0 || size > fileStoreMaxRecordSize {
+		return 0, nil, 0, damagedFileStoreRecord(r)
+	}
+
+	payload := make([]byte, size)
+	read, err := io.ReadFull(r, payload)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// The payload is shorter than the length in the header: this is a torn record, unless the length itself is damaged and the bytes that follow contain other records
+		if containsFileStoreRecord(payload[:read]) {
+			return 0, nil, 0, ErrFileStoreCorrupted
+		}
+		return 0, nil, 0, errFileStoreTornRecord
+	} else if err != nil {
+		return 0, nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, nil, 0, damagedFileStoreRecord(r)
+	}
+
+	return payload[0], payload[1:], fileStoreHeaderSize + int64(size), nil
+}
+
+// Returns the error for a record whose header or checksum is invalid: errFileStoreTornRecord if it's the last record in the file, and ErrFileStoreCorrupted otherwise.
+func damagedFileStoreRecord(r *bufio.Reader) error {
+	_, err := r.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return errFileStoreTornRecord
+	}
+	return ErrFileStoreCorrupted
+}
+
+// Returns true if buf contains a complete, valid record at any offset.
+func containsFileStoreRecord(buf []byte) bool {
+	for i := 0; i+fileStoreHeaderSize < len(buf); i++ {
+		size := int(binary.BigEndian.Uint32(buf[i : i+4]))
+		end := i + fileStoreHeaderSize + size
+		if size == 0 || end > len(buf) {
+			continue
+		}
+		if crc32.ChecksumIEEE(buf[i+fileStoreHeaderSize:end]) == binary.BigEndian.Uint32(buf[i+4:i+8]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Syncs a directory, to make sure a rename is durable.
+// Errors are ignored, as not all platforms support syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
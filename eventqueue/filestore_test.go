@@ -0,0 +1,251 @@
+package eventqueue
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	openStore := func(t *testing.T, opts FileStoreOptions) *FileStore[string, *queueableItem] {
+		t.Helper()
+		s, err := NewFileStore[string, *queueableItem](opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	}
+
+	loadNames := func(t *testing.T, s *FileStore[string, *queueableItem]) []string {
+		t.Helper()
+		items, err := s.Load()
+		require.NoError(t, err)
+		names := make([]string, len(items))
+		for i, r := range items {
+			names[i] = r.Name
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	t.Run("path is required", func(t *testing.T) {
+		_, err := NewFileStore[string, *queueableItem](FileStoreOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("items are recovered after reopening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+
+		s := openStore(t, FileStoreOptions{Path: path})
+		assert.Empty(t, loadNames(t, s))
+
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+		require.NoError(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now.Add(time.Minute)}))
+		require.NoError(t, s.Save(&queueableItem{Name: "c", ExecutionTime: now.Add(time.Hour)}))
+		require.NoError(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now.Add(2 * time.Minute)}))
+		require.NoError(t, s.Delete("c"))
+		require.NoError(t, s.Delete("not-found"))
+		assert.Equal(t, []string{"a", "b"}, loadNames(t, s))
+		require.NoError(t, s.Close())
+
+		s = openStore(t, FileStoreOptions{Path: path})
+		items, err := s.Load()
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		slices.SortFunc(items, func(a, b *queueableItem) int { return strings.Compare(a.Name, b.Name) })
+		assert.True(t, items[0].ExecutionTime.Equal(now))
+		assert.True(t, items[1].ExecutionTime.Equal(now.Add(2*time.Minute)))
+	})
+
+	t.Run("incomplete records at the end are discarded", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+
+		s := openStore(t, FileStoreOptions{Path: path})
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+		require.NoError(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now}))
+		require.NoError(t, s.Close())
+
+		// Truncate the last record, as if the process crashed during a write
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path, info.Size()-3))
+
+		s = openStore(t, FileStoreOptions{Path: path})
+		assert.Len(t, loadNames(t, s), 1)
+
+		// New records can be appended after the incomplete one was removed
+		require.NoError(t, s.Save(&queueableItem{Name: "c", ExecutionTime: now}))
+		require.NoError(t, s.Close())
+
+		s = openStore(t, FileStoreOptions{Path: path})
+		assert.Len(t, loadNames(t, s), 2)
+	})
+
+	t.Run("corrupted records in the middle are reported", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+
+		s := openStore(t, FileStoreOptions{Path: path})
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+		require.NoError(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now}))
+		require.NoError(t, s.Save(&queueableItem{Name: "c", ExecutionTime: now}))
+		require.NoError(t, s.Close())
+
+		// Flip a byte in the payload of the first record, so its checksum doesn't match
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[fileStoreHeaderSize+2] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		_, err = NewFileStore[string, *queueableItem](FileStoreOptions{Path: path})
+		require.ErrorIs(t, err, ErrFileStoreCorrupted)
+
+		// The log file is not compacted, so the records after the corrupted one are not lost
+		after, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, data, after)
+	})
+
+	t.Run("corrupted lengths in the middle are reported", func(t *testing.T) {
+		for name, size := range map[string]uint32{
+			"past the end of the file": 1 << 20,
+			"shorter":                  5,
+			"zero":                     0,
+		} {
+			t.Run(name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "queue.log")
+
+				s := openStore(t, FileStoreOptions{Path: path})
+				require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+				require.NoError(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now}))
+				require.NoError(t, s.Save(&queueableItem{Name: "c", ExecutionTime: now}))
+				require.NoError(t, s.Close())
+
+				// Change the length in the header of the first record
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				binary.BigEndian.PutUint32(data[0:4], size)
+				require.NoError(t, os.WriteFile(path, data, 0o600))
+
+				_, err = NewFileStore[string, *queueableItem](FileStoreOptions{Path: path})
+				require.ErrorIs(t, err, ErrFileStoreCorrupted)
+
+				after, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, data, after)
+			})
+		}
+	})
+
+	t.Run("store rejects changes if a failed write can't be rolled back", func(t *testing.T) {
+		s := openStore(t, FileStoreOptions{Path: filepath.Join(t.TempDir(), "queue.log")})
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+
+		// Closing the underlying file makes both the write and the truncation fail
+		require.NoError(t, s.file.Close())
+		err := s.Save(&queueableItem{Name: "b", ExecutionTime: now})
+		require.Error(t, err)
+		err = s.Delete("a")
+		require.ErrorContains(t, err, "log file could not be restored after a failed write")
+	})
+
+	t.Run("log is compacted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+
+		s := openStore(t, FileStoreOptions{Path: path, CompactThreshold: 10, NoSync: true})
+		require.NoError(t, s.Save(&queueableItem{Name: "keep", ExecutionTime: now}))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		singleSize := info.Size()
+
+		for range 20 {
+			require.NoError(t, s.Save(&queueableItem{Name: "tmp", ExecutionTime: now}))
+			require.NoError(t, s.Delete("tmp"))
+		}
+
+		info, err = os.Stat(path)
+		require.NoError(t, err)
+		assert.Less(t, info.Size(), 10*singleSize)
+		assert.Equal(t, []string{"keep"}, loadNames(t, s))
+
+		// No temporary files are left behind
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		require.NoError(t, s.Close())
+		s = openStore(t, FileStoreOptions{Path: path})
+		assert.Equal(t, []string{"keep"}, loadNames(t, s))
+	})
+
+	t.Run("items are loaded in the order they were saved", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "queue.log")
+		loadOrder := func(t *testing.T, s *FileStore[string, *queueableItem]) []string {
+			t.Helper()
+			items, err := s.Load()
+			require.NoError(t, err)
+			names := make([]string, len(items))
+			for i, r := range items {
+				names[i] = r.Name
+			}
+			return names
+		}
+
+		s := openStore(t, FileStoreOptions{Path: path, CompactThreshold: 1, NoSync: true})
+		for _, name := range []string{"e", "d", "c", "b", "a"} {
+			require.NoError(t, s.Save(&queueableItem{Name: name, ExecutionTime: now}))
+		}
+		// Saving an item again moves it to the end
+		require.NoError(t, s.Save(&queueableItem{Name: "d", ExecutionTime: now}))
+		require.NoError(t, s.Delete("b"))
+		expect := []string{"e", "c", "a", "d"}
+		assert.Equal(t, expect, loadOrder(t, s))
+		require.NoError(t, s.Close())
+
+		// The order is preserved after the file is compacted and reopened
+		s = openStore(t, FileStoreOptions{Path: path})
+		assert.Equal(t, expect, loadOrder(t, s))
+	})
+
+	t.Run("compaction errors are reported separately", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "data")
+		require.NoError(t, os.Mkdir(dir, 0o755))
+
+		var compactErrs []error
+		s := openStore(t, FileStoreOptions{
+			Path:             filepath.Join(dir, "queue.log"),
+			CompactThreshold: 1,
+			NoSync:           true,
+			OnCompactError: func(err error) {
+				compactErrs = append(compactErrs, err)
+			},
+		})
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+
+		// Removing the directory makes compaction fail, but the open log file can still be appended to
+		require.NoError(t, os.RemoveAll(dir))
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now.Add(time.Minute)}))
+		require.NoError(t, s.Delete("a"))
+		require.Len(t, compactErrs, 2)
+		require.ErrorContains(t, compactErrs[0], "failed to compact log file")
+		assert.Empty(t, loadNames(t, s))
+	})
+
+	t.Run("closed store returns errors", func(t *testing.T) {
+		s := openStore(t, FileStoreOptions{Path: filepath.Join(t.TempDir(), "queue.log")})
+		require.NoError(t, s.Save(&queueableItem{Name: "a", ExecutionTime: now}))
+		require.NoError(t, s.Close())
+
+		require.ErrorIs(t, s.Save(&queueableItem{Name: "b", ExecutionTime: now}), ErrFileStoreClosed)
+		require.ErrorIs(t, s.Delete("a"), ErrFileStoreClosed)
+		_, err := s.Load()
+		require.ErrorIs(t, err, ErrFileStoreClosed)
+	})
+}
@@ -0,0 +1,175 @@
+package eventqueue
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHashRingReplicas           = 128
+	defaultCoordinatorRecheckInterval = 5 * time.Second
+)
+
+// Returned by Processor.run when the coordinator can't determine which replica executes the item.
+var errOwnershipUnknown = errors.New("replica that executes the item is unknown")
+
+// Ownership is the result of Coordinator.Ownership.
+type Ownership int
+
+const (
+	// Owned means that the current replica executes the item.
+	Owned Ownership = iota
+	// NotOwned means that another replica executes the item.
+	// The item is removed from the queue as if it had been executed, and recurring items are rescheduled.
+	NotOwned
+	// OwnershipUnknown means that no replica can execute the item right now, for example while a leader's lease is expired.
+	// The item is kept in the queue (and in the store), and the coordinator is checked again after Options.CoordinatorRecheckInterval.
+	OwnershipUnknown
+)
+
+// Coordinator determines which replica executes each item, when multiple replicas of an application have a Processor with the same items.
+// Every replica must enqueue the same items (for example, because they're derived from shared state); when an item is due, it's executed only by the replica for which Ownership returns Owned.
+// Replicas for which Ownership returns NotOwned drop the item, so each replica only keeps the items it owns after they become due.
+// Items are lost if replicas temporarily disagree on the owner (for example, while the members of a HashRing change): when ownership changes, callers should enqueue again the items from the shared state that haven't been executed yet.
+// Replicas for which Ownership returns OwnershipUnknown keep the item and check again later; with LeaderOnly, this means that every follower keeps all items that are due, and checks them again periodically, so it can take over if the leader stops.
+type Coordinator[K comparable] interface {
+	// Ownership returns whether the current replica executes the item with the given key.
+	Ownership(key K) Ownership
+}
+
+// CoordinatorFunc is a function that implements Coordinator.
+type CoordinatorFunc[K comparable] func(key K) Ownership
+
+// Ownership implements Coordinator.
+func (fn CoordinatorFunc[K]) Ownership(key K) Ownership {
+	return fn(key)
+}
+
+// HashRingOptions contains the options for NewHashRing.
+type HashRingOptions[K comparable] struct {
+	// Name of the current replica
+	Self string
+	// Names of all replicas, including the current one
+	Members []string
+	// Number of virtual nodes for each member in the ring
+	// Defaults to 128
+	Replicas int
+	// Function that returns the string used to hash a key
+	// Defaults to fmt.Sprint
+	KeyFn func(key K) string
+}
+
+// HashRing is a Coordinator that shards items across replicas by key, using consistent hashing.
+// When the list of members changes, only a fraction of keys are assigned to a different replica.
+type HashRing[K comparable] struct {
+	self     string
+	replicas int
+	keyFn    func(key K) string
+
+	lock   sync.RWMutex
+	points []hashRingPoint
+}
+
+type hashRingPoint struct {
+	hash   uint64
+	member string
+}
+
+// NewHashRing returns a new HashRing.
+func NewHashRing[K comparable](opts HashRingOptions[K]) *HashRing[K] {
+	h := &HashRing[K]{
+		self:     opts.Self,
+		replicas: opts.Replicas,
+		keyFn:    opts.KeyFn,
+	}
+	if h.replicas <= 0 {
+		h.replicas = defaultHashRingReplicas
+	}
+	if h.keyFn == nil {
+		h.keyFn = func(key K) string {
+			return fmt.Sprint(key)
+		}
+	}
+	h.SetMembers(opts.Members)
+	return h
+}
+
+// SetMembers updates the list of replicas.
+func (h *HashRing[K]) SetMembers(members []string) {
+	points := make([]hashRingPoint, 0, len(members)*h.replicas)
+	for _, m := range members {
+		for i := range h.replicas {
+			points = append(points, hashRingPoint{
+				hash:   hashRingHash(m + "#" + strconv.Itoa(i)),
+				member: m,
+			})
+		}
+	}
+	slices.SortFunc(points, func(a, b hashRingPoint) int {
+		// Sort by member too, so the result is deterministic in case of collisions
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.member, b.member))
+	})
+
+	h.lock.Lock()
+	h.points = points
+	h.lock.Unlock()
+}
+
+// Owner returns the name of the replica that owns the key, or an empty string if there are no members.
+func (h *HashRing[K]) Owner(key K) string {
+	hash := hashRingHash(h.keyFn(key))
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if len(h.points) == 0 {
+		return ""
+	}
+
+	// Find the first point after the key's hash, wrapping around the ring
+	i, _ := slices.BinarySearchFunc(h.points, hash, func(p hashRingPoint, hash uint64) int {
+		return cmp.Compare(p.hash, hash)
+	})
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.points[i].member
+}
+
+// ShouldExecute returns true if the current replica owns the key.
+func (h *HashRing[K]) ShouldExecute(key K) bool {
+	return h.Owner(key) == h.self
+}
+
+// Ownership implements Coordinator.
+// It returns OwnershipUnknown if the ring has no members.
+func (h *HashRing[K]) Ownership(key K) Ownership {
+	switch h.Owner(key) {
+	case h.self:
+		return Owned
+	case "":
+		return OwnershipUnknown
+	default:
+		return NotOwned
+	}
+}
+
+func hashRingHash(s string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(s))
+	h := hash.Sum64()
+
+	// FNV doesn't distribute similar inputs (such as "member#1" and "member#2") well, so apply a finalizer (from MurmurHash3)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
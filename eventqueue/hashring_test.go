@@ -0,0 +1,133 @@
+package eventqueue
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestHashRing(t *testing.T) {
+	members := []string{"replica-0", "replica-1", "replica-2"}
+
+	t.Run("keys are distributed across members", func(t *testing.T) {
+		ring := NewHashRing(HashRingOptions[string]{Self: "replica-0", Members: members})
+
+		counts := map[string]int{}
+		for i := range 3000 {
+			counts[ring.Owner("key-"+strconv.Itoa(i))]++
+		}
+		require.Len(t, counts, 3)
+		for m, c := range counts {
+			assert.Greater(t, c, 700, m)
+			assert.Less(t, c, 1300, m)
+		}
+	})
+
+	t.Run("owner is deterministic across replicas", func(t *testing.T) {
+		rings := make([]*HashRing[int], len(members))
+		for i, m := range members {
+			rings[i] = NewHashRing(HashRingOptions[int]{Self: m, Members: members})
+		}
+
+		for key := range 100 {
+			executing := 0
+			for _, r := range rings {
+				assert.Equal(t, rings[0].Owner(key), r.Owner(key))
+				if r.ShouldExecute(key) {
+					executing++
+				}
+			}
+			assert.Equal(t, 1, executing)
+		}
+	})
+
+	t.Run("few keys move when members change", func(t *testing.T) {
+		ring := NewHashRing(HashRingOptions[string]{Self: "replica-0", Members: members})
+		before := map[string]string{}
+		for i := range 1000 {
+			key := "key-" + strconv.Itoa(i)
+			before[key] = ring.Owner(key)
+		}
+
+		ring.SetMembers(append(members, "replica-3"))
+		moved := 0
+		for key, owner := range before {
+			newOwner := ring.Owner(key)
+			if newOwner != owner {
+				// Keys can only move to the new member
+				assert.Equal(t, "replica-3", newOwner)
+				moved++
+			}
+		}
+		assert.Greater(t, moved, 100)
+		assert.Less(t, moved, 400)
+	})
+
+	t.Run("no members", func(t *testing.T) {
+		ring := NewHashRing(HashRingOptions[string]{Self: "replica-0"})
+		assert.Empty(t, ring.Owner("key"))
+		assert.False(t, ring.ShouldExecute("key"))
+		assert.Equal(t, OwnershipUnknown, ring.Ownership("key"))
+	})
+}
+
+func TestProcessorCoordinator(t *testing.T) {
+	members := []string{"replica-0", "replica-1", "replica-2"}
+	clock := clocktesting.NewFakeClock(time.Now())
+
+	var (
+		lock     sync.Mutex
+		executed = map[string][]string{}
+	)
+	processors := make([]*Processor[string, *queueableItem], len(members))
+	for i, m := range members {
+		processors[i] = NewProcessor(Options[string, *queueableItem]{
+			ExecuteFn: func(r *queueableItem) {
+				lock.Lock()
+				executed[r.Name] = append(executed[r.Name], m)
+				lock.Unlock()
+			},
+			Coordinator: NewHashRing(HashRingOptions[string]{Self: m, Members: members}),
+			Clock:       clock,
+		})
+		defer processors[i].Close()
+	}
+
+	// Every replica enqueues the same items
+	for _, p := range processors {
+		for n := range 30 {
+			require.NoError(t, p.Enqueue(newTestItem(n, clock.Now())))
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(executed) == 30
+	}, time.Second, 10*time.Millisecond)
+
+	// Items owned by other replicas are dropped
+	assert.Eventually(t, func() bool {
+		for _, p := range processors {
+			if p.Count() > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, executed, 30)
+	replicas := map[string]bool{}
+	for name, by := range executed {
+		require.Len(t, by, 1, name)
+		replicas[by[0]] = true
+	}
+	assert.Len(t, replicas, 3)
+}
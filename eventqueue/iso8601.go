@@ -0,0 +1,185 @@
+package eventqueue
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseRepeatingInterval parses an ISO 8601 repeating interval, returning the Recurrence and the time of the first occurrence.
+// The supported formats are:
+//
+//   - "R[n]/<start>/<duration>": occurrences at start, start+duration, etc.
+//   - "R[n]/<start>/<end>": occurrences at start, with the interval being the time between start and end
+//   - "R[n]/<duration>": occurrences at now, now+duration, etc.
+//
+// The "R[n]/<duration>/<end>" form is not supported, and returns an error: in ISO 8601 its occurrences are counted backwards from end, which doesn't map to a schedule that starts now.
+// To stop a schedule at a given time, set Recurrence.EndTime.
+// Times are in RFC 3339 format, and durations in the ISO 8601 format (e.g. "P1DT12H").
+// If set, n is the total number of times the item is executed; if omitted, there's no limit.
+func ParseRepeatingInterval(value string, now time.Time) (Recurrence, time.Time, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(parts[0], "R") {
+		return Recurrence{}, time.Time{}, fmt.Errorf("invalid repeating interval '%s'", value)
+	}
+
+	var rec Recurrence
+	if parts[0] != "R" {
+		n, err := strconv.Atoi(parts[0][1:])
+		if err != nil || n <= 0 {
+			return Recurrence{}, time.Time{}, fmt.Errorf("invalid repeating interval '%s': number of repetitions must be a positive integer", value)
+		}
+		rec.MaxRepetitions = n
+	}
+
+	var (
+		start time.Time
+		dur   isoDuration
+		err   error
+	)
+	switch {
+	case len(parts) == 2:
+		start = now
+		dur, err = parseISODuration(parts[1])
+	case strings.HasPrefix(parts[1], "P"):
+		err = errors.New("the '<duration>/<end>' form is not supported")
+	default:
+		start, err = time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			break
+		}
+		if strings.HasPrefix(parts[2], "P") {
+			dur, err = parseISODuration(parts[2])
+			break
+		}
+		var end time.Time
+		end, err = time.Parse(time.RFC3339Nano, parts[2])
+		if err == nil && !end.After(start) {
+			err = errors.New("end must be after start")
+		}
+		dur = isoDuration{clock: end.Sub(start)}
+	}
+	if err != nil {
+		return Recurrence{}, time.Time{}, fmt.Errorf("invalid repeating interval '%s': %w", value, err)
+	}
+
+	rec.Schedule = isoSchedule{start: start, dur: dur}
+	return rec, start, nil
+}
+
+// isoDuration is a duration in the ISO 8601 format, which can contain calendar units.
+type isoDuration struct {
+	years  int
+	months int
+	days   int
+	clock  time.Duration
+}
+
+func parseISODuration(value string) (isoDuration, error) {
+	match := isoDurationRegex.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return isoDuration{}, fmt.Errorf("invalid duration '%s'", value)
+	}
+
+	num := func(i int) int {
+		// Errors can be ignored because the regular expression only matches digits
+		n, _ := strconv.Atoi(match[i])
+		return n
+	}
+
+	d := isoDuration{
+		years:  num(1),
+		months: num(2),
+		days:   num(3)*7 + num(4),
+		clock:  time.Duration(num(5))*time.Hour + time.Duration(num(6))*time.Minute,
+	}
+	if match[7] != "" {
+		secs, _ := strconv.ParseFloat(match[7], 64)
+		d.clock += time.Duration(secs * float64(time.Second))
+	}
+
+	if d.years == 0 && d.months == 0 && d.days == 0 && d.clock == 0 {
+		return isoDuration{}, fmt.Errorf("invalid duration '%s': must be greater than 0", value)
+	}
+	return d, nil
+}
+
+// String returns the duration in the ISO 8601 format.
+func (d isoDuration) String() string {
+	var sb strings.Builder
+	sb.WriteString("P")
+	if d.years > 0 {
+		sb.WriteString(strconv.Itoa(d.years) + "Y")
+	}
+	if d.months > 0 {
+		sb.WriteString(strconv.Itoa(d.months) + "M")
+	}
+	if d.days > 0 {
+		sb.WriteString(strconv.Itoa(d.days) + "D")
+	}
+	if d.clock > 0 {
+		sb.WriteString("T")
+		h := d.clock / time.Hour
+		m := (d.clock % time.Hour) / time.Minute
+		sec := d.clock % time.Minute
+		if h > 0 {
+			sb.WriteString(strconv.FormatInt(int64(h), 10) + "H")
+		}
+		if m > 0 {
+			sb.WriteString(strconv.FormatInt(int64(m), 10) + "M")
+		}
+		if sec > 0 {
+			sb.WriteString(strconv.FormatFloat(sec.Seconds(), 'f', -1, 64) + "S")
+		}
+	}
+	return sb.String()
+}
+
+// Returns the approximate length of the duration.
+func (d isoDuration) approx() time.Duration {
+	const day = 24 * time.Hour
+	return time.Duration(d.years)*(365*day+day/4) +
+		time.Duration(d.months)*(30*day+day/2) +
+		time.Duration(d.days)*day +
+		d.clock
+}
+
+// isoSchedule is a Schedule with occurrences at start plus multiples of an ISO 8601 duration.
+type isoSchedule struct {
+	start time.Time
+	dur   isoDuration
+}
+
+// Next implements Schedule.
+func (s isoSchedule) Next(after time.Time) time.Time {
+	if after.Before(s.start) {
+		return s.start
+	}
+
+	// Start from an estimate of the number of occurrences, then adjust it
+	k := int(after.Sub(s.start) / s.dur.approx())
+	for k > 0 && s.occurrence(k-1).After(after) {
+		k--
+	}
+	for !s.occurrence(k).After(after) {
+		k++
+	}
+	return s.occurrence(k)
+}
+
+// String implements fmt.Stringer.
+func (s isoSchedule) String() string {
+	return "R/" + s.start.Format(time.RFC3339Nano) + "/" + s.dur.String()
+}
+
+// Returns the k-th occurrence.
+func (s isoSchedule) occurrence(k int) time.Time {
+	return s.start.
+		AddDate(k*s.dur.years, k*s.dur.months, k*s.dur.days).
+		Add(time.Duration(k) * s.dur.clock)
+}
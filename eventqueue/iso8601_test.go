@@ -0,0 +1,90 @@
+package eventqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepeatingInterval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, value := range []string{
+			"",
+			"P1D",
+			"R",
+			"R0/P1D",
+			"Rx/P1D",
+			"R/P",
+			"R/PT",
+			"R/P0D",
+			"R/1D",
+			"R/2024-01-01T00:00:00Z",
+			"R/2024-01-01T00:00:00Z/2023-01-01T00:00:00Z",
+			"R/P1D/P1D",
+			// Repeating intervals anchored on the end are not supported
+			"R/PT10M/2024-01-02T00:00:00Z",
+			"R3/P1D/2024-01-02T00:00:00Z",
+			"R/P1D/2024-01-01T00:00:00Z/P1D",
+		} {
+			_, _, err := ParseRepeatingInterval(value, now)
+			require.Error(t, err, value)
+		}
+	})
+
+	tests := []struct {
+		value    string
+		first    time.Time
+		next     []time.Time
+		maxReps  int
+		schedule string
+	}{
+		{
+			value:    "R5/2024-01-31T10:00:00Z/P1M",
+			first:    time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC),
+			next:     []time.Time{time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 10, 0, 0, 0, time.UTC)},
+			maxReps:  5,
+			schedule: "R/2024-01-31T10:00:00Z/P1M",
+		},
+		{
+			value:    "R/P1W2DT1H30M0.5S",
+			first:    now,
+			next:     []time.Time{now.Add(9*24*time.Hour + 90*time.Minute + 500*time.Millisecond)},
+			schedule: "R/2024-01-01T12:00:00Z/P9DT1H30M0.5S",
+		},
+		{
+			value:    "R3/2024-01-01T00:00:00Z/2024-01-01T06:00:00Z",
+			first:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			next:     []time.Time{time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+			maxReps:  3,
+			schedule: "R/2024-01-01T00:00:00Z/PT6H",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rec, first, err := ParseRepeatingInterval(tt.value, now)
+			require.NoError(t, err)
+			assert.True(t, tt.first.Equal(first))
+			assert.Equal(t, tt.maxReps, rec.MaxRepetitions)
+			assert.True(t, rec.EndTime.IsZero())
+			assert.Equal(t, tt.schedule, rec.Schedule.(isoSchedule).String())
+
+			next := first
+			for _, expect := range tt.next {
+				next = rec.Schedule.Next(next)
+				assert.True(t, expect.Equal(next), "expected %v, got %v", expect, next)
+			}
+		})
+	}
+
+	t.Run("occurrences far from the start", func(t *testing.T) {
+		rec, _, err := ParseRepeatingInterval("R/2020-01-31T00:00:00Z/P1M", now)
+		require.NoError(t, err)
+		next := rec.Schedule.Next(time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC))
+		// The 49th occurrence is 2020-01-31 plus 49 months
+		assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), next)
+	})
+}
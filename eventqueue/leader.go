@@ -0,0 +1,216 @@
+package eventqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kclock "k8s.io/utils/clock"
+)
+
+const defaultLeaderTTL = 15 * time.Second
+
+// Lock is a distributed lock with a TTL, used for leader election.
+type Lock interface {
+	// TryAcquire attempts to acquire the lock for owner, or to renew it if owner already holds it.
+	// The lock is held until ttl elapses, unless it's renewed.
+	// Returns true if owner holds the lock.
+	TryAcquire(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	// Release releases the lock, if it's held by owner.
+	Release(ctx context.Context, owner string) error
+}
+
+// LocalLock is a Lock that works within a single process, which is useful for testing.
+type LocalLock struct {
+	clock   kclock.Clock
+	lock    sync.Mutex
+	owner   string
+	expires time.Time
+}
+
+// NewLocalLock returns a new LocalLock.
+// If clock is nil, the real clock is used.
+func NewLocalLock(clock kclock.Clock) *LocalLock {
+	if clock == nil {
+		clock = kclock.RealClock{}
+	}
+	return &LocalLock{clock: clock}
+}
+
+// TryAcquire implements Lock.
+func (l *LocalLock) TryAcquire(_ context.Context, owner string, ttl time.Duration) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.clock.Now()
+	if l.owner != "" && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+
+	l.owner = owner
+	l.expires = now.Add(ttl)
+	return true, nil
+}
+
+// Release implements Lock.
+func (l *LocalLock) Release(_ context.Context, owner string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.owner == owner {
+		l.owner = ""
+		l.expires = time.Time{}
+	}
+	return nil
+}
+
+// LeaderElectorOptions contains the options for NewLeaderElector.
+type LeaderElectorOptions struct {
+	// Lock used for the election
+	Lock Lock
+	// Unique identifier of the current replica
+	ID string
+	// Duration of the lock
+	// If the leader doesn't renew the lock within this time, another replica can become the leader
+	// Defaults to 15s
+	TTL time.Duration
+	// Interval at which the lock is acquired or renewed
+	// Defaults to a third of the TTL
+	RenewInterval time.Duration
+	// Optional callback invoked when the current replica becomes the leader or stops being the leader
+	OnLeadershipChange func(isLeader bool)
+	Clock              kclock.Clock
+}
+
+// LeaderElector elects a leader among replicas using a Lock.
+// Use LeaderOnly to create a Coordinator that executes items only on the leader.
+type LeaderElector struct {
+	lock          Lock
+	id            string
+	ttl           time.Duration
+	renewInterval time.Duration
+	onChange      func(isLeader bool)
+	clock         kclock.Clock
+
+	// Time until which the current replica is the leader, as nanoseconds since the Unix epoch; 0 if it's not the leader
+	leaseExpiry atomic.Int64
+	running     atomic.Bool
+	// Last leadership state reported to onChange; only accessed by the goroutine executing Run
+	reported bool
+}
+
+// NewLeaderElector returns a new LeaderElector.
+// Run must be invoked to participate in the election.
+func NewLeaderElector(opts LeaderElectorOptions) (*LeaderElector, error) {
+	if opts.Lock == nil {
+		return nil, errors.New("option Lock is required")
+	}
+	if opts.ID == "" {
+		return nil, errors.New("option ID is required")
+	}
+
+	le := &LeaderElector{
+		lock:          opts.Lock,
+		id:            opts.ID,
+		ttl:           opts.TTL,
+		renewInterval: opts.RenewInterval,
+		onChange:      opts.OnLeadershipChange,
+		clock:         opts.Clock,
+	}
+	if le.ttl <= 0 {
+		le.ttl = defaultLeaderTTL
+	}
+	if le.renewInterval <= 0 {
+		le.renewInterval = le.ttl / 3
+	}
+	if le.renewInterval >= le.ttl {
+		return nil, errors.New("option RenewInterval must be less than TTL")
+	}
+	if le.clock == nil {
+		le.clock = kclock.RealClock{}
+	}
+
+	return le, nil
+}
+
+// Run participates in the election until the context is canceled, then releases the lock if held.
+// It can be used as a servicerunner.Service.
+func (le *LeaderElector) Run(ctx context.Context) error {
+	if !le.running.CompareAndSwap(false, true) {
+		return errors.New("leader elector is already running")
+	}
+	defer le.running.Store(false)
+
+	for {
+		le.tryAcquire(ctx)
+
+		t := le.clock.NewTimer(le.renewInterval)
+		select {
+		case <-t.C():
+			// Nop
+		case <-ctx.Done():
+			t.Stop()
+			le.leaseExpiry.Store(0)
+
+			// Use a background context since the parent one is canceled
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := le.lock.Release(releaseCtx, le.id)
+			cancel()
+
+			le.reportChange()
+			if err != nil {
+				return fmt.Errorf("failed to release lock: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// IsLeader returns true if the current replica is the leader.
+func (le *LeaderElector) IsLeader() bool {
+	expiry := le.leaseExpiry.Load()
+	return expiry != 0 && le.clock.Now().UnixNano() < expiry
+}
+
+// Attempts to acquire or renew the lock.
+func (le *LeaderElector) tryAcquire(ctx context.Context) {
+	// The lease is considered to start before the request is sent, so the current replica never believes it's the leader for longer than the lock is held
+	start := le.clock.Now()
+	ok, err := le.lock.TryAcquire(ctx, le.id, le.ttl)
+	switch {
+	case err != nil:
+		// Keep the current lease (if any) until it expires, since the lock may still be held
+	case ok:
+		le.leaseExpiry.Store(start.Add(le.ttl).UnixNano())
+	default:
+		le.leaseExpiry.Store(0)
+	}
+
+	le.reportChange()
+}
+
+// Invokes the onChange callback if the leadership state changed since the last time it was invoked.
+func (le *LeaderElector) reportChange() {
+	isLeader := le.IsLeader()
+	if isLeader == le.reported {
+		return
+	}
+	le.reported = isLeader
+	if le.onChange != nil {
+		le.onChange(isLeader)
+	}
+}
+
+// LeaderOnly returns a Coordinator that executes items only if the current replica is the leader.
+// Followers keep the items that are due and check them again later, so they can execute them if they become the leader: each follower holds all items in memory (and in its store).
+func LeaderOnly[K comparable](le *LeaderElector) Coordinator[K] {
+	return CoordinatorFunc[K](func(K) Ownership {
+		if le.IsLeader() {
+			return Owned
+		}
+		return OwnershipUnknown
+	})
+}
@@ -0,0 +1,291 @@
+package eventqueue
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestLocalLock(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	l := NewLocalLock(clock)
+	ctx := t.Context()
+
+	ok, err := l.TryAcquire(ctx, "a", 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Another owner can't acquire the lock while it's held
+	ok, err = l.TryAcquire(ctx, "b", 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The owner can renew it
+	clock.Step(8 * time.Second)
+	ok, err = l.TryAcquire(ctx, "a", 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	clock.Step(8 * time.Second)
+	ok, _ = l.TryAcquire(ctx, "b", 10*time.Second)
+	assert.False(t, ok)
+
+	// After the lock expires, another owner can acquire it
+	clock.Step(3 * time.Second)
+	ok, _ = l.TryAcquire(ctx, "b", 10*time.Second)
+	assert.True(t, ok)
+
+	// Only the owner can release the lock
+	require.NoError(t, l.Release(ctx, "a"))
+	ok, _ = l.TryAcquire(ctx, "a", 10*time.Second)
+	assert.False(t, ok)
+	require.NoError(t, l.Release(ctx, "b"))
+	ok, _ = l.TryAcquire(ctx, "a", 10*time.Second)
+	assert.True(t, ok)
+}
+
+// failingLock is a Lock that can be made to return errors.
+type failingLock struct {
+	Lock
+	fail atomic.Bool
+}
+
+func (l *failingLock) TryAcquire(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	if l.fail.Load() {
+		return false, errors.New("simulated failure")
+	}
+	return l.Lock.TryAcquire(ctx, owner, ttl)
+}
+
+func TestLeaderElector(t *testing.T) {
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewLeaderElector(LeaderElectorOptions{ID: "a"})
+		require.Error(t, err)
+		_, err = NewLeaderElector(LeaderElectorOptions{Lock: NewLocalLock(nil)})
+		require.Error(t, err)
+		_, err = NewLeaderElector(LeaderElectorOptions{Lock: NewLocalLock(nil), ID: "a", TTL: time.Second, RenewInterval: time.Second})
+		require.Error(t, err)
+	})
+
+	t.Run("election", func(t *testing.T) {
+		clock := clocktesting.NewFakeClock(time.Now())
+		lock := &failingLock{Lock: NewLocalLock(clock)}
+
+		changes := make(chan string, 10)
+		newElector := func(id string) *LeaderElector {
+			le, err := NewLeaderElector(LeaderElectorOptions{
+				Lock: lock,
+				ID:   id,
+				TTL:  9 * time.Second,
+				OnLeadershipChange: func(isLeader bool) {
+					if isLeader {
+						changes <- id + " leader"
+					} else {
+						changes <- id + " follower"
+					}
+				},
+				Clock: clock,
+			})
+			require.NoError(t, err)
+			return le
+		}
+		assertChange := func(t *testing.T, expect string) {
+			t.Helper()
+			select {
+			case c := <-changes:
+				assert.Equal(t, expect, c)
+			case <-time.After(time.Second):
+				t.Fatalf("did not receive change %q in 1s", expect)
+			}
+		}
+
+		a := newElector("a")
+		b := newElector("b")
+
+		ctxA, cancelA := context.WithCancel(t.Context())
+		defer cancelA()
+		go func() {
+			_ = a.Run(ctxA)
+		}()
+		assertChange(t, "a leader")
+		assert.True(t, a.IsLeader())
+
+		ctxB, cancelB := context.WithCancel(t.Context())
+		defer cancelB()
+		go func() {
+			_ = b.Run(ctxB)
+		}()
+		assert.Eventually(t, func() bool {
+			return clock.Waiters() == 2
+		}, time.Second, 10*time.Millisecond)
+		assert.False(t, b.IsLeader())
+
+		// Running twice is not allowed
+		require.Error(t, a.Run(t.Context()))
+
+		// Coordinators execute items only on the leader
+		assert.Equal(t, Owned, LeaderOnly[string](a).Ownership("x"))
+		assert.Equal(t, OwnershipUnknown, LeaderOnly[string](b).Ownership("x"))
+
+		// If the leader can't renew the lock, it steps down when the lease expires
+		lock.fail.Store(true)
+		for range 3 {
+			clock.Step(3 * time.Second)
+			assert.Eventually(t, func() bool {
+				return clock.Waiters() == 2
+			}, time.Second, 10*time.Millisecond)
+		}
+		assert.False(t, a.IsLeader())
+		assertChange(t, "a follower")
+
+		// When the lock can be acquired again, a replica becomes the leader
+		lock.fail.Store(false)
+		clock.Step(3 * time.Second)
+		c := <-changes
+		assert.Contains(t, []string{"a leader", "b leader"}, c)
+		leader, follower := a, b
+		leaderCancel := cancelA
+		if c == "b leader" {
+			leader, follower = b, a
+			leaderCancel = cancelB
+		}
+		assert.Eventually(t, func() bool {
+			return clock.Waiters() == 2
+		}, time.Second, 10*time.Millisecond)
+		assert.True(t, leader.IsLeader())
+		assert.False(t, follower.IsLeader())
+
+		// When the leader stops, it releases the lock so the other replica can take over
+		leaderCancel()
+		assertChange(t, c[:1]+" follower")
+		assert.Eventually(t, func() bool {
+			return clock.Waiters() == 1
+		}, time.Second, 10*time.Millisecond)
+		clock.Step(3 * time.Second)
+		assertChange(t, follower.id+" leader")
+		assert.True(t, follower.IsLeader())
+	})
+}
+
+func TestProcessorLeaderFailover(t *testing.T) {
+	type replica struct {
+		elector   *LeaderElector
+		processor *Processor[string, *queueableItem]
+	}
+	setup := func(t *testing.T) (clock *clocktesting.FakeClock, a, b *replica, executions func() map[string][]string) {
+		t.Helper()
+
+		clock = clocktesting.NewFakeClock(time.Now())
+		lock := NewLocalLock(clock)
+
+		var (
+			execLock sync.Mutex
+			executed = map[string][]string{}
+		)
+		newReplica := func(id string) *replica {
+			r := &replica{}
+			var err error
+			r.elector, err = NewLeaderElector(LeaderElectorOptions{
+				Lock:  lock,
+				ID:    id,
+				TTL:   10 * time.Second,
+				Clock: clock,
+			})
+			require.NoError(t, err)
+			r.processor = NewProcessor(Options[string, *queueableItem]{
+				ExecuteFn: func(item *queueableItem) {
+					execLock.Lock()
+					defer execLock.Unlock()
+					executed[item.Name] = append(executed[item.Name], id)
+				},
+				Coordinator:                LeaderOnly[string](r.elector),
+				CoordinatorRecheckInterval: time.Second,
+				Clock:                      clock,
+			})
+			t.Cleanup(func() { _ = r.processor.Close() })
+			return r
+		}
+		a = newReplica("a")
+		b = newReplica("b")
+
+		executions = func() map[string][]string {
+			execLock.Lock()
+			defer execLock.Unlock()
+			return maps.Clone(executed)
+		}
+		return clock, a, b, executions
+	}
+
+	waitRecheck := func(t *testing.T, clock *clocktesting.FakeClock, r *replica, key string) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			info, ok := r.processor.Get(key)
+			return ok && info.DueTime.Equal(clock.Now().Add(time.Second))
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	t.Run("items due while there's no leader are executed by the new leader", func(t *testing.T) {
+		clock, a, b, executions := setup(t)
+
+		// The item becomes due when the lease of replica a has expired, and replica b hasn't acquired it yet
+		a.elector.tryAcquire(t.Context())
+		require.True(t, a.elector.IsLeader())
+		item := newTestItem(1, clock.Now().Add(10*time.Second))
+		require.NoError(t, a.processor.Enqueue(item))
+		require.NoError(t, b.processor.Enqueue(item))
+		assert.Eventually(t, func() bool {
+			return clock.Waiters() == 2
+		}, time.Second, 10*time.Millisecond)
+		clock.Step(10 * time.Second)
+		require.False(t, a.elector.IsLeader())
+
+		// Both replicas keep the item, and check again later
+		waitRecheck(t, clock, a, "1")
+		waitRecheck(t, clock, b, "1")
+		assert.Empty(t, executions())
+
+		// Once replica b becomes the leader, it executes the item
+		b.elector.tryAcquire(t.Context())
+		require.True(t, b.elector.IsLeader())
+		clock.Step(time.Second)
+		assert.Eventually(t, func() bool {
+			return b.processor.Count() == 0
+		}, time.Second, 10*time.Millisecond)
+		waitRecheck(t, clock, a, "1")
+		assert.Equal(t, map[string][]string{"1": {"b"}}, executions())
+	})
+
+	t.Run("items executed by the leader can be removed from the other replicas", func(t *testing.T) {
+		clock, a, b, executions := setup(t)
+
+		a.elector.tryAcquire(t.Context())
+		require.True(t, a.elector.IsLeader())
+		item := newTestItem(1, clock.Now().Add(time.Second))
+		require.NoError(t, a.processor.Enqueue(item))
+		require.NoError(t, b.processor.Enqueue(item))
+		assert.Eventually(t, func() bool {
+			return clock.Waiters() == 2
+		}, time.Second, 10*time.Millisecond)
+		clock.Step(time.Second)
+		assert.Eventually(t, func() bool {
+			return a.processor.Count() == 0
+		}, time.Second, 10*time.Millisecond)
+		waitRecheck(t, clock, b, "1")
+		require.NoError(t, b.processor.Dequeue("1"))
+
+		// Replica a stops renewing the lease, and replica b takes over
+		clock.Step(10 * time.Second)
+		b.elector.tryAcquire(t.Context())
+		require.True(t, b.elector.IsLeader())
+		time.Sleep(100 * time.Millisecond)
+
+		assert.Equal(t, map[string][]string{"1": {"a"}}, executions())
+	})
+}
@@ -0,0 +1,198 @@
+package eventqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/italypaleale/go-kit/eventqueue"
+
+	attrName      = attribute.Key("eventqueue.name")
+	attrOutcome   = attribute.Key("eventqueue.outcome")
+	attrAttempt   = attribute.Key("eventqueue.attempt")
+	attrBatchSize = attribute.Key("eventqueue.batch.size")
+
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// processorMetrics contains the instruments used to track the queue
+// When the app did not provide a meter, all instruments are no-op
+type processorMetrics struct {
+	enqueued     metric.Int64Counter
+	replaced     metric.Int64Counter
+	dequeued     metric.Int64Counter
+	lag          metric.Float64Histogram
+	duration     metric.Float64Histogram
+	length       metric.Int64ObservableGauge
+	registration metric.Registration
+	attrs        metric.MeasurementOption
+}
+
+func newProcessorMetrics(meter metric.Meter, name string) (*processorMetrics, error) {
+	var (
+		m   processorMetrics
+		err error
+	)
+
+	m.attrs = metric.WithAttributes(attrName.String(name))
+
+	m.enqueued, err = meter.Int64Counter(
+		"eventqueue.enqueued",
+		metric.WithDescription("Number of items added to the queue"),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.enqueued counter: %w", err)
+	}
+
+	m.replaced, err = meter.Int64Counter(
+		"eventqueue.replaced",
+		metric.WithDescription("Number of items that replaced an item with the same key in the queue"),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.replaced counter: %w", err)
+	}
+
+	m.dequeued, err = meter.Int64Counter(
+		"eventqueue.dequeued",
+		metric.WithDescription("Number of items removed from the queue before being executed"),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.dequeued counter: %w", err)
+	}
+
+	m.lag, err = meter.Float64Histogram(
+		"eventqueue.execution.lag",
+		metric.WithDescription("Time between when an item was due and when its execution started"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.execution.lag histogram: %w", err)
+	}
+
+	m.duration, err = meter.Float64Histogram(
+		"eventqueue.execution.duration",
+		metric.WithDescription("Time taken to execute an item"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.execution.duration histogram: %w", err)
+	}
+
+	m.length, err = meter.Int64ObservableGauge(
+		"eventqueue.queue.length",
+		metric.WithDescription("Number of items in the queue"),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventqueue.queue.length gauge: %w", err)
+	}
+
+	return &m, nil
+}
+
+// Registers the callback for the queue length gauge.
+func (m *processorMetrics) observeLength(meter metric.Meter, count func() int) error {
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(m.length, int64(count()), m.attrs)
+		return nil
+	}, m.length)
+	if err != nil {
+		return fmt.Errorf("failed to register callback for eventqueue.queue.length gauge: %w", err)
+	}
+	m.registration = reg
+	return nil
+}
+
+// Unregisters the callback for the queue length gauge.
+func (m *processorMetrics) close() {
+	if m.registration != nil {
+		_ = m.registration.Unregister()
+	}
+}
+
+// Returns the metrics for a processor.
+// If the instruments can't be created, metrics are not recorded, since NewProcessor can't return an error.
+func getProcessorMetrics(meter metric.Meter, name string, count func() int) *processorMetrics {
+	if meter != nil {
+		m, err := newProcessorMetrics(meter, name)
+		if err == nil {
+			err = m.observeLength(meter, count)
+		}
+		if err == nil {
+			return m
+		}
+		otel.Handle(err)
+	}
+
+	// The no-op meter never returns errors
+	m, _ := newProcessorMetrics(noop.Meter{}, name)
+	return m
+}
+
+// getTracer returns the tracer from the given provider, or from the global one if nil
+func getTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}
+
+// Starts the span for executing one item or a batch, linked to the spans that enqueued the items, if any.
+// Returns the context for the execution, which contains the span.
+func (p *Processor[K, T]) startExecuteSpan(items ...*queueItem[K, T]) (context.Context, trace.Span) {
+	name := "eventqueue.Execute"
+	attrs := []attribute.KeyValue{attrName.String(p.name)}
+	if p.batchExecuteFn != nil {
+		name = "eventqueue.ExecuteBatch"
+		attrs = append(attrs, attrBatchSize.Int(len(items)))
+	} else {
+		attrs = append(attrs, attrAttempt.Int(items[0].attempt+1))
+	}
+
+	var links []trace.Link
+	for _, item := range items {
+		if item.spanContext.IsValid() {
+			links = append(links, trace.Link{SpanContext: item.spanContext})
+		}
+	}
+
+	return p.tracer.Start(p.ctx, name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+		trace.WithLinks(links...),
+	)
+}
+
+// Records the time between when the item was due and when its execution started.
+func (p *Processor[K, T]) recordLag(start time.Time, item *queueItem[K, T]) {
+	p.metrics.lag.Record(context.Background(), max(start.Sub(item.dueTime()), 0).Seconds(), p.metrics.attrs)
+}
+
+// Records the outcome of an execution in the span and in the metrics.
+func (p *Processor[K, T]) recordExecution(span trace.Span, elapsedSeconds float64, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeFailure
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attrOutcome.String(outcome))
+	span.End()
+
+	p.metrics.duration.Record(context.Background(), elapsedSeconds,
+		metric.WithAttributes(attrName.String(p.name), attrOutcome.String(outcome)),
+	)
+}
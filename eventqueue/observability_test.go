@@ -0,0 +1,149 @@
+package eventqueue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestInstrumentedProcessor(t *testing.T) {
+	reader := sdkMetric.NewManualReader()
+	mp := sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader))
+	spans := tracetest.NewSpanRecorder()
+	tp := sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(spans))
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan string, 2)
+	processor := NewProcessor(Options[string, *queueableItem]{
+		ExecuteErrFn: func(r *queueableItem) error {
+			executeCh <- r.Name
+			if r.Name == "2" {
+				return errors.New("simulated")
+			}
+			return nil
+		},
+		Clock:          clock,
+		Name:           "test",
+		Meter:          mp.Meter("test"),
+		TracerProvider: tp,
+	})
+	defer processor.Close()
+
+	collect := func(t *testing.T) map[string]metricdata.Aggregation {
+		t.Helper()
+
+		var rm metricdata.ResourceMetrics
+		err := reader.Collect(t.Context(), &rm)
+		require.NoError(t, err)
+		require.Len(t, rm.ScopeMetrics, 1)
+
+		found := map[string]metricdata.Aggregation{}
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			found[m.Name] = m.Data
+		}
+		return found
+	}
+
+	// Enqueue item 1 within a span, then replace item 2 and dequeue item 3
+	ctx, parent := tp.Tracer("test").Start(t.Context(), "parent")
+	err := processor.EnqueueContext(ctx, newTestItem(1, clock.Now().Add(time.Second)))
+	require.NoError(t, err)
+	parent.End()
+
+	err = processor.Enqueue(
+		newTestItem(2, clock.Now().Add(time.Hour)),
+		newTestItem(3, clock.Now().Add(time.Hour)),
+	)
+	require.NoError(t, err)
+	err = processor.Enqueue(newTestItem(2, clock.Now().Add(2*time.Second)))
+	require.NoError(t, err)
+	err = processor.Dequeue("3")
+	require.NoError(t, err)
+	err = processor.Dequeue("99")
+	require.NoError(t, err)
+
+	found := collect(t)
+	length, ok := found["eventqueue.queue.length"].(metricdata.Gauge[int64])
+	require.True(t, ok)
+	require.Len(t, length.DataPoints, 1)
+	assert.Equal(t, int64(2), length.DataPoints[0].Value)
+	assert.Contains(t, length.DataPoints[0].Attributes.ToSlice(), attribute.String("eventqueue.name", "test"))
+
+	// Execute both items, 3s after item 1 was due
+	assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+	clock.Step(4 * time.Second)
+	for range 2 {
+		select {
+		case <-executeCh:
+		case <-time.After(time.Second):
+			t.Fatal("item was not executed in 1s")
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return len(spans.Ended()) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// Verify the spans: item 1 is linked to the span that enqueued it, and item 2 failed
+	var linked, failed sdkTrace.ReadOnlySpan
+	for _, s := range spans.Ended() {
+		switch {
+		case s.Name() != "eventqueue.Execute":
+			// Nop
+		case len(s.Links()) > 0:
+			linked = s
+		default:
+			failed = s
+		}
+	}
+	require.NotNil(t, linked)
+	assert.Equal(t, parent.SpanContext().SpanID(), linked.Links()[0].SpanContext.SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, linked.SpanKind())
+	assert.Contains(t, linked.Attributes(), attribute.String("eventqueue.outcome", "success"))
+	require.NotNil(t, failed)
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.Contains(t, failed.Attributes(), attribute.String("eventqueue.outcome", "failure"))
+
+	// Verify the metrics
+	found = collect(t)
+
+	enqueued, ok := found["eventqueue.enqueued"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, enqueued.DataPoints, 1)
+	assert.Equal(t, int64(4), enqueued.DataPoints[0].Value)
+
+	replaced, ok := found["eventqueue.replaced"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, replaced.DataPoints, 1)
+	assert.Equal(t, int64(1), replaced.DataPoints[0].Value)
+
+	dequeued, ok := found["eventqueue.dequeued"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, dequeued.DataPoints, 1)
+	assert.Equal(t, int64(1), dequeued.DataPoints[0].Value)
+
+	lag, ok := found["eventqueue.execution.lag"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, lag.DataPoints, 1)
+	assert.Equal(t, uint64(2), lag.DataPoints[0].Count)
+	assert.InDelta(t, 5.0, lag.DataPoints[0].Sum, 0.001)
+
+	duration, ok := found["eventqueue.execution.duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Len(t, duration.DataPoints, 2)
+
+	length, ok = found["eventqueue.queue.length"].(metricdata.Gauge[int64])
+	require.True(t, ok)
+	require.Len(t, length.DataPoints, 1)
+	assert.Equal(t, int64(0), length.DataPoints[0].Value)
+}
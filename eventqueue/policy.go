@@ -0,0 +1,36 @@
+package eventqueue
+
+import (
+	"time"
+)
+
+// EnqueuePolicy determines what happens when an item is enqueued while another item with the same key is in the queue.
+// It receives the information about the item in the queue, including the time it's due at if it was rescheduled or is being retried, and the item being enqueued; it returns the item to keep, which must have the same key.
+// If it returns the existing item, the queue is not changed; otherwise, the returned item replaces the existing one, as a new item.
+// Policies that combine the two items can be used to merge payloads, for example to debounce bursts of events on the same key.
+type EnqueuePolicy[K comparable, T Queueable[K]] func(existing ItemInfo[T], incoming T) T
+
+// Replace is the EnqueuePolicy used by Enqueue: the incoming item always replaces the existing one.
+func Replace[T any](_ ItemInfo[T], incoming T) T {
+	return incoming
+}
+
+// KeepEarliest is an EnqueuePolicy that keeps the item that is due first.
+// The existing item is compared using the time it's due at in the queue, which differs from its DueTime if it was rescheduled or is being retried.
+// If both items are due at the same time, the existing one is kept.
+func KeepEarliest[T interface{ DueTime() time.Time }](existing ItemInfo[T], incoming T) T {
+	if incoming.DueTime().Before(existing.DueTime) {
+		return incoming
+	}
+	return existing.Item
+}
+
+// KeepLatest is an EnqueuePolicy that keeps the item that is due last.
+// The existing item is compared using the time it's due at in the queue, which differs from its DueTime if it was rescheduled or is being retried.
+// If both items are due at the same time, the existing one is kept.
+func KeepLatest[T interface{ DueTime() time.Time }](existing ItemInfo[T], incoming T) T {
+	if incoming.DueTime().After(existing.DueTime) {
+		return incoming
+	}
+	return existing.Item
+}
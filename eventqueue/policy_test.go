@@ -0,0 +1,177 @@
+package eventqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+type countedItem struct {
+	Name          string
+	ExecutionTime time.Time
+	Events        int
+}
+
+func (r *countedItem) Key() string {
+	return r.Name
+}
+
+func (r *countedItem) DueTime() time.Time {
+	return r.ExecutionTime
+}
+
+func TestEnqueueWithPolicy(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	newProcessor := func(t *testing.T) *Processor[string, *queueableItem] {
+		t.Helper()
+
+		processor := NewProcessor(Options[string, *queueableItem]{
+			ExecuteFn: func(r *queueableItem) {},
+			Clock:     clock,
+		})
+		t.Cleanup(func() {
+			processor.Close()
+		})
+		return processor
+	}
+
+	assertDueTime := func(t *testing.T, processor *Processor[string, *queueableItem], expect time.Time) {
+		t.Helper()
+
+		info, ok := processor.Get("1")
+		require.True(t, ok)
+		assert.True(t, expect.Equal(info.DueTime), "expected due time %v, got %v", expect, info.DueTime)
+	}
+
+	now := clock.Now()
+
+	t.Run("nil policy replaces", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), nil, newTestItem(1, now.Add(time.Minute))))
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), nil, newTestItem(1, now.Add(2*time.Minute))))
+		assertDueTime(t, processor, now.Add(2*time.Minute))
+
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), Replace, newTestItem(1, now.Add(time.Hour))))
+		assertDueTime(t, processor, now.Add(time.Hour))
+	})
+
+	t.Run("keep earliest", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		first := newTestItem(1, now.Add(time.Minute))
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepEarliest, first))
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepEarliest, newTestItem(1, now.Add(2*time.Minute))))
+		info, ok := processor.Get("1")
+		require.True(t, ok)
+		assert.Same(t, first, info.Item)
+
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepEarliest, newTestItem(1, now.Add(30*time.Second))))
+		assertDueTime(t, processor, now.Add(30*time.Second))
+		assert.Equal(t, 1, processor.Count())
+	})
+
+	t.Run("keep latest", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepLatest, newTestItem(1, now.Add(time.Minute))))
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepLatest, newTestItem(1, now.Add(30*time.Second))))
+		assertDueTime(t, processor, now.Add(time.Minute))
+
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepLatest, newTestItem(1, now.Add(2*time.Minute))))
+		assertDueTime(t, processor, now.Add(2*time.Minute))
+	})
+
+	t.Run("rescheduled items are compared using their due time in the queue", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		// The existing item is due in 1m, but it's rescheduled to 10m
+		first := newTestItem(1, now.Add(time.Minute))
+		require.NoError(t, processor.Enqueue(first))
+		require.NoError(t, processor.Reschedule("1", now.Add(10*time.Minute)))
+
+		// With KeepLatest, an item due in 5m doesn't replace it
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepLatest, newTestItem(1, now.Add(5*time.Minute))))
+		info, ok := processor.Get("1")
+		require.True(t, ok)
+		assert.Same(t, first, info.Item)
+		assertDueTime(t, processor, now.Add(10*time.Minute))
+
+		// With KeepEarliest, it does
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), KeepEarliest, newTestItem(1, now.Add(5*time.Minute))))
+		assertDueTime(t, processor, now.Add(5*time.Minute))
+	})
+
+	t.Run("policies can be instantiated with the item type only", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		keepEarliest := KeepEarliest[*queueableItem]
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), keepEarliest, newTestItem(1, now.Add(time.Minute))))
+		require.NoError(t, processor.EnqueueWithPolicy(t.Context(), keepEarliest, newTestItem(1, now.Add(2*time.Minute))))
+		assertDueTime(t, processor, now.Add(time.Minute))
+	})
+
+	t.Run("policies must return an item with the same key", func(t *testing.T) {
+		processor := newProcessor(t)
+
+		require.NoError(t, processor.Enqueue(newTestItem(1, now.Add(time.Minute))))
+		changeKey := func(_ ItemInfo[*queueableItem], incoming *queueableItem) *queueableItem {
+			return newTestItem(2, incoming.ExecutionTime)
+		}
+		err := processor.EnqueueWithPolicy(t.Context(), changeKey, newTestItem(1, now.Add(time.Hour)))
+		require.ErrorIs(t, err, ErrPolicyKeyChanged)
+
+		// The queue is not changed
+		assert.Equal(t, 1, processor.Count())
+		assertDueTime(t, processor, now.Add(time.Minute))
+	})
+
+	t.Run("merge events on the same key", func(t *testing.T) {
+		executeCh := make(chan *countedItem, 10)
+		processor := NewProcessor(Options[string, *countedItem]{
+			ExecuteFn: func(r *countedItem) {
+				executeCh <- r
+			},
+			Clock: clock,
+		})
+		defer processor.Close()
+
+		// Debounce: each event postpones the execution, and the number of events is accumulated
+		merge := func(existing ItemInfo[*countedItem], incoming *countedItem) *countedItem {
+			return &countedItem{
+				Name:          incoming.Name,
+				ExecutionTime: incoming.ExecutionTime,
+				Events:        existing.Item.Events + incoming.Events,
+			}
+		}
+		for i := range 3 {
+			err := processor.EnqueueWithPolicy(t.Context(), merge, &countedItem{
+				Name:          "a",
+				ExecutionTime: clock.Now().Add(time.Duration(i+1) * time.Second),
+				Events:        1,
+			})
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1, processor.Count())
+
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(2 * time.Second)
+		select {
+		case r := <-executeCh:
+			t.Fatalf("item executed too early: %v", r)
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+
+		clock.Step(time.Second)
+		select {
+		case r := <-executeCh:
+			assert.Equal(t, 3, r.Events)
+		case <-time.After(time.Second):
+			t.Fatal("item was not executed in 1s")
+		}
+	})
+}
@@ -5,57 +5,275 @@
 package eventqueue
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	kclock "k8s.io/utils/clock"
 )
 
 // ErrProcessorStopped is returned when the processor is not running.
 var ErrProcessorStopped = errors.New("processor is stopped")
 
+// ErrItemNotFound is returned when an item is not in the queue.
+var ErrItemNotFound = errors.New("item not found in the queue")
+
+// ErrPolicyKeyChanged is returned by EnqueueWithPolicy when the policy returns an item with a different key.
+var ErrPolicyKeyChanged = errors.New("enqueue policy returned an item with a different key")
+
+// ErrRescheduleNotSupported is returned by Reschedule when the processor has a store.
+var ErrRescheduleNotSupported = errors.New("items cannot be rescheduled when the processor has a store")
+
+// ItemInfo contains information about an item in the queue.
+type ItemInfo[T any] struct {
+	// The item
+	Item T
+	// Time the item is due at
+	// This is different from the item's DueTime if the item was rescheduled or is being retried
+	DueTime time.Time
+	// Number of failed attempts, for items that are being retried
+	Attempts int
+}
+
 type Options[K comparable, T Queueable[K]] struct {
 	ExecuteFn func(r T)
-	Clock     kclock.Clock
+	// Alternative to ExecuteFn, for executors that return an error
+	// When this returns an error, the item is retried according to RetryPolicy
+	ExecuteErrFn func(r T) error
+	// Alternative to ExecuteErrFn, for executors that accept a context
+	// The context is canceled when the processor is closed, and it contains the span for the execution
+	ExecuteContextFn func(ctx context.Context, r T) error
+	// Policy for retrying items when ExecuteErrFn, ExecuteContextFn, BatchExecuteFn, or BatchExecuteContextFn returns an error
+	// If nil, items are not retried
+	// Retries are re-scheduled in the queue, and are not recorded in the store
+	RetryPolicy *RetryPolicy
+	// Callback invoked when ExecuteErrFn, ExecuteContextFn, BatchExecuteFn, or BatchExecuteContextFn returns an error and the item is not retried anymore
+	// Items that fail while the processor is closed, and that had attempts left, are not sent to this callback
+	DeadLetterFn func(r T, err error)
+	// Optional Coordinator used when multiple replicas have the same items, which determines whether the current replica executes an item
+	// Items owned by another replica are removed from the queue as if they had been executed; items whose owner is unknown are kept in the queue (and in the store), and the Coordinator is checked again after CoordinatorRecheckInterval
+	Coordinator Coordinator[K]
+	// Interval after which the Coordinator is checked again for items whose owner was unknown
+	// When using LeaderOnly, this should be close to LeaderElectorOptions.RenewInterval
+	// Defaults to 5s
+	CoordinatorRecheckInterval time.Duration
+	Clock                      kclock.Clock
+	// Maximum number of items that can be executed concurrently
+	// If 0 (the default), items are executed synchronously in the processing goroutine, so a slow ExecuteFn delays all other items
+	// When greater than 0, due items are dispatched to a pool of workers; items with the same key are never executed concurrently, and are executed in the order they became due
+	Concurrency int
+	// Alternative to ExecuteFn and ExecuteErrFn, which receives the items that are due in batches
+	// Due items are collected until there are BatchSize of them, or until the first one has waited for BatchMaxWait, then they're passed to BatchExecuteFn together
+	// When this returns an error, all items in the batch are retried according to RetryPolicy
+	// Batches are executed one at a time, in the processing goroutine, so Concurrency is ignored
+	// Items in a batch that wasn't executed when the processor is closed are discarded (but they're still in the store, if any)
+	BatchExecuteFn func(rs []T) error
+	// Alternative to BatchExecuteFn, for executors that accept a context
+	// The context is canceled when the processor is closed, and it contains the span for the execution
+	BatchExecuteContextFn func(ctx context.Context, rs []T) error
+	// Maximum number of items in a batch
+	// Defaults to 100
+	BatchSize int
+	// Maximum time the first item in a batch waits for more items
+	// If 0, each batch contains the items that are due at the same time (up to BatchSize)
+	BatchMaxWait time.Duration
+	// Optional limit for the rate at which the executor is invoked
+	// Items (or batches) that would exceed the limit are delayed until the limit allows them
+	// When using BatchExecuteFn or BatchExecuteContextFn, each batch counts as one execution
+	RateLimit *RateLimit
+	// Data structure used to store the items in the queue
+	// Defaults to QueueBackendHeap; QueueBackendTimingWheel is more efficient for queues with millions of items
+	QueueBackend QueueBackend
+	// Name of the queue, added as an attribute to metrics and spans
+	Name string
+	// Meter used to record metrics
+	// If unset, no metrics are recorded
+	Meter metric.Meter
+	// Tracer provider used to create a span for each execution
+	// Uses the global tracer provider if unset
+	TracerProvider trace.TracerProvider
+	// If true, Shutdown executes the items that are due before the deadline of its context, before stopping the processor
+	DrainOnShutdown bool
+	// Maximum time Run waits for Shutdown to complete after its context is canceled
+	// If 0, there's no limit
+	ShutdownTimeout time.Duration
+	// Optional callback invoked by Shutdown with the items that are left in the queue, in the order they were to be executed
+	RemainingFn func(rs []T)
 }
 
 // Processor manages the queue of items and processes them at the correct time
 type Processor[K comparable, T Queueable[K]] struct {
-	executeFn          func(r T)
-	queue              queue[K, T]
+	executeFn          func(ctx context.Context, r T) error
+	retryPolicy        *RetryPolicy
+	deadLetterFn       func(r T, err error)
+	coordinator        Coordinator[K]
+	recheckInterval    time.Duration
+	queue              itemQueue[K, T]
+	store              Store[K, T]
 	clock              kclock.Clock
 	lock               sync.Mutex
 	wg                 sync.WaitGroup
 	processorRunningCh chan struct{}
+	workersWg          sync.WaitGroup
+	workersSem         chan struct{}
 	stopCh             chan struct{}
 	resetCh            chan struct{}
 	stopped            atomic.Bool
+
+	// When the processor is paused, this channel is closed when it's resumed
+	resumeCh chan struct{}
+	// Keys of the items being executed by workers, with the items with the same key that are waiting for them to complete
+	running map[K][]*queueItem[K, T]
+
+	name    string
+	metrics *processorMetrics
+	tracer  trace.Tracer
+
+	batchExecuteFn func(ctx context.Context, rs []T) error
+	batchSize      int
+	batchMaxWait   time.Duration
+	limiter        *rate.Limiter
+	// Items that are due and are being collected into a batch; only accessed by the processing loop
+	batch      []*queueItem[K, T]
+	batchStart time.Time
+
+	// Context for executions, which is canceled when the processor is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Number of items that were removed from the queue to be executed, and haven't completed yet
+	inflight int
+	// Receives a signal when an item completes, or when items are removed from the queue
+	progressCh      chan struct{}
+	draining        atomic.Bool
+	drainOnShutdown bool
+	shutdownTimeout time.Duration
+	remainingFn     func(rs []T)
 }
 
 // NewProcessor returns a new Processor object.
-// executeFn is the callback invoked when the item is to be executed
+// opts.ExecuteFn (or opts.ExecuteErrFn, opts.ExecuteContextFn, opts.BatchExecuteFn, or opts.BatchExecuteContextFn) is the callback invoked when the item is to be executed
 // This will be invoked in a background goroutine
 func NewProcessor[K comparable, T Queueable[K]](opts Options[K, T]) *Processor[K, T] {
 	cl := opts.Clock
 	if cl == nil {
 		cl = kclock.RealClock{}
 	}
-	return &Processor[K, T]{
-		executeFn:          opts.ExecuteFn,
-		queue:              newQueue[K, T](),
+	executeFn := opts.ExecuteContextFn
+	if executeFn == nil {
+		executeErrFn := opts.ExecuteErrFn
+		if executeErrFn == nil {
+			executeErrFn = func(r T) error {
+				opts.ExecuteFn(r)
+				return nil
+			}
+		}
+		executeFn = func(_ context.Context, r T) error {
+			return executeErrFn(r)
+		}
+	}
+	p := &Processor[K, T]{
+		executeFn:          executeFn,
+		retryPolicy:        opts.RetryPolicy,
+		deadLetterFn:       opts.DeadLetterFn,
+		coordinator:        opts.Coordinator,
+		recheckInterval:    opts.CoordinatorRecheckInterval,
+		queue:              newItemQueue[K, T](opts.QueueBackend),
 		processorRunningCh: make(chan struct{}, 1),
 		stopCh:             make(chan struct{}),
 		resetCh:            make(chan struct{}, 1),
 		clock:              cl,
+		name:               opts.Name,
+		tracer:             getTracer(opts.TracerProvider),
+		progressCh:         make(chan struct{}, 1),
+		drainOnShutdown:    opts.DrainOnShutdown,
+		shutdownTimeout:    opts.ShutdownTimeout,
+		remainingFn:        opts.RemainingFn,
 	}
+	if p.recheckInterval <= 0 {
+		p.recheckInterval = defaultCoordinatorRecheckInterval
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.metrics = getProcessorMetrics(opts.Meter, opts.Name, p.Count)
+	if opts.RateLimit != nil && opts.RateLimit.Events > 0 {
+		p.limiter = opts.RateLimit.NewLimiter()
+	}
+	batchExecuteFn := opts.BatchExecuteContextFn
+	if batchExecuteFn == nil && opts.BatchExecuteFn != nil {
+		batchExecuteFn = func(_ context.Context, rs []T) error {
+			return opts.BatchExecuteFn(rs)
+		}
+	}
+	if batchExecuteFn != nil {
+		p.batchExecuteFn = batchExecuteFn
+		p.batchSize = opts.BatchSize
+		if p.batchSize <= 0 {
+			p.batchSize = defaultBatchSize
+		}
+		p.batchMaxWait = opts.BatchMaxWait
+	} else if opts.Concurrency > 0 {
+		p.workersSem = make(chan struct{}, opts.Concurrency)
+		p.running = make(map[K][]*queueItem[K, T])
+	}
+	return p
+}
+
+// NewPersistentProcessor returns a new Processor that records all changes to the queue in store.
+// The queue is rebuilt from the items in the store; items that are already past due are executed right away.
+// Items are removed from the store after executeFn returns, so an item may be executed again if the process stops while it's being executed.
+// The processor does not close the store: callers should close it after closing the processor, if needed.
+func NewPersistentProcessor[K comparable, T Queueable[K]](opts Options[K, T], store Store[K, T]) (*Processor[K, T], error) {
+	if store == nil {
+		return nil, errors.New("store is required")
+	}
+
+	items, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load items from store: %w", err)
+	}
+
+	p := NewProcessor(opts)
+	p.store = store
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, r := range items {
+		p.queue.Insert(r, true)
+	}
+	if p.queue.Len() > 0 {
+		p.process(true)
+	}
+
+	return p, nil
 }
 
 // Enqueue adds a new items to the queue.
 // If a item with the same ID already exists, it'll be replaced.
+// If the processor has a store, items are persisted before being added to the queue.
 func (p *Processor[K, T]) Enqueue(rs ...T) error {
-	if p.stopped.Load() {
+	return p.EnqueueWithPolicy(context.Background(), nil, rs...)
+}
+
+// EnqueueContext is like Enqueue, but the spans created when the items are executed are linked to the span in ctx, if any.
+func (p *Processor[K, T]) EnqueueContext(ctx context.Context, rs ...T) error {
+	return p.EnqueueWithPolicy(ctx, nil, rs...)
+}
+
+// EnqueueWithPolicy is like EnqueueContext, but if an item with the same key is in the queue, policy determines which item is kept.
+// For example, use KeepEarliest, KeepLatest, or a function that merges the two items.
+// If policy is nil, Replace is used.
+// Policies only apply to items that are in the queue, and not to items that are being executed.
+// If the policy returns an item with a different key, it returns ErrPolicyKeyChanged, and that item and the ones after it are not enqueued.
+func (p *Processor[K, T]) EnqueueWithPolicy(ctx context.Context, policy EnqueuePolicy[K, T], rs ...T) error {
+	spanContext := trace.SpanContextFromContext(ctx)
+
+	// Items can't be enqueued while the processor is shutting down
+	if p.stopped.Load() || p.draining.Load() {
 		return ErrProcessorStopped
 	}
 
@@ -63,23 +281,56 @@ func (p *Processor[K, T]) Enqueue(rs ...T) error {
 	defer p.lock.Unlock()
 
 	// Re-check under the lock
-	if p.stopped.Load() {
+	if p.stopped.Load() || p.draining.Load() {
 		return ErrProcessorStopped
 	}
 
 	for _, r := range rs {
-		p.enqueue(r)
+		if policy != nil {
+			key := r.Key()
+			existing, ok := p.queue.Get(key)
+			if ok {
+				r = policy(existing.info(), r)
+				if r == existing.value {
+					// Keep the item that is in the queue
+					continue
+				}
+				if r.Key() != key {
+					return fmt.Errorf("%w: expected %v, got %v", ErrPolicyKeyChanged, key, r.Key())
+				}
+			}
+		}
+
+		if p.store != nil {
+			err := p.store.Save(r)
+			if err != nil {
+				return fmt.Errorf("failed to persist item: %w", err)
+			}
+		}
+		p.enqueue(r, spanContext)
 	}
 
 	return nil
 }
 
-func (p *Processor[K, T]) enqueue(r T) {
+func (p *Processor[K, T]) enqueue(r T, spanContext trace.SpanContext) {
+	key := r.Key()
+	_, replaced := p.queue.Get(key)
+
 	// Insert or replace the item in the queue
 	// If the item added or replaced is the first one in the queue, we need to know that
 	peek, ok := p.queue.Peek()
-	isFirst := (ok && peek.Key() == r.Key()) // This is going to be true if the item being replaced is the first one in the queue
+	isFirst := (ok && peek.Key() == key) // This is going to be true if the item being replaced is the first one in the queue
 	p.queue.Insert(r, true)
+	if item, ok := p.queue.Get(key); ok {
+		item.spanContext = spanContext
+	}
+
+	p.metrics.enqueued.Add(context.Background(), 1, p.metrics.attrs)
+	if replaced {
+		p.metrics.replaced.Add(context.Background(), 1, p.metrics.attrs)
+	}
+
 	peek, _ = p.queue.Peek()         // No need to check for "ok" here because we know this will return an item
 	isFirst = isFirst || (peek == r) // This is also going to be true if the item just added landed at the front of the queue
 	p.process(isFirst)
@@ -93,8 +344,19 @@ func (p *Processor[K, T]) Dequeue(key K) error {
 
 	// We need to check if this is the next item in the queue, as that requires stopping the processor
 	p.lock.Lock()
+	if p.store != nil {
+		err := p.store.Delete(key)
+		if err != nil {
+			p.lock.Unlock()
+			return fmt.Errorf("failed to delete item from store: %w", err)
+		}
+	}
 	peek, ok := p.queue.Peek()
-	p.queue.Remove(key)
+	if _, exists := p.queue.Get(key); exists {
+		p.queue.Remove(key)
+		p.metrics.dequeued.Add(context.Background(), 1, p.metrics.attrs)
+		p.notifyProgress()
+	}
 	if ok && peek.Key() == key {
 		// If the item was the first one in the queue, restart the processor
 		p.process(true)
@@ -111,13 +373,118 @@ func (p *Processor[K, T]) Count() int {
 	return p.queue.Len()
 }
 
-// Close stops the processor.
-// This method blocks until the processor loop returns.
+// Get returns the item with the given key, if it's in the queue.
+func (p *Processor[K, T]) Get(key K) (ItemInfo[T], bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	item, ok := p.queue.Get(key)
+	if !ok {
+		return ItemInfo[T]{}, false
+	}
+	return item.info(), true
+}
+
+// List returns up to limit items in the queue, in the order they are to be executed, skipping the first offset items.
+// If limit is 0 or negative, all items after offset are returned.
+func (p *Processor[K, T]) List(offset int, limit int) []ItemInfo[T] {
+	// The items are read while holding the lock, as they can be modified when they're replaced or rescheduled
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	items := p.queue.Items()
+	if offset >= len(items) {
+		return []ItemInfo[T]{}
+	}
+	items = items[max(offset, 0):]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+
+	res := make([]ItemInfo[T], len(items))
+	for i, item := range items {
+		res[i] = item.info()
+	}
+	return res
+}
+
+// Reschedule changes the time the item with the given key is due at, without replacing the item.
+// The new due time is used in place of the item's DueTime until the item is executed or replaced.
+// Because the store can't record the new due time, processors created with NewPersistentProcessor return ErrRescheduleNotSupported; enqueue an updated item instead.
+// Returns ErrItemNotFound if the item is not in the queue.
+func (p *Processor[K, T]) Reschedule(key K, dueTime time.Time) error {
+	if p.stopped.Load() {
+		return ErrProcessorStopped
+	}
+	if p.store != nil {
+		return ErrRescheduleNotSupported
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	peek, ok := p.queue.Peek()
+	isFirst := ok && peek.Key() == key
+	if !p.queue.Reschedule(key, dueTime) {
+		return ErrItemNotFound
+	}
+	peek, _ = p.queue.Peek()
+	isFirst = isFirst || peek.Key() == key
+	p.process(isFirst)
+	p.notifyProgress()
+
+	return nil
+}
+
+// Pause stops executing items until Resume is invoked.
+// Items can still be enqueued and dequeued while the processor is paused, and items that are being executed are not interrupted.
+func (p *Processor[K, T]) Pause() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.resumeCh != nil {
+		return
+	}
+	p.resumeCh = make(chan struct{})
+
+	// Send a reset signal so the processing loop stops waiting for the next item
+	select {
+	case p.resetCh <- struct{}{}:
+	default:
+	}
+}
+
+// Resume resumes executing items after Pause.
+// Items that became due while the processor was paused are executed right away.
+func (p *Processor[K, T]) Resume() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.resumeCh == nil {
+		return
+	}
+	close(p.resumeCh)
+	p.resumeCh = nil
+}
+
+// IsPaused returns true if the processor is paused.
+func (p *Processor[K, T]) IsPaused() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.resumeCh != nil
+}
+
+// Close stops the processor right away, and cancels the context of items that are being executed.
+// This method blocks until the processor loop returns and, when using workers, until all items that were already due have been executed.
+// Use Shutdown to stop the processor gracefully.
 func (p *Processor[K, T]) Close() error {
+	defer p.workersWg.Wait()
 	defer p.wg.Wait()
 	if p.stopped.CompareAndSwap(false, true) {
-		// Send a signal to stop
+		// Send a signal to stop, and cancel executions
 		close(p.stopCh)
+		p.cancel()
+		p.metrics.close()
 		// Blocks until processor loop ends
 		p.processorRunningCh <- struct{}{}
 		return nil
@@ -169,12 +536,24 @@ func (p *Processor[K, T]) processLoop() {
 	for {
 		// Continue processing items until the queue is empty
 		p.lock.Lock()
-		r, ok = p.queue.Peek()
+		p.queue.Promote(p.clock.Now())
+		r, dueTime, ok = p.queue.PeekDueTime()
+		resumeCh := p.resumeCh
 		p.lock.Unlock()
-		if !ok {
+		if !ok && len(p.batch) == 0 {
 			return
 		}
 
+		// If the processor is paused, wait until it's resumed
+		if resumeCh != nil {
+			select {
+			case <-resumeCh:
+				continue
+			case <-p.stopCh:
+				return
+			}
+		}
+
 		// Check if after obtaining the lock we have a stop or reset signals
 		// Do this before we create a timer
 		select {
@@ -188,21 +567,49 @@ func (p *Processor[K, T]) processLoop() {
 			// Nop, proceed
 		}
 
-		dueTime = r.DueTime()
-		deadline = dueTime.Sub(p.clock.Now())
+		now := p.clock.Now()
+		if ok {
+			deadline = dueTime.Sub(now)
+		}
+		flush := false
+		if p.batchExecuteFn != nil {
+			// If the item is due and the batch isn't full, add it to the batch
+			// If the deadline is less than 0.5ms away, consider the item due, as that's more efficient than creating a timer
+			if ok && deadline < 500*time.Microsecond && len(p.batch) < p.batchSize {
+				p.addToBatch(r, now)
+				continue
+			}
+			if len(p.batch) > 0 {
+				var flushIn time.Duration
+				flush, flushIn = p.batchReady(now)
+				if !flush && (!ok || flushIn < deadline) {
+					deadline = flushIn
+				}
+			}
+		}
 
 		// If the deadline is less than 0.5ms away, execute it right away
 		// This is more efficient than creating a timer
-		if deadline < 500*time.Microsecond {
-			p.execute(r)
-			continue
+		if flush || deadline < 500*time.Microsecond {
+			// If the rate limit is exceeded, wait until a token is available
+			delay := p.reserve(now)
+			if delay <= 0 {
+				if flush {
+					p.flushBatch()
+				} else {
+					p.execute(r)
+				}
+				continue
+			}
+			deadline = delay
 		}
 
 		t = p.clock.NewTimer(deadline)
 		select {
 		// Wait for when it's time to execute the item
+		// Restart the loop so the item is promoted with all other items that are due, and the one with the highest priority is executed first
 		case <-t.C():
-			p.execute(r)
+			continue
 
 		// If we get a reset signal, restart the loop
 		case <-p.resetCh:
@@ -236,11 +643,219 @@ func (p *Processor[K, T]) execute(r T) {
 		p.lock.Unlock()
 		return
 	}
-	r, ok = p.queue.Pop()
+	item, ok := p.queue.PopItem()
+	if ok {
+		p.inflight++
+	}
+	p.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	if p.workersSem != nil {
+		p.dispatch(item)
+		return
+	}
+
+	err := p.run(item)
+	p.lock.Lock()
+	deadLetter := p.complete(item, err)
+	p.lock.Unlock()
+	if deadLetter && p.deadLetterFn != nil {
+		p.deadLetterFn(item.value, err)
+	}
+}
+
+// Invokes the executor for an item, unless the coordinator determines that another replica executes it.
+// Items owned by another replica are completed without invoking the executor; if the owner is unknown, it returns errOwnershipUnknown.
+// Executions are recorded in the metrics and traced.
+func (p *Processor[K, T]) run(item *queueItem[K, T]) error {
+	switch p.ownership(item) {
+	case NotOwned:
+		return nil
+	case OwnershipUnknown:
+		return errOwnershipUnknown
+	}
+
+	start := p.clock.Now()
+	p.recordLag(start, item)
+
+	ctx, span := p.startExecuteSpan(item)
+	err := p.executeFn(ctx, item.value)
+	p.recordExecution(span, p.clock.Since(start).Seconds(), err)
+
+	return err
+}
+
+// Returns whether the current replica executes the item, according to the coordinator.
+func (p *Processor[K, T]) ownership(item *queueItem[K, T]) Ownership {
+	if p.coordinator == nil {
+		return Owned
+	}
+	return p.coordinator.Ownership(item.value.Key())
+}
+
+// Dispatches an item to a worker.
+// If another item with the same key is being executed, the item is executed by the same worker after that completes.
+// This blocks while all workers are busy.
+func (p *Processor[K, T]) dispatch(item *queueItem[K, T]) {
+	key := item.value.Key()
+
+	p.lock.Lock()
+	pending, ok := p.running[key]
+	if ok {
+		p.running[key] = append(pending, item)
+		p.lock.Unlock()
+		return
+	}
+	p.running[key] = nil
 	p.lock.Unlock()
+
+	p.workersSem <- struct{}{}
+	p.workersWg.Go(func() {
+		defer func() {
+			<-p.workersSem
+		}()
+
+		for item != nil {
+			err := p.run(item)
+
+			p.lock.Lock()
+			deadLetter := p.complete(item, err)
+			r := item.value
+			item = nil
+			pending := p.running[key]
+			if len(pending) == 0 {
+				delete(p.running, key)
+			} else {
+				item = pending[0]
+				p.running[key] = pending[1:]
+			}
+			p.lock.Unlock()
+
+			if deadLetter && p.deadLetterFn != nil {
+				p.deadLetterFn(r, err)
+			}
+		}
+	})
+}
+
+// Completes the execution of an item: if it failed it's re-scheduled when the retry policy allows it, otherwise its next occurrence is enqueued if it's recurring, and it's deleted from the store.
+// Items that were not executed because their owner is unknown (errOwnershipUnknown) are re-scheduled to check the coordinator again.
+// Returns true if the item failed and won't be retried, so it must be sent to the dead-letter callback.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) complete(item *queueItem[K, T], err error) bool {
+	r := item.value
+	key := r.Key()
+
+	p.inflight--
+	p.notifyProgress()
+
+	// If an item with the same key was enqueued while this was being executed, that takes precedence, and this item is not retried nor sent to the dead-letter callback
+	_, queued := p.queue.Get(key)
+	if queued || len(p.running[key]) > 0 {
+		return false
+	}
+
+	if errors.Is(err, errOwnershipUnknown) {
+		p.recheck(item)
+		return false
+	}
+
+	if err != nil && p.retry(item) {
+		return false
+	}
+
+	if !p.enqueueNext(item) {
+		p.deleteFromStore(key)
+	}
+	return err != nil
+}
+
+// Re-schedules an item that failed, if the retry policy allows it.
+// Returns true if the item was re-scheduled, or if the processor is stopped: in that case the item is kept in the store, if any, so it's retried when the queue is rebuilt, and otherwise it's discarded.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) retry(item *queueItem[K, T]) bool {
+	attempt := item.attempt + 1
+	if p.retryPolicy == nil || attempt >= p.retryPolicy.MaxAttempts {
+		return false
+	}
+	if p.stopped.Load() {
+		return true
+	}
+
+	p.queue.InsertRetry(item.value, p.clock.Now().Add(p.retryPolicy.Backoff(attempt)), attempt)
+	if retried, ok := p.queue.Get(item.value.Key()); ok {
+		retried.spanContext = item.spanContext
+	}
+	peek, _ := p.queue.Peek()
+	p.process(peek == item.value)
+	return true
+}
+
+// Re-schedules an item that was not executed because its owner is unknown, so the coordinator is checked again after the recheck interval.
+// The item is kept in the store, and the number of attempts is not changed.
+// If the processor is stopped, the item is only kept in the store, so it's checked again when the queue is rebuilt.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) recheck(item *queueItem[K, T]) {
+	if p.stopped.Load() {
+		return
+	}
+
+	p.queue.InsertRetry(item.value, p.clock.Now().Add(p.recheckInterval), item.attempt)
+	if rechecked, ok := p.queue.Get(item.value.Key()); ok {
+		rechecked.spanContext = item.spanContext
+	}
+	peek, _ := p.queue.Peek()
+	p.process(peek == item.value)
+}
+
+// Enqueues the next occurrence of an item that was executed, if it implements Recurring.
+// If the processor is stopped, the next occurrence is only persisted in the store, so it's scheduled when the queue is rebuilt.
+// Returns true if the record of the executed item must be kept in the store, because it was replaced by the next occurrence or because persisting that failed.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) enqueueNext(item *queueItem[K, T]) bool {
+	r := item.value
+	rec, ok := any(r).(Recurring[T])
+	if !ok {
+		return false
+	}
+
+	next, ok := rec.NextOccurrence(p.clock.Now())
 	if !ok {
+		return false
+	}
+
+	if p.store != nil {
+		// If the next occurrence can't be persisted, keep the item that was executed in the store, so it's executed (and rescheduled) again when the queue is rebuilt
+		err := p.store.Save(next)
+		if err != nil {
+			return true
+		}
+	}
+	if !p.stopped.Load() {
+		// Executions of all occurrences are linked to the span that enqueued the first one
+		p.enqueue(next, item.spanContext)
+	}
+	return next.Key() == r.Key()
+}
+
+// Deletes an item that was executed from the store, if any.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) deleteFromStore(key K) {
+	if p.store == nil {
 		return
 	}
 
-	p.executeFn(r)
+	// Errors are ignored: the item will be executed again when the queue is rebuilt from the store
+	_ = p.store.Delete(key)
+}
+
+// Returns the ItemInfo for the item.
+func (i *queueItem[K, T]) info() ItemInfo[T] {
+	return ItemInfo[T]{
+		Item:     i.value,
+		DueTime:  i.dueTime(),
+		Attempts: i.attempt,
+	}
 }
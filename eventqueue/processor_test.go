@@ -7,6 +7,7 @@ package eventqueue
 
 import (
 	"math/rand"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
@@ -406,3 +407,462 @@ func TestClose(t *testing.T) {
 
 	require.NoError(t, processor.Close())
 }
+
+func TestPersistentProcessor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan *queueableItem, 5)
+	opts := Options[string, *queueableItem]{
+		ExecuteFn: func(r *queueableItem) {
+			executeCh <- r
+		},
+		Clock: clock,
+	}
+
+	assertExecutedItem := func(t *testing.T, expect string) {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			assert.Equal(t, expect, r.Name)
+		case <-time.After(700 * time.Millisecond):
+			t.Fatal("did not receive signal in 700ms")
+		}
+	}
+
+	t.Run("store is required", func(t *testing.T) {
+		_, err := NewPersistentProcessor[string, *queueableItem](opts, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("changes are persisted", func(t *testing.T) {
+		store, err := NewFileStore[string, *queueableItem](FileStoreOptions{Path: path})
+		require.NoError(t, err)
+		defer store.Close()
+
+		processor, err := NewPersistentProcessor(opts, store)
+		require.NoError(t, err)
+		defer processor.Close()
+		assert.Equal(t, 0, processor.Count())
+
+		require.NoError(t, processor.Enqueue(
+			newTestItem(1, clock.Now().Add(time.Second)),
+			newTestItem(2, clock.Now().Add(2*time.Second)),
+			newTestItem(3, clock.Now().Add(time.Hour)),
+			newTestItem(4, clock.Now().Add(3*time.Second)),
+		))
+		require.NoError(t, processor.Dequeue("4"))
+
+		// The store can't record rescheduled due times
+		require.ErrorIs(t, processor.Reschedule("3", clock.Now()), ErrRescheduleNotSupported)
+
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(time.Second)
+		assertExecutedItem(t, "1")
+
+		// Executed items are removed from the store after they're processed
+		assert.Eventually(t, func() bool {
+			items, err := store.Load()
+			return err == nil && len(items) == 2
+		}, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, processor.Close())
+		require.NoError(t, store.Close())
+	})
+
+	t.Run("queue is rebuilt on startup", func(t *testing.T) {
+		// Item 2 is now past due
+		clock.Step(5 * time.Second)
+
+		store, err := NewFileStore[string, *queueableItem](FileStoreOptions{Path: path})
+		require.NoError(t, err)
+		defer store.Close()
+
+		processor, err := NewPersistentProcessor(opts, store)
+		require.NoError(t, err)
+		defer processor.Close()
+
+		// Past-due items are executed right away
+		assertExecutedItem(t, "2")
+		assert.Eventually(t, func() bool {
+			return processor.Count() == 1
+		}, time.Second, 10*time.Millisecond)
+
+		select {
+		case r := <-executeCh:
+			t.Fatalf("received unexpected item: %s", r.Name)
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+
+		clock.Step(time.Hour)
+		assertExecutedItem(t, "3")
+	})
+
+	t.Run("items with the same due time are restored in order", func(t *testing.T) {
+		store, err := NewFileStore[string, *queueableItem](FileStoreOptions{Path: filepath.Join(t.TempDir(), "queue.log")})
+		require.NoError(t, err)
+		defer store.Close()
+
+		dueTime := clock.Now().Add(-time.Second)
+		order := []string{"5", "3", "9", "1", "7"}
+		for _, name := range order {
+			require.NoError(t, store.Save(&queueableItem{Name: name, ExecutionTime: dueTime}))
+		}
+
+		processor, err := NewPersistentProcessor(opts, store)
+		require.NoError(t, err)
+		defer processor.Close()
+
+		for _, name := range order {
+			assertExecutedItem(t, name)
+		}
+	})
+}
+
+func TestProcessorConcurrency(t *testing.T) {
+	type started struct {
+		item    *queueableItem
+		release chan struct{}
+	}
+
+	newProcessor := func(t *testing.T, concurrency int) (*Processor[string, *queueableItem], chan started, *atomic.Int32) {
+		t.Helper()
+
+		startedCh := make(chan started, 10)
+		var maxActive, active atomic.Int32
+		processor := NewProcessor(Options[string, *queueableItem]{
+			ExecuteFn: func(r *queueableItem) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for {
+					m := maxActive.Load()
+					if n <= m || maxActive.CompareAndSwap(m, n) {
+						break
+					}
+				}
+
+				release := make(chan struct{})
+				startedCh <- started{item: r, release: release}
+				<-release
+			},
+			Clock:       clocktesting.NewFakeClock(time.Now()),
+			Concurrency: concurrency,
+		})
+		return processor, startedCh, &maxActive
+	}
+
+	assertStarted := func(t *testing.T, startedCh chan started) started {
+		t.Helper()
+
+		select {
+		case s := <-startedCh:
+			return s
+		case <-time.After(time.Second):
+			t.Fatal("item did not start in 1s")
+		}
+		return started{}
+	}
+
+	assertNotStarted := func(t *testing.T, startedCh chan started) {
+		t.Helper()
+
+		select {
+		case s := <-startedCh:
+			t.Fatalf("item started unexpectedly: %s", s.item.Name)
+		case <-time.After(300 * time.Millisecond):
+			// all good
+		}
+	}
+
+	t.Run("slow items do not block others", func(t *testing.T) {
+		processor, startedCh, _ := newProcessor(t, 2)
+		defer processor.Close()
+
+		now := time.Now()
+		require.NoError(t, processor.Enqueue(newTestItem(1, now)))
+		s1 := assertStarted(t, startedCh)
+		assert.Equal(t, "1", s1.item.Name)
+
+		// Item 1 is still being executed
+		require.NoError(t, processor.Enqueue(newTestItem(2, now)))
+		s2 := assertStarted(t, startedCh)
+		assert.Equal(t, "2", s2.item.Name)
+
+		close(s2.release)
+		close(s1.release)
+	})
+
+	t.Run("concurrency is bounded", func(t *testing.T) {
+		processor, startedCh, maxActive := newProcessor(t, 2)
+		defer processor.Close()
+
+		now := time.Now()
+		for i := 1; i <= 4; i++ {
+			require.NoError(t, processor.Enqueue(newTestItem(i, now)))
+		}
+
+		s1 := assertStarted(t, startedCh)
+		s2 := assertStarted(t, startedCh)
+		assertNotStarted(t, startedCh)
+
+		close(s1.release)
+		s3 := assertStarted(t, startedCh)
+		close(s2.release)
+		s4 := assertStarted(t, startedCh)
+		close(s3.release)
+		close(s4.release)
+
+		assert.Equal(t, int32(2), maxActive.Load())
+	})
+
+	t.Run("items with the same key are not executed concurrently", func(t *testing.T) {
+		processor, startedCh, _ := newProcessor(t, 4)
+		defer processor.Close()
+
+		now := time.Now()
+		require.NoError(t, processor.Enqueue(&queueableItem{Name: "a", ExecutionTime: now}))
+		s1 := assertStarted(t, startedCh)
+
+		// Enqueue the same key again while the first one is running, then another key
+		second := &queueableItem{Name: "a", ExecutionTime: now}
+		require.NoError(t, processor.Enqueue(second))
+		assert.Eventually(t, func() bool {
+			return processor.Count() == 0
+		}, time.Second, 10*time.Millisecond)
+		require.NoError(t, processor.Enqueue(&queueableItem{Name: "b", ExecutionTime: now}))
+
+		sb := assertStarted(t, startedCh)
+		assert.Equal(t, "b", sb.item.Name)
+		assertNotStarted(t, startedCh)
+
+		close(s1.release)
+		s2 := assertStarted(t, startedCh)
+		assert.Same(t, second, s2.item)
+
+		close(s2.release)
+		close(sb.release)
+	})
+
+	t.Run("close drains running items", func(t *testing.T) {
+		processor, startedCh, _ := newProcessor(t, 1)
+
+		now := time.Now()
+		require.NoError(t, processor.Enqueue(newTestItem(1, now), newTestItem(2, now)))
+		s1 := assertStarted(t, startedCh)
+		// Wait for item 2 to be popped from the queue, while it waits for a worker
+		assert.Eventually(t, func() bool {
+			return processor.Count() == 0
+		}, time.Second, 10*time.Millisecond)
+
+		closeCh := make(chan error)
+		go func() {
+			closeCh <- processor.Close()
+		}()
+
+		// Item 2 was already due, so it's executed before Close returns
+		close(s1.release)
+		s2 := assertStarted(t, startedCh)
+		select {
+		case <-closeCh:
+			t.Fatal("close returned before items were drained")
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+
+		close(s2.release)
+		select {
+		case err := <-closeCh:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("close should have returned")
+		}
+	})
+}
+
+func TestProcessorPriority(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan string, 10)
+	processor := NewProcessor(Options[string, *prioritizedItem]{
+		ExecuteFn: func(r *prioritizedItem) {
+			executeCh <- r.Name
+		},
+		Clock: clock,
+	})
+	defer processor.Close()
+
+	// Enqueue items that are all due within 4s
+	now := clock.Now()
+	require.NoError(t, processor.Enqueue(
+		&prioritizedItem{Name: "a", ExecutionTime: now.Add(time.Second)},
+		&prioritizedItem{Name: "b", ExecutionTime: now.Add(2 * time.Second)},
+		&prioritizedItem{Name: "c", ExecutionTime: now.Add(3 * time.Second), Prio: 10},
+		&prioritizedItem{Name: "d", ExecutionTime: now.Add(4 * time.Second), Prio: 5},
+	))
+	assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+
+	// Simulate the processor falling behind: when the clock is moved forward past all items, they're executed by priority
+	clock.SetTime(now.Add(5 * time.Second))
+
+	received := make([]string, 0, 4)
+	for range 4 {
+		select {
+		case name := <-executeCh:
+			received = append(received, name)
+		case <-time.After(time.Second):
+			t.Fatal("did not receive signal in 1s")
+		}
+	}
+	assert.Equal(t, []string{"c", "d", "a", "b"}, received)
+}
+
+func TestProcessorIntrospection(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan *queueableItem, 10)
+	processor := NewProcessor(Options[string, *queueableItem]{
+		ExecuteFn: func(r *queueableItem) {
+			executeCh <- r
+		},
+		Clock: clock,
+	})
+	defer processor.Close()
+
+	assertExecutedItem := func(t *testing.T, expect string) {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			assert.Equal(t, expect, r.Name)
+		case <-time.After(700 * time.Millisecond):
+			t.Fatal("did not receive signal in 700ms")
+		}
+	}
+
+	assertNoExecutedItem := func(t *testing.T) {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			t.Fatalf("received unexpected item: %s", r.Name)
+		case <-time.After(300 * time.Millisecond):
+			// all good
+		}
+	}
+
+	listNames := func(items []ItemInfo[*queueableItem]) []string {
+		names := make([]string, len(items))
+		for i, info := range items {
+			names[i] = info.Item.Name
+		}
+		return names
+	}
+
+	now := clock.Now()
+	for _, n := range []int{3, 1, 5, 2, 4} {
+		require.NoError(t, processor.Enqueue(newTestItem(n, now.Add(time.Duration(n)*time.Minute))))
+	}
+
+	t.Run("get", func(t *testing.T) {
+		info, ok := processor.Get("2")
+		require.True(t, ok)
+		assert.Equal(t, "2", info.Item.Name)
+		assert.True(t, now.Add(2*time.Minute).Equal(info.DueTime))
+		assert.Equal(t, 0, info.Attempts)
+
+		_, ok = processor.Get("99")
+		assert.False(t, ok)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		assert.Equal(t, []string{"1", "2", "3", "4", "5"}, listNames(processor.List(0, 0)))
+		assert.Equal(t, []string{"1", "2"}, listNames(processor.List(0, 2)))
+		assert.Equal(t, []string{"3", "4"}, listNames(processor.List(2, 2)))
+		assert.Equal(t, []string{"5"}, listNames(processor.List(4, 2)))
+		assert.Empty(t, processor.List(5, 2))
+	})
+
+	t.Run("reschedule", func(t *testing.T) {
+		require.NoError(t, processor.Reschedule("4", now.Add(30*time.Second)))
+		require.ErrorIs(t, processor.Reschedule("99", now), ErrItemNotFound)
+
+		info, ok := processor.Get("4")
+		require.True(t, ok)
+		assert.True(t, now.Add(30*time.Second).Equal(info.DueTime))
+		// The item itself is not changed
+		assert.True(t, now.Add(4*time.Minute).Equal(info.Item.DueTime()))
+		assert.Equal(t, []string{"4", "1", "2", "3", "5"}, listNames(processor.List(0, 0)))
+
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(30 * time.Second)
+		assertExecutedItem(t, "4")
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		processor.Pause()
+		assert.True(t, processor.IsPaused())
+
+		// Items that become due while paused are not executed
+		assert.Eventually(t, func() bool {
+			return !clock.HasWaiters()
+		}, time.Second, 10*time.Millisecond)
+		clock.SetTime(now.Add(time.Minute))
+		require.NoError(t, processor.Enqueue(newTestItem(0, now)))
+		assertNoExecutedItem(t)
+		assert.Equal(t, 5, processor.Count())
+
+		// Both items are overdue, so they're executed in the order they were enqueued
+		processor.Resume()
+		assert.False(t, processor.IsPaused())
+		assertExecutedItem(t, "1")
+		assertExecutedItem(t, "0")
+		assertNoExecutedItem(t)
+		assert.Equal(t, []string{"2", "3", "5"}, listNames(processor.List(0, 0)))
+	})
+}
+
+func TestProcessorIntrospectionConcurrent(t *testing.T) {
+	backends := map[string]QueueBackend{
+		"heap":        QueueBackendHeap,
+		"timingwheel": QueueBackendTimingWheel,
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			clock := clocktesting.NewFakeClock(time.Now())
+			processor := NewProcessor(Options[string, *queueableItem]{
+				ExecuteFn:    func(r *queueableItem) {},
+				Clock:        clock,
+				QueueBackend: backend,
+			})
+			defer processor.Close()
+
+			// Items are far in the future so they're not executed
+			now := clock.Now()
+			for n := range 10 {
+				require.NoError(t, processor.Enqueue(newTestItem(n, now.Add(time.Hour))))
+			}
+
+			// List items while they're being replaced and rescheduled; this is meant to be run with -race
+			var wg sync.WaitGroup
+			wg.Go(func() {
+				for i := range 200 {
+					_ = processor.Enqueue(newTestItem(i%10, now.Add(time.Hour+time.Duration(i)*time.Second)))
+				}
+			})
+			wg.Go(func() {
+				for i := range 200 {
+					_ = processor.Reschedule(strconv.Itoa(i%10), now.Add(2*time.Hour+time.Duration(i)*time.Second))
+				}
+			})
+			wg.Go(func() {
+				for range 200 {
+					for _, info := range processor.List(0, 0) {
+						assert.False(t, info.DueTime.IsZero())
+					}
+				}
+			})
+			wg.Wait()
+
+			assert.Len(t, processor.List(0, 0), 10)
+		})
+	}
+}
@@ -6,7 +6,10 @@ package eventqueue
 
 import (
 	"container/heap"
+	"slices"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Queueable is the interface for items that can be added to the queue.
@@ -16,26 +19,83 @@ type Queueable[T comparable] interface {
 	DueTime() time.Time
 }
 
+// Prioritized can be implemented by Queueable items to set their priority.
+// Items that are due at the same time, or that are overdue, are executed in order of priority (higher values first), then in the order they were enqueued.
+// Items that don't implement this interface have priority 0.
+type Prioritized interface {
+	Priority() int
+}
+
+// QueueBackend is the data structure that stores the items in the queue.
+type QueueBackend int
+
+const (
+	// QueueBackendHeap stores items in a binary heap, which is efficient for most queues.
+	QueueBackendHeap QueueBackend = iota
+	// QueueBackendTimingWheel stores items in a hierarchical timing wheel, which has a lower overhead per item, and inserting and removing items takes constant time.
+	// It's more efficient for very large queues.
+	QueueBackendTimingWheel
+)
+
+// itemQueue is the interface implemented by the backends for the queue.
+// Note: implementations are not safe for concurrent use.
+type itemQueue[K comparable, T Queueable[K]] interface {
+	Len() int
+	Promote(now time.Time)
+	Insert(r T, replace bool)
+	InsertRetry(r T, retryAt time.Time, attempt int) bool
+	PopItem() (*queueItem[K, T], bool)
+	Peek() (T, bool)
+	PeekDueTime() (T, time.Time, bool)
+	Remove(key K)
+	Reschedule(key K, dueTime time.Time) bool
+	Get(key K) (*queueItem[K, T], bool)
+	Items() []*queueItem[K, T]
+}
+
+// Returns a new itemQueue with the given backend.
+func newItemQueue[K comparable, T Queueable[K]](backend QueueBackend) itemQueue[K, T] {
+	if backend == QueueBackendTimingWheel {
+		return newWheelQueue[K, T]()
+	}
+	q := newQueue[K, T]()
+	return &q
+}
+
 // queue implements a queue for items that are due to be executed at a later time.
 // It acts as a "priority queue", in which items are added in order of when they're due.
 // Internally, it uses a heap (from container/heap) that allows Insert and Pop operations to be completed in O(log N) time (where N is the queue's length).
+// Items that are due are moved to a second heap with Promote, where they're ordered by priority and then by insertion order.
 // Note: methods in this struct are not safe for concurrent use. Callers should use locks to ensure consistency.
 type queue[K comparable, T Queueable[K]] struct {
 	heap  *queueHeap[K, T]
+	ready *readyHeap[K, T]
 	items map[K]*queueItem[K, T]
+	// Sequence number for the next item that is inserted
+	seq uint64
 }
 
 // newQueue creates a new queue.
 func newQueue[K comparable, T Queueable[K]]() queue[K, T] {
 	return queue[K, T]{
 		heap:  new(queueHeap[K, T]),
+		ready: new(readyHeap[K, T]),
 		items: make(map[K]*queueItem[K, T]),
 	}
 }
 
 // Len returns the number of items in the queue.
 func (p *queue[K, T]) Len() int {
-	return p.heap.Len()
+	return p.heap.Len() + p.ready.Len()
+}
+
+// Promote moves all items that are due at or before now to the heap of items that are ready to be executed.
+func (p *queue[K, T]) Promote(now time.Time) {
+	for p.heap.Len() > 0 && !(*p.heap)[0].dueTime().After(now) {
+		item := heap.Pop(p.heap).(*queueItem[K, T]) //nolint:forcetypeassert
+		item.ready = true
+		heap.Push(p.ready, item)
+	}
 }
 
 // Insert inserts a new item into the queue.
@@ -47,8 +107,12 @@ func (p *queue[K, T]) Insert(r T, replace bool) {
 	item, ok := p.items[key]
 	if ok {
 		if replace {
+			// Replacing an item counts as a new insertion
+			p.remove(item)
 			item.value = r
-			heap.Fix(p.heap, item.index)
+			item.dueAt = time.Time{}
+			item.attempt = 0
+			p.push(item)
 		}
 		return
 	}
@@ -56,37 +120,88 @@ func (p *queue[K, T]) Insert(r T, replace bool) {
 	item = &queueItem[K, T]{
 		value: r,
 	}
-	heap.Push(p.heap, item)
+	p.push(item)
 	p.items[key] = item
 }
 
+// InsertRetry inserts an item that is to be retried at the given time, which is used in place of the item's due time.
+// attempt is the number of times the item was already executed.
+// If an item with the same key already exists, this is a nop and returns false.
+func (p *queue[K, T]) InsertRetry(r T, retryAt time.Time, attempt int) bool {
+	key := r.Key()
+	if _, ok := p.items[key]; ok {
+		return false
+	}
+
+	item := &queueItem[K, T]{
+		value:   r,
+		dueAt:   retryAt,
+		attempt: attempt,
+	}
+	p.push(item)
+	p.items[key] = item
+	return true
+}
+
 // Pop removes the next item in the queue and returns it.
 // The returned boolean value will be "true" if an item was found.
 func (p *queue[K, T]) Pop() (T, bool) {
-	if p.Len() == 0 {
+	item, ok := p.PopItem()
+	if !ok {
 		var zero T
 		return zero, false
 	}
+	return item.value, true
+}
+
+// PopItem is like Pop, but it returns the queueItem, which includes the retry information.
+func (p *queue[K, T]) PopItem() (*queueItem[K, T], bool) {
+	var h heap.Interface = p.heap
+	if p.ready.Len() > 0 {
+		h = p.ready
+	} else if p.heap.Len() == 0 {
+		return nil, false
+	}
 
-	item, ok := heap.Pop(p.heap).(*queueItem[K, T])
+	item, ok := heap.Pop(h).(*queueItem[K, T])
 	if !ok || item == nil {
-		var zero T
-		return zero, false
+		return nil, false
 	}
 
 	delete(p.items, item.value.Key())
-	return item.value, true
+	return item, true
 }
 
 // Peek returns the next item in the queue, without removing it.
 // The returned boolean value will be "true" if an item was found.
 func (p *queue[K, T]) Peek() (T, bool) {
-	if p.Len() == 0 {
+	item, ok := p.head()
+	if !ok {
 		var zero T
 		return zero, false
 	}
+	return item.value, true
+}
+
+// PeekDueTime is like Peek, but it also returns the time the item is due at, which is the retry time for items being retried.
+func (p *queue[K, T]) PeekDueTime() (T, time.Time, bool) {
+	item, ok := p.head()
+	if !ok {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return item.value, item.dueTime(), true
+}
 
-	return (*p.heap)[0].value, true
+// Returns the next item in the queue: the first one that is ready, if any, or the first one in order of due time.
+func (p *queue[K, T]) head() (*queueItem[K, T], bool) {
+	if p.ready.Len() > 0 {
+		return p.ready.queueHeap[0], true
+	}
+	if p.heap.Len() > 0 {
+		return (*p.heap)[0], true
+	}
+	return nil, false
 }
 
 // Remove an item from the queue.
@@ -97,7 +212,7 @@ func (p *queue[K, T]) Remove(key K) {
 		return
 	}
 
-	heap.Remove(p.heap, item.index)
+	p.remove(item)
 	delete(p.items, key)
 }
 
@@ -110,14 +225,118 @@ func (p *queue[K, T]) Update(r T) {
 	}
 
 	item.value = r
-	heap.Fix(p.heap, item.index)
+	item.priority = priorityOf(r)
+	p.fix(item)
+}
+
+// Reschedule changes the time an item is due at, without replacing it.
+// Returns false if the item is not in the queue.
+func (p *queue[K, T]) Reschedule(key K, dueTime time.Time) bool {
+	item, ok := p.items[key]
+	if !ok {
+		return false
+	}
+
+	item.dueAt = dueTime
+	p.fix(item)
+	return true
+}
+
+// Get returns the item with the given key.
+func (p *queue[K, T]) Get(key K) (*queueItem[K, T], bool) {
+	item, ok := p.items[key]
+	return item, ok
+}
+
+// Items returns all items in the queue, in the order they are to be executed.
+func (p *queue[K, T]) Items() []*queueItem[K, T] {
+	ready := slices.Clone(p.ready.queueHeap)
+	slices.SortFunc(ready, func(a, b *queueItem[K, T]) int {
+		if a.beforeInReady(b) {
+			return -1
+		}
+		return 1
+	})
+
+	pending := slices.Clone(*p.heap)
+	slices.SortFunc(pending, func(a, b *queueItem[K, T]) int {
+		if a.before(b) {
+			return -1
+		}
+		return 1
+	})
+
+	return append(ready, pending...)
+}
+
+// Restores the heap ordering after an item's due time or priority changed.
+// Items that are ready are moved back to the heap ordered by due time, as they may not be due anymore; Promote moves them back if they are.
+func (p *queue[K, T]) fix(item *queueItem[K, T]) {
+	if item.ready {
+		heap.Remove(p.ready, item.index)
+		item.ready = false
+		heap.Push(p.heap, item)
+	} else {
+		heap.Fix(p.heap, item.index)
+	}
+}
+
+// Adds an item to the heap ordered by due time, assigning it a new sequence number.
+func (p *queue[K, T]) push(item *queueItem[K, T]) {
+	item.seq = p.seq
+	p.seq++
+	item.priority = priorityOf(item.value)
+	item.ready = false
+	heap.Push(p.heap, item)
+}
+
+// Removes an item from the heap it's in.
+func (p *queue[K, T]) remove(item *queueItem[K, T]) {
+	if item.ready {
+		heap.Remove(p.ready, item.index)
+	} else {
+		heap.Remove(p.heap, item.index)
+	}
+}
+
+// Returns the priority of an item, or 0 if it doesn't implement Prioritized.
+func priorityOf(r any) int {
+	if pr, ok := r.(Prioritized); ok {
+		return pr.Priority()
+	}
+	return 0
 }
 
 type queueItem[K comparable, T Queueable[K]] struct {
 	value T
 
 	// The index of the item in the heap. This is maintained by the heap.Interface methods.
+	// In the timing wheel, this is the position of the slot for items that are not ready.
 	index int
+	// Adjacent items in the same slot of the timing wheel
+	prev, next *queueItem[K, T]
+
+	// If set, this is used in place of the item's due time, because the item is being retried or it was rescheduled
+	dueAt time.Time
+	// Number of times the item was already executed
+	attempt int
+
+	// Priority of the item, cached from the value
+	priority int
+	// Sequence number, which reflects the order in which items were inserted
+	seq uint64
+	// If true, the item is in the heap of items that are ready to be executed
+	ready bool
+	// Context of the span that enqueued the item, if any
+	spanContext trace.SpanContext
+}
+
+// Returns the time the item is due at.
+func (i *queueItem[K, T]) dueTime() time.Time {
+	if !i.dueAt.IsZero() {
+		return i.dueAt
+	}
+	return i.value.DueTime()
 }
 
 type queueHeap[K comparable, T Queueable[K]] []*queueItem[K, T]
@@ -127,7 +346,7 @@ func (pq queueHeap[K, T]) Len() int {
 }
 
 func (pq queueHeap[K, T]) Less(i, j int) bool {
-	return pq[i].value.DueTime().Before(pq[j].value.DueTime())
+	return pq[i].before(pq[j])
 }
 
 func (pq queueHeap[K, T]) Swap(i, j int) {
@@ -152,3 +371,29 @@ func (pq *queueHeap[K, T]) Pop() any {
 	*pq = old[0 : n-1]
 	return item
 }
+
+// readyHeap is a heap of items that are due, ordered by priority and then by insertion order.
+type readyHeap[K comparable, T Queueable[K]] struct {
+	queueHeap[K, T]
+}
+
+func (pq readyHeap[K, T]) Less(i, j int) bool {
+	return pq.queueHeap[i].beforeInReady(pq.queueHeap[j])
+}
+
+// Returns true if the item is to be executed before other: items that are due first go first, then the order is the same as for items that are ready.
+func (i *queueItem[K, T]) before(other *queueItem[K, T]) bool {
+	a, b := i.dueTime(), other.dueTime()
+	if !a.Equal(b) {
+		return a.Before(b)
+	}
+	return i.beforeInReady(other)
+}
+
+// Returns true if the item is to be executed before other when both are due: items with a higher priority go first, then items that were inserted first.
+func (i *queueItem[K, T]) beforeInReady(other *queueItem[K, T]) bool {
+	if i.priority != other.priority {
+		return i.priority > other.priority
+	}
+	return i.seq < other.seq
+}
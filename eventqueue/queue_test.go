@@ -305,3 +305,95 @@ func peekAndCompare(t *testing.T, q *queue[string, *queueableItem], expectN int,
 	assert.Equal(t, strconv.Itoa(expectN), r.Name)
 	assert.Equal(t, expectDueTime, r.DueTime().Format(time.RFC3339))
 }
+
+// prioritizedItem is a queueable item with a priority, used for testing.
+type prioritizedItem struct {
+	Name          string
+	ExecutionTime time.Time
+	Prio          int
+}
+
+func (r *prioritizedItem) Key() string {
+	return r.Name
+}
+
+func (r *prioritizedItem) DueTime() time.Time {
+	return r.ExecutionTime
+}
+
+func (r *prioritizedItem) Priority() int {
+	return r.Prio
+}
+
+func TestQueuePriority(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	popNames := func(t *testing.T, q *queue[string, *prioritizedItem]) []string {
+		t.Helper()
+		names := []string{}
+		for {
+			r, ok := q.Pop()
+			if !ok {
+				return names
+			}
+			names = append(names, r.Name)
+		}
+	}
+
+	t.Run("items due at the same time are ordered by priority, then insertion order", func(t *testing.T) {
+		q := newQueue[string, *prioritizedItem]()
+		q.Insert(&prioritizedItem{Name: "a", ExecutionTime: base}, false)
+		q.Insert(&prioritizedItem{Name: "b", ExecutionTime: base, Prio: 10}, false)
+		q.Insert(&prioritizedItem{Name: "c", ExecutionTime: base}, false)
+		q.Insert(&prioritizedItem{Name: "d", ExecutionTime: base, Prio: 10}, false)
+		q.Insert(&prioritizedItem{Name: "e", ExecutionTime: base.Add(-time.Second), Prio: -1}, false)
+		q.Insert(&prioritizedItem{Name: "f", ExecutionTime: base.Add(time.Second), Prio: 100}, false)
+
+		assert.Equal(t, []string{"e", "b", "d", "a", "c", "f"}, popNames(t, &q))
+	})
+
+	t.Run("overdue items are ordered by priority, then insertion order", func(t *testing.T) {
+		q := newQueue[string, *prioritizedItem]()
+		q.Insert(&prioritizedItem{Name: "a", ExecutionTime: base.Add(3 * time.Second)}, false)
+		q.Insert(&prioritizedItem{Name: "b", ExecutionTime: base.Add(2 * time.Second), Prio: 5}, false)
+		q.Insert(&prioritizedItem{Name: "c", ExecutionTime: base.Add(time.Second)}, false)
+		q.Insert(&prioritizedItem{Name: "d", ExecutionTime: base.Add(time.Hour), Prio: 100}, false)
+		q.Insert(&prioritizedItem{Name: "e", ExecutionTime: base}, false)
+
+		q.Promote(base.Add(5 * time.Second))
+		require.Equal(t, 5, q.Len())
+		peek, ok := q.Peek()
+		require.True(t, ok)
+		assert.Equal(t, "b", peek.Name)
+
+		// Items that are not due are not promoted
+		assert.Equal(t, []string{"b", "a", "c", "e", "d"}, popNames(t, &q))
+	})
+
+	t.Run("replacing an item counts as a new insertion", func(t *testing.T) {
+		q := newQueue[string, *prioritizedItem]()
+		q.Insert(&prioritizedItem{Name: "a", ExecutionTime: base}, false)
+		q.Insert(&prioritizedItem{Name: "b", ExecutionTime: base}, false)
+		q.Promote(base)
+		q.Insert(&prioritizedItem{Name: "a", ExecutionTime: base}, true)
+		q.Promote(base)
+
+		assert.Equal(t, []string{"b", "a"}, popNames(t, &q))
+	})
+
+	t.Run("updated items are moved back when not due anymore", func(t *testing.T) {
+		q := newQueue[string, *prioritizedItem]()
+		q.Insert(&prioritizedItem{Name: "a", ExecutionTime: base, Prio: 1}, false)
+		q.Insert(&prioritizedItem{Name: "b", ExecutionTime: base}, false)
+		q.Promote(base)
+
+		q.Update(&prioritizedItem{Name: "a", ExecutionTime: base.Add(time.Minute), Prio: 1})
+		q.Promote(base)
+		peek, ok := q.Peek()
+		require.True(t, ok)
+		assert.Equal(t, "b", peek.Name)
+
+		q.Remove("b")
+		assert.Equal(t, []string{"a"}, popNames(t, &q))
+	})
+}
@@ -0,0 +1,26 @@
+package eventqueue
+
+import (
+	"time"
+
+	"github.com/italypaleale/go-kit/internal/ratelimit"
+)
+
+// RateLimit configures a token bucket that limits how often the executor is invoked.
+// Events is the number of executions in each Period.
+type RateLimit = ratelimit.Limit
+
+// Takes a token from the rate limiter, if any.
+// If no token is available, it returns the delay after which one will be.
+func (p *Processor[K, T]) reserve(now time.Time) time.Duration {
+	if p.limiter == nil {
+		return 0
+	}
+
+	res := p.limiter.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		res.CancelAt(now)
+	}
+	return delay
+}
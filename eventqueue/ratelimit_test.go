@@ -0,0 +1,65 @@
+package eventqueue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestProcessorRateLimit(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan string, 10)
+	processor := NewProcessor(Options[string, *queueableItem]{
+		ExecuteFn: func(r *queueableItem) {
+			executeCh <- r.Name
+		},
+		RateLimit: &RateLimit{Events: 2, Period: time.Minute},
+		Clock:     clock,
+	})
+	defer processor.Close()
+
+	assertExecuted := func(t *testing.T, expect string) {
+		t.Helper()
+
+		select {
+		case name := <-executeCh:
+			assert.Equal(t, expect, name)
+		case <-time.After(time.Second):
+			t.Fatalf("item %s was not executed in 1s", expect)
+		}
+	}
+
+	assertNotExecuted := func(t *testing.T) {
+		t.Helper()
+
+		select {
+		case name := <-executeCh:
+			t.Fatalf("item %s was executed unexpectedly", name)
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+	}
+
+	// Enqueue 4 items that are due now: the first 2 are executed right away, as the burst allows them
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, processor.Enqueue(newTestItem(i, clock.Now())))
+	}
+	assertExecuted(t, "1")
+	assertExecuted(t, "2")
+	assertNotExecuted(t)
+
+	// A token is available every 30s
+	for i := 3; i <= 4; i++ {
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(15 * time.Second)
+		assertNotExecuted(t)
+
+		clock.Step(15 * time.Second)
+		assertExecuted(t, strconv.Itoa(i))
+	}
+	assert.Equal(t, 0, processor.Count())
+}
@@ -0,0 +1,176 @@
+package eventqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Recurring is implemented by items that are executed on a recurring schedule.
+// After an item that implements this interface is executed, the processor invokes NextOccurrence and, if it returns true, enqueues the returned item.
+// If an item with the same key was enqueued while the item was being executed, that takes precedence and the next occurrence is discarded.
+//
+// Implementations can use a Recurrence to compute the time of the next occurrence.
+type Recurring[T any] interface {
+	// NextOccurrence returns the item for the next occurrence, which should have the same key.
+	// now is the current time, according to the processor's clock.
+	// The returned boolean value is false if there are no more occurrences.
+	NextOccurrence(now time.Time) (T, bool)
+}
+
+// Schedule is the interface for recurring schedules.
+// The schedules in this package implement fmt.Stringer, returning a value that can be parsed with ParseSchedule.
+type Schedule interface {
+	// Next returns the first occurrence strictly after the given time.
+	// It returns the zero time if there are no more occurrences.
+	Next(after time.Time) time.Time
+}
+
+// Recurrence contains the state of a recurring item.
+type Recurrence struct {
+	// Schedule of the item
+	Schedule Schedule
+	// Maximum number of times the item is executed
+	// If 0, there's no limit
+	MaxRepetitions int
+	// If non-zero, the item is not executed after this time
+	EndTime time.Time
+	// Number of times the item has been executed so far
+	Count int
+}
+
+// Next returns the state for the next occurrence, and the time it's due at, after an item that was due at dueTime was executed.
+// The next occurrence is computed from the later of dueTime and now, so occurrences that were missed (for example, because the processor was not running) are skipped.
+// The returned boolean value is false if there are no more occurrences.
+func (r Recurrence) Next(dueTime time.Time, now time.Time) (Recurrence, time.Time, bool) {
+	if r.Schedule == nil {
+		return r, time.Time{}, false
+	}
+
+	r.Count++
+	if r.MaxRepetitions > 0 && r.Count >= r.MaxRepetitions {
+		return r, time.Time{}, false
+	}
+
+	after := dueTime
+	if now.After(after) {
+		after = now
+	}
+	next := r.Schedule.Next(after)
+	if next.IsZero() || (!r.EndTime.IsZero() && next.After(r.EndTime)) {
+		return r, time.Time{}, false
+	}
+
+	return r, next, true
+}
+
+// MarshalJSON implements json.Marshaler.
+// The schedule is serialized as a string, so it must implement fmt.Stringer and be parseable with ParseSchedule.
+func (r Recurrence) MarshalJSON() ([]byte, error) {
+	var obj recurrenceJSON
+	if r.Schedule != nil {
+		stringer, ok := r.Schedule.(fmt.Stringer)
+		if !ok {
+			return nil, errors.New("schedule does not implement fmt.Stringer")
+		}
+		obj.Schedule = stringer.String()
+	}
+	obj.MaxRepetitions = r.MaxRepetitions
+	if !r.EndTime.IsZero() {
+		obj.EndTime = &r.EndTime
+	}
+	obj.Count = r.Count
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Recurrence) UnmarshalJSON(data []byte) error {
+	var obj recurrenceJSON
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return err
+	}
+
+	*r = Recurrence{
+		MaxRepetitions: obj.MaxRepetitions,
+		Count:          obj.Count,
+	}
+	if obj.Schedule != "" {
+		r.Schedule, err = ParseSchedule(obj.Schedule)
+		if err != nil {
+			return err
+		}
+	}
+	if obj.EndTime != nil {
+		r.EndTime = *obj.EndTime
+	}
+	return nil
+}
+
+type recurrenceJSON struct {
+	Schedule       string     `json:"schedule,omitempty"`
+	MaxRepetitions int        `json:"maxRepetitions,omitempty"`
+	EndTime        *time.Time `json:"endTime,omitempty"`
+	Count          int        `json:"count,omitempty"`
+}
+
+// ParseSchedule parses a schedule, which can be:
+//
+//   - "@every <duration>", for a fixed interval from the time of the previous occurrence, where the duration is in the format accepted by time.ParseDuration
+//   - "R/<start>/<duration>" or "R/<start>/<end>", for an ISO 8601 repeating interval (see ParseRepeatingInterval)
+//   - a cron expression (see ParseCron), optionally prefixed with "CRON_TZ=<time zone> " to set the time zone (the default is UTC)
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule '%s': invalid interval", spec)
+		}
+		return Every(time.Time{}, d), nil
+	}
+
+	if strings.HasPrefix(spec, "R") && strings.Contains(spec, "/") {
+		if strings.Count(spec, "/") != 2 || strings.HasPrefix(spec, "R/P") {
+			return nil, fmt.Errorf("invalid schedule '%s': repeating intervals must include the start time", spec)
+		}
+		rec, _, err := ParseRepeatingInterval(spec, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if rec.MaxRepetitions != 0 {
+			return nil, fmt.Errorf("invalid schedule '%s': the number of repetitions is not part of the schedule", spec)
+		}
+		return rec.Schedule, nil
+	}
+
+	return ParseCron(spec, nil)
+}
+
+// Every returns a Schedule that repeats at a fixed interval, with occurrences at start, start+interval, start+2*interval, etc.
+// If start is the zero time, occurrences are interval apart from the time passed to Next.
+func Every(start time.Time, interval time.Duration) Schedule {
+	if interval <= 0 {
+		panic("invalid interval: must be greater than 0")
+	}
+	if !start.IsZero() {
+		return isoSchedule{start: start, dur: isoDuration{clock: interval}}
+	}
+	return intervalSchedule{interval: interval}
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Next implements Schedule.
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(s.interval)
+}
+
+// String implements fmt.Stringer.
+func (s intervalSchedule) String() string {
+	return "@every " + s.interval.String()
+}
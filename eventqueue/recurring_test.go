@@ -0,0 +1,256 @@
+package eventqueue
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// recurringItem is a recurring item that can be queued and it's used for testing.
+type recurringItem struct {
+	Name          string
+	ExecutionTime time.Time
+	Recurrence    Recurrence
+}
+
+func (r *recurringItem) Key() string {
+	return r.Name
+}
+
+func (r *recurringItem) DueTime() time.Time {
+	return r.ExecutionTime
+}
+
+func (r *recurringItem) NextOccurrence(now time.Time) (*recurringItem, bool) {
+	rec, next, ok := r.Recurrence.Next(r.ExecutionTime, now)
+	if !ok {
+		return nil, false
+	}
+	return &recurringItem{Name: r.Name, ExecutionTime: next, Recurrence: rec}, true
+}
+
+func TestRecurrence(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("next occurrence", func(t *testing.T) {
+		rec := Recurrence{Schedule: Every(start, time.Minute)}
+		rec, next, ok := rec.Next(start, start)
+		require.True(t, ok)
+		assert.Equal(t, start.Add(time.Minute), next)
+		assert.Equal(t, 1, rec.Count)
+	})
+
+	t.Run("missed occurrences are skipped", func(t *testing.T) {
+		rec := Recurrence{Schedule: Every(start, time.Minute)}
+		_, next, ok := rec.Next(start, start.Add(150*time.Second))
+		require.True(t, ok)
+		assert.Equal(t, start.Add(3*time.Minute), next)
+	})
+
+	t.Run("max repetitions", func(t *testing.T) {
+		rec := Recurrence{Schedule: Every(start, time.Minute), MaxRepetitions: 3}
+		due := start
+		var ok bool
+		for range 2 {
+			rec, due, ok = rec.Next(due, due)
+			require.True(t, ok)
+		}
+		_, _, ok = rec.Next(due, due)
+		assert.False(t, ok)
+		assert.Equal(t, 2, rec.Count)
+	})
+
+	t.Run("end time", func(t *testing.T) {
+		rec := Recurrence{Schedule: Every(start, time.Minute), EndTime: start.Add(time.Minute)}
+		rec, due, ok := rec.Next(start, start)
+		require.True(t, ok)
+		_, _, ok = rec.Next(due, due)
+		assert.False(t, ok)
+	})
+
+	t.Run("no schedule", func(t *testing.T) {
+		_, _, ok := Recurrence{}.Next(start, start)
+		assert.False(t, ok)
+	})
+}
+
+func TestEvery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s := Every(start, 10*time.Second)
+	assert.Equal(t, start, s.Next(start.Add(-time.Hour)))
+	assert.Equal(t, start.Add(10*time.Second), s.Next(start))
+	assert.Equal(t, start.Add(20*time.Second), s.Next(start.Add(15*time.Second)))
+	assert.Equal(t, start.Add(30*time.Second), s.Next(start.Add(20*time.Second)))
+
+	s = Every(time.Time{}, 10*time.Second)
+	assert.Equal(t, start.Add(17*time.Second), s.Next(start.Add(7*time.Second)))
+
+	assert.Panics(t, func() {
+		Every(start, 0)
+	})
+}
+
+func TestParseSchedule(t *testing.T) {
+	t.Run("valid schedules", func(t *testing.T) {
+		for _, spec := range []string{
+			"@every 1m30s",
+			"R/2024-01-01T00:00:00Z/P1DT12H",
+			"R/2024-01-01T00:00:00.5+01:00/PT1S",
+			"*/5 * * * *",
+			"@hourly",
+			"CRON_TZ=America/New_York 0 9 * * MON-FRI",
+		} {
+			s, err := ParseSchedule(spec)
+			require.NoError(t, err, spec)
+			assert.Equal(t, spec, s.(interface{ String() string }).String())
+		}
+	})
+
+	t.Run("invalid schedules", func(t *testing.T) {
+		for _, spec := range []string{
+			"@every 0s",
+			"@every x",
+			"R/P1D",
+			"R5/2024-01-01T00:00:00Z/P1D",
+			"R/2024-01-01T00:00:00Z",
+			"* * *",
+		} {
+			_, err := ParseSchedule(spec)
+			require.Error(t, err, spec)
+		}
+	})
+}
+
+func TestRecurrenceJSON(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("round trip", func(t *testing.T) {
+		cron, err := ParseCron("0 * * * *", nil)
+		require.NoError(t, err)
+
+		for _, rec := range []Recurrence{
+			{Schedule: Every(start, time.Minute), MaxRepetitions: 10, Count: 2},
+			{Schedule: Every(time.Time{}, time.Hour), EndTime: start.Add(24 * time.Hour)},
+			{Schedule: cron},
+			{},
+		} {
+			data, err := json.Marshal(rec)
+			require.NoError(t, err)
+
+			var decoded Recurrence
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, rec.MaxRepetitions, decoded.MaxRepetitions)
+			assert.Equal(t, rec.Count, decoded.Count)
+			assert.True(t, rec.EndTime.Equal(decoded.EndTime))
+			if rec.Schedule == nil {
+				assert.Nil(t, decoded.Schedule)
+			} else {
+				assert.Equal(t, rec.Schedule.Next(start), decoded.Schedule.Next(start))
+			}
+		}
+	})
+
+	t.Run("schedule must be serializable", func(t *testing.T) {
+		_, err := json.Marshal(Recurrence{Schedule: customSchedule{}})
+		require.Error(t, err)
+	})
+}
+
+type customSchedule struct{}
+
+func (customSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Second)
+}
+
+func TestProcessorRecurring(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan *recurringItem, 5)
+	processor := NewProcessor(Options[string, *recurringItem]{
+		ExecuteFn: func(r *recurringItem) {
+			executeCh <- r
+		},
+		Clock: clock,
+	})
+	defer processor.Close()
+
+	assertExecutedItem := func(t *testing.T) *recurringItem {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			return r
+		case <-time.After(700 * time.Millisecond):
+			t.Fatal("did not receive signal in 700ms")
+		}
+		return nil
+	}
+
+	start := clock.Now().Add(time.Second)
+	require.NoError(t, processor.Enqueue(&recurringItem{
+		Name:          "a",
+		ExecutionTime: start,
+		Recurrence:    Recurrence{Schedule: Every(start, time.Second), MaxRepetitions: 3},
+	}))
+
+	for i := range 3 {
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		clock.Step(time.Second)
+		r := assertExecutedItem(t)
+		assert.Equal(t, "a", r.Name)
+		assert.True(t, start.Add(time.Duration(i)*time.Second).Equal(r.ExecutionTime))
+		assert.Equal(t, i, r.Recurrence.Count)
+	}
+
+	// After the max number of repetitions, the item isn't enqueued again
+	assert.Eventually(t, func() bool {
+		return processor.Count() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPersistentProcessorRecurring(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan *recurringItem, 5)
+	store, err := NewFileStore[string, *recurringItem](FileStoreOptions{Path: filepath.Join(t.TempDir(), "queue.log")})
+	require.NoError(t, err)
+	defer store.Close()
+
+	processor, err := NewPersistentProcessor(Options[string, *recurringItem]{
+		ExecuteFn: func(r *recurringItem) {
+			executeCh <- r
+		},
+		Clock: clock,
+	}, store)
+	require.NoError(t, err)
+	defer processor.Close()
+
+	start := clock.Now().Add(time.Second)
+	require.NoError(t, processor.Enqueue(&recurringItem{
+		Name:          "a",
+		ExecutionTime: start,
+		Recurrence:    Recurrence{Schedule: Every(start, time.Minute)},
+	}))
+
+	assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+	clock.Step(time.Second)
+	select {
+	case <-executeCh:
+	case <-time.After(700 * time.Millisecond):
+		t.Fatal("did not receive signal in 700ms")
+	}
+
+	// The store contains the next occurrence
+	assert.Eventually(t, func() bool {
+		items, err := store.Load()
+		return err == nil && len(items) == 1 && items[0].ExecutionTime.Equal(start.Add(time.Minute))
+	}, time.Second, 10*time.Millisecond)
+
+	items, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 1, items[0].Recurrence.Count)
+}
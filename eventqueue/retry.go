@@ -0,0 +1,60 @@
+package eventqueue
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy contains the options for retrying items when the executor returns an error.
+// Delays grow exponentially: the n-th retry is delayed by InitialInterval*Multiplier^(n-1), up to MaxInterval, and randomized by Jitter.
+type RetryPolicy struct {
+	// Maximum number of times an item is executed, including the first attempt
+	// If 0 or 1, items are not retried
+	MaxAttempts int
+	// Delay before the first retry
+	// Defaults to 1s
+	InitialInterval time.Duration
+	// Maximum delay between retries
+	// If 0, there's no limit
+	MaxInterval time.Duration
+	// Factor by which the delay grows after each retry
+	// Defaults to 2
+	Multiplier float64
+	// Randomization factor, between 0 and 1
+	// A value of 0.2 means that the delay is randomly chosen between 80% and 120% of the computed value
+	Jitter float64
+}
+
+// Backoff returns the delay before the retry that follows the given attempt, where attempt is the number of times the item was already executed (starting from 1).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	interval := p.InitialInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(interval)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxInterval > 0 && delay >= float64(p.MaxInterval) {
+			break
+		}
+	}
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+
+	if p.Jitter > 0 {
+		jitter := min(p.Jitter, 1)
+		delay *= 1 - jitter + 2*jitter*rand.Float64() //nolint:gosec
+	}
+
+	if delay >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,243 @@
+package eventqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		p := RetryPolicy{}
+		assert.Equal(t, time.Second, p.Backoff(1))
+		assert.Equal(t, 2*time.Second, p.Backoff(2))
+		assert.Equal(t, 8*time.Second, p.Backoff(4))
+	})
+
+	t.Run("max interval", func(t *testing.T) {
+		p := RetryPolicy{InitialInterval: 100 * time.Millisecond, Multiplier: 3, MaxInterval: time.Second}
+		assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+		assert.Equal(t, 300*time.Millisecond, p.Backoff(2))
+		assert.Equal(t, 900*time.Millisecond, p.Backoff(3))
+		assert.Equal(t, time.Second, p.Backoff(4))
+		assert.Equal(t, time.Second, p.Backoff(1000))
+	})
+
+	t.Run("no overflow", func(t *testing.T) {
+		p := RetryPolicy{}
+		assert.Positive(t, p.Backoff(10000))
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		p := RetryPolicy{InitialInterval: time.Second, Jitter: 0.5}
+		for range 100 {
+			d := p.Backoff(1)
+			assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+			assert.LessOrEqual(t, d, 1500*time.Millisecond)
+		}
+	})
+}
+
+func TestProcessorRetry(t *testing.T) {
+	type deadLetter struct {
+		item *queueableItem
+		err  error
+	}
+
+	newProcessor := func(t *testing.T, concurrency int, failures map[string]int) (*Processor[string, *queueableItem], *clocktesting.FakeClock, chan *queueableItem, chan deadLetter) {
+		t.Helper()
+
+		clock := clocktesting.NewFakeClock(time.Now())
+		executeCh := make(chan *queueableItem, 10)
+		deadLetterCh := make(chan deadLetter, 10)
+		processor := NewProcessor(Options[string, *queueableItem]{
+			ExecuteErrFn: func(r *queueableItem) error {
+				executeCh <- r
+				if failures[r.Name] > 0 {
+					failures[r.Name]--
+					return errors.New("simulated failure")
+				}
+				return nil
+			},
+			RetryPolicy: &RetryPolicy{
+				MaxAttempts:     3,
+				InitialInterval: time.Second,
+			},
+			DeadLetterFn: func(r *queueableItem, err error) {
+				deadLetterCh <- deadLetter{item: r, err: err}
+			},
+			Clock:       clock,
+			Concurrency: concurrency,
+		})
+		t.Cleanup(func() { _ = processor.Close() })
+		return processor, clock, executeCh, deadLetterCh
+	}
+
+	assertExecutedItem := func(t *testing.T, executeCh chan *queueableItem, expect string) {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			assert.Equal(t, expect, r.Name)
+		case <-time.After(700 * time.Millisecond):
+			t.Fatal("did not receive signal in 700ms")
+		}
+	}
+
+	assertNoExecutedItem := func(t *testing.T, executeCh chan *queueableItem) {
+		t.Helper()
+
+		select {
+		case r := <-executeCh:
+			t.Fatalf("received unexpected item: %s", r.Name)
+		case <-time.After(200 * time.Millisecond):
+			// all good
+		}
+	}
+
+	for _, concurrency := range []int{0, 2} {
+		t.Run("concurrency "+map[int]string{0: "disabled", 2: "enabled"}[concurrency], func(t *testing.T) {
+			t.Run("items are retried with backoff until they succeed", func(t *testing.T) {
+				processor, clock, executeCh, deadLetterCh := newProcessor(t, concurrency, map[string]int{"1": 2})
+
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now())))
+				assertExecutedItem(t, executeCh, "1")
+
+				// First retry is after 1s
+				assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+				assert.Equal(t, 1, processor.Count())
+				clock.Step(500 * time.Millisecond)
+				assertNoExecutedItem(t, executeCh)
+				clock.Step(500 * time.Millisecond)
+				assertExecutedItem(t, executeCh, "1")
+
+				// Second retry is after 2s
+				assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+				clock.Step(time.Second)
+				assertNoExecutedItem(t, executeCh)
+				clock.Step(time.Second)
+				assertExecutedItem(t, executeCh, "1")
+
+				// The third attempt succeeded
+				assert.Eventually(t, func() bool {
+					return processor.Count() == 0
+				}, time.Second, 10*time.Millisecond)
+				select {
+				case dl := <-deadLetterCh:
+					t.Fatalf("unexpected dead letter: %s", dl.item.Name)
+				default:
+				}
+			})
+
+			t.Run("items are sent to the dead-letter callback when attempts are exhausted", func(t *testing.T) {
+				processor, clock, executeCh, deadLetterCh := newProcessor(t, concurrency, map[string]int{"1": 5})
+
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now())))
+				for i := range 3 {
+					assertExecutedItem(t, executeCh, "1")
+					if i < 2 {
+						assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+						clock.Step(2 * time.Second)
+					}
+				}
+
+				select {
+				case dl := <-deadLetterCh:
+					assert.Equal(t, "1", dl.item.Name)
+					require.EqualError(t, dl.err, "simulated failure")
+				case <-time.After(time.Second):
+					t.Fatal("did not receive dead letter in 1s")
+				}
+				assert.Equal(t, 0, processor.Count())
+				assertNoExecutedItem(t, executeCh)
+			})
+
+			t.Run("items that fail while the processor is closed are not sent to the dead-letter callback", func(t *testing.T) {
+				clock := clocktesting.NewFakeClock(time.Now())
+				executeCh := make(chan *queueableItem, 10)
+				deadLetterCh := make(chan *queueableItem, 10)
+				processor := NewProcessor(Options[string, *queueableItem]{
+					ExecuteContextFn: func(ctx context.Context, r *queueableItem) error {
+						executeCh <- r
+						<-ctx.Done()
+						return ctx.Err()
+					},
+					RetryPolicy: &RetryPolicy{MaxAttempts: 3},
+					DeadLetterFn: func(r *queueableItem, err error) {
+						deadLetterCh <- r
+					},
+					Clock:       clock,
+					Concurrency: concurrency,
+				})
+
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now())))
+				assertExecutedItem(t, executeCh, "1")
+				require.NoError(t, processor.Close())
+
+				select {
+				case r := <-deadLetterCh:
+					t.Fatalf("unexpected dead letter: %s", r.Name)
+				default:
+				}
+			})
+
+			t.Run("items replaced while executing are not sent to the dead-letter callback", func(t *testing.T) {
+				clock := clocktesting.NewFakeClock(time.Now())
+				executeCh := make(chan *queueableItem, 10)
+				releaseCh := make(chan struct{})
+				deadLetterCh := make(chan *queueableItem, 10)
+				processor := NewProcessor(Options[string, *queueableItem]{
+					ExecuteErrFn: func(r *queueableItem) error {
+						executeCh <- r
+						<-releaseCh
+						return errors.New("simulated failure")
+					},
+					DeadLetterFn: func(r *queueableItem, err error) {
+						deadLetterCh <- r
+					},
+					Clock:       clock,
+					Concurrency: concurrency,
+				})
+				t.Cleanup(func() { _ = processor.Close() })
+
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now())))
+				assertExecutedItem(t, executeCh, "1")
+
+				// Enqueue a newer item with the same key while the first one is executing, then make the first one fail
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now().Add(time.Minute))))
+				releaseCh <- struct{}{}
+
+				select {
+				case r := <-deadLetterCh:
+					t.Fatalf("unexpected dead letter: %s", r.Name)
+				case <-time.After(200 * time.Millisecond):
+					// all good
+				}
+				assert.Equal(t, 1, processor.Count())
+				close(releaseCh)
+			})
+
+			t.Run("enqueueing the item again resets the attempts", func(t *testing.T) {
+				processor, clock, executeCh, _ := newProcessor(t, concurrency, map[string]int{"1": 1})
+
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now())))
+				assertExecutedItem(t, executeCh, "1")
+				assert.Eventually(t, func() bool {
+					return processor.Count() == 1
+				}, time.Second, 10*time.Millisecond)
+
+				// Replace the item being retried with one due in 10s
+				require.NoError(t, processor.Enqueue(newTestItem(1, clock.Now().Add(10*time.Second))))
+				clock.Step(time.Second)
+				assertNoExecutedItem(t, executeCh)
+				clock.Step(9 * time.Second)
+				assertExecutedItem(t, executeCh, "1")
+			})
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package eventqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Shutdown stops the processor gracefully.
+// Items can't be enqueued after Shutdown is invoked.
+// If Options.DrainOnShutdown is true, it first waits until all items that are due before the deadline of ctx (or, if ctx has no deadline, the items that are already due) have been executed, or until ctx is canceled.
+// Then it stops the processor like Close, and invokes Options.RemainingFn with the items that were not executed.
+// Returns the error from ctx if the queue could not be drained before ctx was canceled.
+func (p *Processor[K, T]) Shutdown(ctx context.Context) error {
+	if p.stopped.Load() || !p.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	var err error
+	if p.drainOnShutdown {
+		err = p.drain(ctx)
+	}
+
+	_ = p.Close()
+
+	if p.remainingFn != nil {
+		p.remainingFn(p.remaining())
+	}
+
+	return err
+}
+
+// Run blocks until ctx is canceled, then stops the processor with Shutdown, waiting up to Options.ShutdownTimeout for it to complete.
+// It returns right away if the processor is closed.
+// It can be used as a servicerunner.Service.
+func (p *Processor[K, T]) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-p.stopCh:
+		return nil
+	}
+
+	shutdownCtx := context.Background()
+	if p.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, p.shutdownTimeout)
+		defer cancel()
+	}
+
+	err := p.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("failed to drain queue: %w", err)
+	}
+	return nil
+}
+
+// Waits until all items due before the deadline of ctx have been executed.
+func (p *Processor[K, T]) drain(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = p.clock.Now()
+	}
+
+	for {
+		p.lock.Lock()
+		done := p.drained(deadline)
+		p.lock.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-p.progressCh:
+			// Check again
+		case <-p.stopCh:
+			// The processor was closed
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Returns true if no items are being executed, and no items in the queue are due at or before deadline.
+// This must be invoked while the caller has a lock.
+func (p *Processor[K, T]) drained(deadline time.Time) bool {
+	if p.inflight > 0 {
+		return false
+	}
+	_, dueTime, ok := p.queue.PeekDueTime()
+	return !ok || dueTime.After(deadline)
+}
+
+// Sends a signal to Shutdown, if it's waiting for the queue to be drained.
+func (p *Processor[K, T]) notifyProgress() {
+	select {
+	case p.progressCh <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the items that were not executed.
+// This must be invoked after the processor is closed.
+func (p *Processor[K, T]) remaining() []T {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Items that were collected in a batch are due before those in the queue
+	res := make([]T, 0, len(p.batch)+p.queue.Len())
+	for _, item := range p.batch {
+		res = append(res, item.value)
+	}
+	for _, item := range p.queue.Items() {
+		res = append(res, item.value)
+	}
+	return res
+}
@@ -0,0 +1,157 @@
+package eventqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/italypaleale/go-kit/servicerunner"
+)
+
+func TestProcessorShutdown(t *testing.T) {
+	type fixture struct {
+		processor *Processor[string, *queueableItem]
+		clock     *clocktesting.FakeClock
+		executeCh chan string
+		remaining chan []string
+	}
+
+	newFixture := func(t *testing.T, drain bool) fixture {
+		t.Helper()
+
+		f := fixture{
+			clock:     clocktesting.NewFakeClock(time.Now()),
+			executeCh: make(chan string, 10),
+			remaining: make(chan []string, 1),
+		}
+		f.processor = NewProcessor(Options[string, *queueableItem]{
+			ExecuteFn: func(r *queueableItem) {
+				f.executeCh <- r.Name
+			},
+			Clock:           f.clock,
+			DrainOnShutdown: drain,
+			RemainingFn: func(rs []*queueableItem) {
+				names := make([]string, len(rs))
+				for i, r := range rs {
+					names[i] = r.Name
+				}
+				f.remaining <- names
+			},
+		})
+		t.Cleanup(func() {
+			f.processor.Close()
+		})
+
+		require.NoError(t, f.processor.Enqueue(
+			newTestItem(1, f.clock.Now()),
+			newTestItem(2, f.clock.Now().Add(time.Second)),
+			newTestItem(3, f.clock.Now().Add(time.Hour)),
+		))
+		select {
+		case name := <-f.executeCh:
+			require.Equal(t, "1", name)
+		case <-time.After(time.Second):
+			t.Fatal("item 1 was not executed in 1s")
+		}
+
+		return f
+	}
+
+	t.Run("execution context is canceled on close", func(t *testing.T) {
+		startedCh := make(chan struct{})
+		errCh := make(chan error, 1)
+		processor := NewProcessor(Options[string, *queueableItem]{
+			ExecuteContextFn: func(ctx context.Context, r *queueableItem) error {
+				close(startedCh)
+				<-ctx.Done()
+				errCh <- ctx.Err()
+				return nil
+			},
+			Clock: clocktesting.NewFakeClock(time.Now()),
+		})
+
+		require.NoError(t, processor.Enqueue(newTestItem(1, time.Now())))
+		select {
+		case <-startedCh:
+		case <-time.After(time.Second):
+			t.Fatal("item was not executed in 1s")
+		}
+
+		require.NoError(t, processor.Close())
+		require.ErrorIs(t, <-errCh, context.Canceled)
+	})
+
+	t.Run("drain items due before the deadline", func(t *testing.T) {
+		f := newFixture(t, true)
+
+		ctx, cancel := context.WithDeadline(t.Context(), f.clock.Now().Add(time.Minute))
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- f.processor.Shutdown(ctx)
+		}()
+
+		// New items are rejected while draining
+		assert.Eventually(t, f.processor.draining.Load, time.Second, 10*time.Millisecond)
+		require.ErrorIs(t, f.processor.Enqueue(newTestItem(4, f.clock.Now())), ErrProcessorStopped)
+
+		// Item 2 is executed when it's due, then Shutdown returns
+		assert.Eventually(t, f.clock.HasWaiters, time.Second, 10*time.Millisecond)
+		f.clock.Step(time.Second)
+		assert.Equal(t, "2", <-f.executeCh)
+		select {
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Shutdown did not return in 1s")
+		}
+
+		assert.Equal(t, []string{"3"}, <-f.remaining)
+	})
+
+	t.Run("drain times out", func(t *testing.T) {
+		f := newFixture(t, true)
+
+		ctx, cancel := context.WithDeadline(t.Context(), f.clock.Now().Add(1200*time.Millisecond))
+		defer cancel()
+
+		// The fake clock doesn't advance, so item 2 never becomes due
+		err := f.processor.Shutdown(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, []string{"2", "3"}, <-f.remaining)
+	})
+
+	t.Run("without drain", func(t *testing.T) {
+		f := newFixture(t, false)
+
+		require.NoError(t, f.processor.Shutdown(t.Context()))
+		assert.Equal(t, []string{"2", "3"}, <-f.remaining)
+		assert.Empty(t, f.executeCh)
+
+		// Shutting down again is a nop
+		require.NoError(t, f.processor.Shutdown(t.Context()))
+		require.ErrorIs(t, f.processor.Enqueue(newTestItem(4, f.clock.Now())), ErrProcessorStopped)
+	})
+
+	t.Run("run as a service", func(t *testing.T) {
+		f := newFixture(t, true)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		var wg sync.WaitGroup
+		var runErr error
+		wg.Go(func() {
+			runErr = servicerunner.NewServiceRunner(f.processor.Run).Run(ctx)
+		})
+
+		cancel()
+		wg.Wait()
+		require.NoError(t, runErr)
+		assert.Equal(t, []string{"2", "3"}, <-f.remaining)
+		require.ErrorIs(t, f.processor.Enqueue(newTestItem(4, f.clock.Now())), ErrProcessorStopped)
+	})
+}
@@ -0,0 +1,38 @@
+package eventqueue
+
+import (
+	"encoding/json"
+)
+
+// Store is the interface for persisting the items in the queue, so they can be recovered after a restart.
+// Implementations must be safe for concurrent use.
+type Store[K comparable, T Queueable[K]] interface {
+	// Save durably records an item that was added to the queue.
+	// If an item with the same key already exists, it is replaced.
+	Save(r T) error
+	// Delete durably records that the item with the given key was removed from the queue.
+	// Deleting a key that does not exist is not an error.
+	Delete(key K) error
+	// Load returns all items currently recorded in the store.
+	// Items should be returned in the order they were last saved, so items with the same due time and priority are executed in the same order after the queue is rebuilt.
+	Load() ([]T, error)
+}
+
+// Codec is used to serialize items and keys in a Store.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is a Codec that uses encoding/json.
+type JSONCodec struct{}
+
+// Marshal implements Codec.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
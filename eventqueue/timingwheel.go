@@ -0,0 +1,402 @@
+package eventqueue
+
+import (
+	"container/heap"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+const (
+	// Each level of the wheel has 64 slots, so the slots that are occupied can be tracked in a uint64
+	wheelBits  = 6
+	wheelSlots = 1 << wheelBits
+	wheelMask  = wheelSlots - 1
+	// Number of levels needed to cover all 64-bit ticks
+	wheelLevels = (64 + wheelBits - 1) / wheelBits
+)
+
+// wheelQueue implements itemQueue with a hierarchical timing wheel.
+// Time is divided in ticks of 1ms, counted from the Unix epoch. Each level of the wheel has 64 slots: a slot in level 0 contains the items due in a tick, a slot in level 1 the items due in 64 ticks, and so on.
+// Items are stored in the lowest level whose slot does not contain the current tick, so the items in level n are all due before the items in level n+1. As time advances, the items in a slot are moved ("cascaded") to lower levels.
+// Slots are doubly-linked lists, so inserting and removing items takes constant time; items that are due are moved to a heap ordered by priority, like in queue.
+// Note: methods in this struct are not safe for concurrent use. Callers should use locks to ensure consistency.
+type wheelQueue[K comparable, T Queueable[K]] struct {
+	slots [wheelLevels][wheelSlots]*queueItem[K, T]
+	// Bitmap of the slots that contain items, for each level
+	occupied [wheelLevels]uint64
+	// Current tick
+	cur uint64
+	// Number of items in the wheel (excluding those that are ready)
+	pending int
+	// Cached earliest item in the wheel; nil if it must be computed again
+	earliest *queueItem[K, T]
+
+	ready *readyHeap[K, T]
+	items map[K]*queueItem[K, T]
+	// Sequence number for the next item that is inserted
+	seq uint64
+}
+
+// newWheelQueue creates a new wheelQueue.
+func newWheelQueue[K comparable, T Queueable[K]]() *wheelQueue[K, T] {
+	return &wheelQueue[K, T]{
+		ready: new(readyHeap[K, T]),
+		items: make(map[K]*queueItem[K, T]),
+	}
+}
+
+// Len returns the number of items in the queue.
+func (w *wheelQueue[K, T]) Len() int {
+	return w.pending + w.ready.Len()
+}
+
+// Promote moves all items that are due at or before now to the heap of items that are ready to be executed.
+func (w *wheelQueue[K, T]) Promote(now time.Time) {
+	target := wheelTick(now)
+	for w.pending > 0 {
+		level, slot := w.first()
+		start := w.slotStart(level, slot)
+		if start > w.cur {
+			if start > target {
+				break
+			}
+			// Advance to the start of the slot, then look for the first slot again, since items were cascaded
+			w.cur = start
+			w.cascade()
+			continue
+		}
+
+		// This is the slot in level 0 for the current tick
+		// If the current tick is in the past, all items in it are due; otherwise, compare their exact due time
+		due := w.cur < target
+		for item := w.slots[0][slot]; item != nil; {
+			next := item.next
+			if due || !item.dueTime().After(now) {
+				w.removePending(item)
+				item.ready = true
+				heap.Push(w.ready, item)
+			}
+			item = next
+		}
+		if !due {
+			break
+		}
+	}
+
+	if target > w.cur {
+		w.cur = target
+		w.cascade()
+	}
+}
+
+// Insert inserts a new item into the queue.
+// If replace is true, existing items are replaced
+func (w *wheelQueue[K, T]) Insert(r T, replace bool) {
+	key := r.Key()
+
+	// Check if the item already exists
+	item, ok := w.items[key]
+	if ok {
+		if replace {
+			// Replacing an item counts as a new insertion
+			w.remove(item)
+			item.value = r
+			item.dueAt = time.Time{}
+			item.attempt = 0
+			w.push(item)
+		}
+		return
+	}
+
+	item = &queueItem[K, T]{
+		value: r,
+	}
+	w.push(item)
+	w.items[key] = item
+}
+
+// InsertRetry inserts an item that is to be retried at the given time, which is used in place of the item's due time.
+// attempt is the number of times the item was already executed.
+// If an item with the same key already exists, this is a nop and returns false.
+func (w *wheelQueue[K, T]) InsertRetry(r T, retryAt time.Time, attempt int) bool {
+	key := r.Key()
+	if _, ok := w.items[key]; ok {
+		return false
+	}
+
+	item := &queueItem[K, T]{
+		value:   r,
+		dueAt:   retryAt,
+		attempt: attempt,
+	}
+	w.push(item)
+	w.items[key] = item
+	return true
+}
+
+// PopItem removes the next item in the queue and returns it.
+// If no item is ready, it returns the item that is due first, and time in the wheel advances to when that's due.
+func (w *wheelQueue[K, T]) PopItem() (*queueItem[K, T], bool) {
+	var item *queueItem[K, T]
+	switch {
+	case w.ready.Len() > 0:
+		item = heap.Pop(w.ready).(*queueItem[K, T]) //nolint:forcetypeassert
+	case w.pending > 0:
+		item = w.firstItem()
+		w.removePending(item)
+		if tick := wheelTick(item.dueTime()); tick > w.cur {
+			// All other items are due after this one
+			w.cur = tick
+			w.cascade()
+		}
+	default:
+		return nil, false
+	}
+
+	delete(w.items, item.value.Key())
+	return item, true
+}
+
+// Peek returns the next item in the queue, without removing it.
+// The returned boolean value will be "true" if an item was found.
+func (w *wheelQueue[K, T]) Peek() (T, bool) {
+	item, ok := w.head()
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return item.value, true
+}
+
+// PeekDueTime is like Peek, but it also returns the time the item is due at, which is the retry time for items being retried.
+func (w *wheelQueue[K, T]) PeekDueTime() (T, time.Time, bool) {
+	item, ok := w.head()
+	if !ok {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return item.value, item.dueTime(), true
+}
+
+// Returns the next item in the queue: the first one that is ready, if any, or the first one in order of due time.
+func (w *wheelQueue[K, T]) head() (*queueItem[K, T], bool) {
+	if w.ready.Len() > 0 {
+		return w.ready.queueHeap[0], true
+	}
+	if w.pending > 0 {
+		return w.firstItem(), true
+	}
+	return nil, false
+}
+
+// Remove an item from the queue.
+func (w *wheelQueue[K, T]) Remove(key K) {
+	// If the item is not in the queue, this is a nop
+	item, ok := w.items[key]
+	if !ok {
+		return
+	}
+
+	w.remove(item)
+	delete(w.items, key)
+}
+
+// Reschedule changes the time an item is due at, without replacing it.
+// Returns false if the item is not in the queue.
+func (w *wheelQueue[K, T]) Reschedule(key K, dueTime time.Time) bool {
+	item, ok := w.items[key]
+	if !ok {
+		return false
+	}
+
+	// Items that are ready are moved back to the wheel, as they may not be due anymore; Promote moves them back if they are
+	w.remove(item)
+	item.dueAt = dueTime
+	item.ready = false
+	w.addPending(item)
+	return true
+}
+
+// Get returns the item with the given key.
+func (w *wheelQueue[K, T]) Get(key K) (*queueItem[K, T], bool) {
+	item, ok := w.items[key]
+	return item, ok
+}
+
+// Items returns all items in the queue, in the order they are to be executed.
+func (w *wheelQueue[K, T]) Items() []*queueItem[K, T] {
+	ready := slices.Clone(w.ready.queueHeap)
+	slices.SortFunc(ready, func(a, b *queueItem[K, T]) int {
+		if a.beforeInReady(b) {
+			return -1
+		}
+		return 1
+	})
+
+	pending := make([]*queueItem[K, T], 0, w.pending)
+	for level := range w.slots {
+		for _, head := range w.slots[level] {
+			for item := head; item != nil; item = item.next {
+				pending = append(pending, item)
+			}
+		}
+	}
+	slices.SortFunc(pending, func(a, b *queueItem[K, T]) int {
+		if a.before(b) {
+			return -1
+		}
+		return 1
+	})
+
+	return append(ready, pending...)
+}
+
+// Adds an item to the wheel, assigning it a new sequence number.
+func (w *wheelQueue[K, T]) push(item *queueItem[K, T]) {
+	item.seq = w.seq
+	w.seq++
+	item.priority = priorityOf(item.value)
+	item.ready = false
+	w.addPending(item)
+}
+
+// Removes an item from the heap of ready items or from the wheel.
+func (w *wheelQueue[K, T]) remove(item *queueItem[K, T]) {
+	if item.ready {
+		heap.Remove(w.ready, item.index)
+	} else {
+		w.removePending(item)
+	}
+}
+
+// Adds an item to the wheel.
+func (w *wheelQueue[K, T]) addPending(item *queueItem[K, T]) {
+	w.place(item)
+	w.pending++
+	if w.pending == 1 || (w.earliest != nil && item.before(w.earliest)) {
+		w.earliest = item
+	}
+}
+
+// Removes an item from the wheel.
+func (w *wheelQueue[K, T]) removePending(item *queueItem[K, T]) {
+	w.unlink(item)
+	w.pending--
+	if w.earliest == item {
+		w.earliest = nil
+	}
+}
+
+// Returns the item in the wheel that is due first.
+// The wheel must not be empty.
+func (w *wheelQueue[K, T]) firstItem() *queueItem[K, T] {
+	if w.earliest != nil {
+		return w.earliest
+	}
+
+	// The first item is in the first slot, which contains the items due in the same tick if it's in level 0
+	level, slot := w.first()
+	earliest := w.slots[level][slot]
+	for item := earliest.next; item != nil; item = item.next {
+		if item.before(earliest) {
+			earliest = item
+		}
+	}
+	w.earliest = earliest
+	return earliest
+}
+
+// Returns the first slot that contains items, which has the items that are due first.
+// The wheel must not be empty.
+func (w *wheelQueue[K, T]) first() (level int, slot int) {
+	for level = range wheelLevels {
+		// Slots before the current tick's are empty, but mask them for safety
+		cur := (w.cur >> (wheelBits * level)) & wheelMask
+		occupied := w.occupied[level] &^ (1<<cur - 1)
+		if occupied != 0 {
+			return level, bits.TrailingZeros64(occupied)
+		}
+	}
+	panic("timing wheel is empty")
+}
+
+// Returns the first tick of a slot.
+func (w *wheelQueue[K, T]) slotStart(level int, slot int) uint64 {
+	// Shifting by 64 bits or more returns 0, which is correct for the top level
+	shift := uint(wheelBits * (level + 1))
+	return (w.cur>>shift)<<shift | uint64(slot)<<(wheelBits*level) //nolint:gosec
+}
+
+// Adds an item to the slot for its due time.
+// Items that are due before the current tick are added to the slot for the current tick.
+func (w *wheelQueue[K, T]) place(item *queueItem[K, T]) {
+	tick := max(wheelTick(item.dueTime()), w.cur)
+
+	// The level is determined by the most significant bit that differs from the current tick
+	level := 0
+	if diff := tick ^ w.cur; diff > wheelMask {
+		level = (bits.Len64(diff) - 1) / wheelBits
+	}
+	slot := int((tick >> (wheelBits * level)) & wheelMask) //nolint:gosec
+
+	head := w.slots[level][slot]
+	item.prev = nil
+	item.next = head
+	if head != nil {
+		head.prev = item
+	}
+	w.slots[level][slot] = item
+	w.occupied[level] |= 1 << slot
+	item.index = level*wheelSlots + slot
+}
+
+// Removes an item from its slot.
+func (w *wheelQueue[K, T]) unlink(item *queueItem[K, T]) {
+	level, slot := item.index/wheelSlots, item.index%wheelSlots
+	if item.prev != nil {
+		item.prev.next = item.next
+	} else {
+		w.slots[level][slot] = item.next
+	}
+	if item.next != nil {
+		item.next.prev = item.prev
+	}
+	if w.slots[level][slot] == nil {
+		w.occupied[level] &^= 1 << slot
+	}
+	item.prev = nil
+	item.next = nil
+	item.index = -1
+}
+
+// Moves the items in the slots that contain the current tick to lower levels.
+// This must be invoked after the current tick changes.
+func (w *wheelQueue[K, T]) cascade() {
+	// Start from the top, as items may be moved to slots in intermediate levels that contain the current tick too
+	for level := wheelLevels - 1; level > 0; level-- {
+		slot := int((w.cur >> (wheelBits * level)) & wheelMask) //nolint:gosec
+		if w.occupied[level]&(1<<slot) == 0 {
+			continue
+		}
+
+		item := w.slots[level][slot]
+		w.slots[level][slot] = nil
+		w.occupied[level] &^= 1 << slot
+		for item != nil {
+			next := item.next
+			w.place(item)
+			item = next
+		}
+	}
+}
+
+// Returns the tick for a time, as the number of milliseconds since the Unix epoch.
+// Times before the epoch are in tick 0.
+func wheelTick(t time.Time) uint64 {
+	ms := t.UnixMilli()
+	if ms < 0 {
+		return 0
+	}
+	return uint64(ms)
+}
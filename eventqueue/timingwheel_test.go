@@ -0,0 +1,221 @@
+package eventqueue
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestWheelQueue(t *testing.T) {
+	t.Run("items are popped in order", func(t *testing.T) {
+		queue := newWheelQueue[string, *queueableItem]()
+
+		queue.Insert(newTestItem(2, "2022-02-02T02:02:02Z"), false)
+		queue.Insert(newTestItem(3, "2023-03-03T03:03:03Z"), false)
+		queue.Insert(newTestItem(1, "2021-01-01T01:01:01Z"), false)
+		queue.Insert(newTestItem(5, "2029-09-09T09:09:09Z"), false)
+		queue.Insert(newTestItem(4, "2024-04-04T04:04:04Z"), false)
+		require.Equal(t, 5, queue.Len())
+
+		for i := 1; i <= 5; i++ {
+			item, ok := queue.PopItem()
+			require.True(t, ok)
+			assert.Equal(t, strconv.Itoa(i), item.value.Name)
+		}
+		_, ok := queue.PopItem()
+		assert.False(t, ok)
+		assert.Equal(t, 0, queue.Len())
+	})
+
+	t.Run("items before the epoch", func(t *testing.T) {
+		queue := newWheelQueue[string, *queueableItem]()
+
+		queue.Insert(newTestItem(2, time.Time{}.Add(time.Hour)), false)
+		queue.Insert(newTestItem(1, time.Time{}), false)
+		queue.Insert(newTestItem(3, time.Unix(0, 0)), false)
+		require.Equal(t, 3, queue.Len())
+
+		// All items are in the same tick, so they're sorted by their exact due time
+		for i := 1; i <= 3; i++ {
+			item, ok := queue.PopItem()
+			require.True(t, ok)
+			assert.Equal(t, strconv.Itoa(i), item.value.Name)
+		}
+	})
+
+	t.Run("same behavior as the heap", func(t *testing.T) {
+		// Perform the same random operations on both backends
+		for seed := range uint64(20) {
+			rnd := rand.New(rand.NewPCG(seed, seed)) //nolint:gosec
+			heapQueue := newQueue[string, *prioritizedItem]()
+			wheelQueue := newWheelQueue[string, *prioritizedItem]()
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			// Due times are spread over ranges of different sizes, to exercise all levels
+			randomTime := func() time.Time {
+				scales := []time.Duration{time.Microsecond, time.Millisecond, time.Second, time.Hour, 24 * 365 * time.Hour}
+				scale := scales[rnd.IntN(len(scales))]
+				return now.Add(time.Duration(rnd.Int64N(2000)-100) * scale)
+			}
+
+			for range 2000 {
+				key := strconv.Itoa(rnd.IntN(300))
+				switch op := rnd.IntN(10); {
+				case op < 4:
+					r := &prioritizedItem{Name: key, ExecutionTime: randomTime(), Prio: rnd.IntN(3)}
+					heapQueue.Insert(r, true)
+					wheelQueue.Insert(r, true)
+				case op < 5:
+					heapQueue.Remove(key)
+					wheelQueue.Remove(key)
+				case op < 6:
+					dueTime := randomTime()
+					require.Equal(t, heapQueue.Reschedule(key, dueTime), wheelQueue.Reschedule(key, dueTime))
+				case op < 8:
+					now = now.Add(time.Duration(rnd.Int64N(int64(time.Minute))))
+					heapQueue.Promote(now)
+					wheelQueue.Promote(now)
+				default:
+					expect, expectOk := heapQueue.PopItem()
+					actual, actualOk := wheelQueue.PopItem()
+					require.Equal(t, expectOk, actualOk)
+					if expectOk {
+						require.Equal(t, expect.value, actual.value, "seed %d", seed)
+					}
+				}
+
+				require.Equal(t, heapQueue.Len(), wheelQueue.Len())
+				expect, expectDueTime, expectOk := heapQueue.PeekDueTime()
+				actual, actualDueTime, actualOk := wheelQueue.PeekDueTime()
+				require.Equal(t, expectOk, actualOk)
+				require.Equal(t, expect, actual, "seed %d", seed)
+				require.True(t, expectDueTime.Equal(actualDueTime))
+			}
+
+			expect := heapQueue.Items()
+			actual := wheelQueue.Items()
+			require.Len(t, actual, len(expect))
+			for i := range expect {
+				require.Equal(t, expect[i].value, actual[i].value)
+			}
+		}
+	})
+}
+
+func TestProcessorTimingWheel(t *testing.T) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	executeCh := make(chan string, 10)
+	processor := NewProcessor(Options[string, *queueableItem]{
+		ExecuteFn: func(r *queueableItem) {
+			executeCh <- r.Name
+		},
+		Clock:        clock,
+		QueueBackend: QueueBackendTimingWheel,
+	})
+	defer processor.Close()
+
+	for i := 5; i >= 1; i-- {
+		require.NoError(t, processor.Enqueue(newTestItem(i, clock.Now().Add(time.Duration(i)*time.Second))))
+	}
+	require.NoError(t, processor.Enqueue(newTestItem(6, clock.Now().Add(time.Hour))))
+	require.NoError(t, processor.Dequeue("6"))
+	require.NoError(t, processor.Reschedule("3", clock.Now().Add(500*time.Millisecond)))
+
+	for _, expect := range []string{"3", "1", "2", "4", "5"} {
+		assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+		info := processor.List(0, 1)
+		require.Len(t, info, 1)
+		clock.SetTime(info[0].DueTime)
+
+		select {
+		case name := <-executeCh:
+			assert.Equal(t, expect, name)
+		case <-time.After(time.Second):
+			t.Fatalf("item %s was not executed in 1s", expect)
+		}
+	}
+	assert.Equal(t, 0, processor.Count())
+}
+
+// The benchmarks compare the backends with queues of different sizes, with items due at random times over 30 days.
+func BenchmarkQueueBackends(b *testing.B) {
+	backends := []struct {
+		name    string
+		backend QueueBackend
+	}{
+		{"heap", QueueBackendHeap},
+		{"timingwheel", QueueBackendTimingWheel},
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newItems := func(n int) []*queueableItem {
+		rnd := rand.New(rand.NewPCG(1, 2)) //nolint:gosec
+		items := make([]*queueableItem, n)
+		for i := range items {
+			items[i] = newTestItem(i, now.Add(time.Duration(rnd.Int64N(int64(30*24*time.Hour)))))
+		}
+		return items
+	}
+	newFilledQueue := func(backend QueueBackend, items []*queueableItem) itemQueue[string, *queueableItem] {
+		queue := newItemQueue[string, *queueableItem](backend)
+		queue.Promote(now)
+		for _, r := range items {
+			queue.Insert(r, true)
+		}
+		return queue
+	}
+
+	for _, size := range []int{1_000, 100_000, 1_000_000} {
+		items := newItems(size)
+
+		for _, bb := range backends {
+			b.Run("insert/"+bb.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					newFilledQueue(bb.backend, items)
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size), "ns/item")
+			})
+
+			b.Run("remove/"+bb.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				queue := newFilledQueue(bb.backend, items)
+				b.ReportAllocs()
+				i := 0
+				for b.Loop() {
+					// Remove an item and add it back, so the queue doesn't become empty
+					r := items[i%size]
+					queue.Remove(r.Key())
+					queue.Insert(r, true)
+					i++
+				}
+			})
+
+			b.Run("pop/"+bb.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					b.StopTimer()
+					queue := newFilledQueue(bb.backend, items)
+					b.StartTimer()
+
+					// Advance time in steps of 1 minute, popping the items that are due, like the processor does
+					for t := now; queue.Len() > 0; t = t.Add(time.Minute) {
+						queue.Promote(t)
+						for {
+							_, dueTime, ok := queue.PeekDueTime()
+							if !ok || dueTime.After(t) {
+								break
+							}
+							queue.PopItem()
+						}
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size), "ns/item")
+			})
+		}
+	}
+}
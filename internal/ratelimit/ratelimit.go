@@ -0,0 +1,35 @@
+// Package ratelimit contains the rate limit options shared by the packages in this module.
+package ratelimit
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit configures a token bucket
+type Limit struct {
+	// Number of events (such as messages sent, or executions) in each Period
+	// If 0, there's no limit
+	Events int
+	// Period for the limit
+	// Defaults to 1s
+	Period time.Duration
+	// Maximum number of events in a burst
+	// Defaults to Events
+	Burst int
+}
+
+// NewLimiter returns a rate limiter for the token bucket.
+// It must be invoked only if Events is greater than 0.
+func (l Limit) NewLimiter() *rate.Limiter {
+	period := l.Period
+	if period <= 0 {
+		period = time.Second
+	}
+	burst := l.Burst
+	if burst <= 0 {
+		burst = l.Events
+	}
+	return rate.NewLimiter(rate.Every(period/time.Duration(l.Events)), burst)
+}
@@ -0,0 +1,23 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestNewLimiter(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		l := Limit{Events: 4}.NewLimiter()
+		assert.Equal(t, rate.Every(250*time.Millisecond), l.Limit())
+		assert.Equal(t, 4, l.Burst())
+	})
+
+	t.Run("period and burst", func(t *testing.T) {
+		l := Limit{Events: 2, Period: time.Minute, Burst: 5}.NewLimiter()
+		assert.Equal(t, rate.Every(30*time.Second), l.Limit())
+		assert.Equal(t, 5, l.Burst())
+	})
+}
@@ -0,0 +1,172 @@
+package ttlcache
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Number of entries that are compared to choose the one to evict
+const evictionSamples = 8
+
+// EvictionPolicy determines which entries are evicted when the cache is full.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entries.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the least frequently used entries.
+	EvictLFU
+)
+
+// EvictionReason is the reason why an entry was removed from the cache.
+type EvictionReason int
+
+const (
+	// EvictionReasonExpired indicates that the entry was removed because it expired.
+	EvictionReasonExpired EvictionReason = iota
+	// EvictionReasonDeleted indicates that the entry was removed by Delete or Reset.
+	EvictionReasonDeleted
+	// EvictionReasonReplaced indicates that the entry was replaced by a new value for the same key.
+	EvictionReasonReplaced
+	// EvictionReasonCapacity indicates that the entry was evicted because the cache was full.
+	EvictionReasonCapacity
+)
+
+// String implements fmt.Stringer.
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonDeleted:
+		return "deleted"
+	case EvictionReasonReplaced:
+		return "replaced"
+	case EvictionReasonCapacity:
+		return "capacity"
+	default:
+		return "unknown"
+	}
+}
+
+// evictionNode tracks the usage of an entry, for choosing the entries to evict when the cache is full.
+// Fields that are updated when the entry is read are atomic, so reads don't need to acquire a lock.
+type evictionNode[K cacheKey] struct {
+	key  K
+	cost int64
+	// Expiration time of the entry, as nanoseconds since the Unix epoch
+	exp *atomic.Int64
+	// Last time the entry was read or written, as nanoseconds since the Unix epoch
+	lastAccess atomic.Int64
+	// Number of times the entry was read
+	hits atomic.Uint32
+
+	prev, next *evictionNode[K]
+}
+
+// Records that the entry was read.
+func (n *evictionNode[K]) touch(now int64) {
+	n.lastAccess.Store(now)
+	if n.hits.Load() < math.MaxUint32 {
+		n.hits.Add(1)
+	}
+}
+
+// Returns true if the entry should be evicted before other.
+func (n *evictionNode[K]) before(other *evictionNode[K], policy EvictionPolicy) bool {
+	if policy == EvictLFU {
+		a, b := n.hits.Load(), other.hits.Load()
+		if a != b {
+			return a < b
+		}
+	}
+	return n.lastAccess.Load() < other.lastAccess.Load()
+}
+
+// evictionList contains the nodes for all entries in the cache, in the order they were added.
+// Eviction is approximated, like in Redis: starting from a "hand" that cycles through the list, a few entries are sampled, and the least recently (or frequently) used one is evicted.
+// Note: methods in this struct are not safe for concurrent use. Callers should use locks to ensure consistency.
+type evictionList[K cacheKey] struct {
+	head, tail *evictionNode[K]
+	// Next node to sample
+	hand *evictionNode[K]
+	// Number of nodes and their total cost
+	len  int
+	cost int64
+}
+
+// Adds a node at the end of the list.
+func (l *evictionList[K]) add(n *evictionNode[K]) {
+	n.prev = l.tail
+	n.next = nil
+	if l.tail != nil {
+		l.tail.next = n
+	} else {
+		l.head = n
+	}
+	l.tail = n
+	l.len++
+	l.cost += n.cost
+}
+
+// Removes a node from the list.
+func (l *evictionList[K]) remove(n *evictionNode[K]) {
+	if l.hand == n {
+		l.hand = n.next
+	}
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		l.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		l.tail = n.prev
+	}
+	n.prev = nil
+	n.next = nil
+	l.len--
+	l.cost -= n.cost
+}
+
+// Removes all nodes.
+func (l *evictionList[K]) reset() {
+	*l = evictionList[K]{}
+}
+
+// Returns the node to evict, which is never skip unless that's the only node.
+// Entries that are expired are evicted first.
+func (l *evictionList[K]) victim(policy EvictionPolicy, now int64, skip *evictionNode[K]) *evictionNode[K] {
+	if l.len == 1 {
+		return l.head
+	}
+
+	var res *evictionNode[K]
+	n := l.hand
+	for range min(evictionSamples, l.len) {
+		if n == nil {
+			n = l.head
+		}
+		if n != skip {
+			if n.exp.Load() <= now {
+				res = n
+				n = n.next
+				break
+			}
+			if res == nil || n.before(res, policy) {
+				res = n
+			}
+		}
+		n = n.next
+	}
+	l.hand = n
+
+	// If the only node that was sampled is skip, use the one after that
+	if res == nil {
+		res = skip.next
+		if res == nil {
+			res = l.head
+		}
+	}
+	return res
+}
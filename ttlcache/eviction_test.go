@@ -0,0 +1,202 @@
+package ttlcache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestCacheEviction(t *testing.T) {
+	type evictedKey struct {
+		key    string
+		reason EvictionReason
+	}
+
+	newCache := func(t *testing.T, opts CacheOptions, options ...CacheOption[string, string]) (*Cache[string, string], *clocktesting.FakeClock, *[]evictedKey) {
+		t.Helper()
+
+		clock := &clocktesting.FakeClock{}
+		clock.SetTime(time.Now())
+
+		evicted := &[]evictedKey{}
+		opts.CleanupInterval = time.Hour
+		opts.clock = clock
+		options = append(options, WithOnEvict(func(key string, val string, reason EvictionReason) {
+			assert.Equal(t, "val-"+key, val)
+			*evicted = append(*evicted, evictedKey{key: key, reason: reason})
+		}))
+		cache := NewCache(&opts, options...)
+		t.Cleanup(cache.Stop)
+
+		return cache, clock, evicted
+	}
+
+	set := func(cache *Cache[string, string], clock *clocktesting.FakeClock, keys ...string) {
+		for _, k := range keys {
+			cache.Set(k, "val-"+k, time.Minute)
+			clock.Step(time.Millisecond)
+		}
+	}
+	get := func(cache *Cache[string, string], clock *clocktesting.FakeClock, keys ...string) {
+		for _, k := range keys {
+			_, ok := cache.Get(k)
+			require.True(t, ok, "key %s", k)
+			clock.Step(time.Millisecond)
+		}
+	}
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		cache, clock, evicted := newCache(t, CacheOptions{
+			MaxEntries: 3,
+		})
+
+		set(cache, clock, "a", "b", "c")
+		get(cache, clock, "a")
+		set(cache, clock, "d")
+		assert.Equal(t, []evictedKey{{"b", EvictionReasonCapacity}}, *evicted)
+
+		set(cache, clock, "e")
+		assert.Equal(t, []evictedKey{{"b", EvictionReasonCapacity}, {"c", EvictionReasonCapacity}}, *evicted)
+		assert.EqualValues(t, 3, cache.m.Len())
+		assert.Equal(t, 3, cache.evictions.len)
+	})
+
+	t.Run("evict least frequently used", func(t *testing.T) {
+		cache, clock, evicted := newCache(t, CacheOptions{
+			MaxEntries:     3,
+			EvictionPolicy: EvictLFU,
+		})
+
+		set(cache, clock, "a", "b", "c")
+		get(cache, clock, "a", "a", "a", "c", "c", "b")
+		set(cache, clock, "d")
+		assert.Equal(t, []evictedKey{{"b", EvictionReasonCapacity}}, *evicted)
+	})
+
+	t.Run("evict expired entries first", func(t *testing.T) {
+		cache, clock, evicted := newCache(t, CacheOptions{
+			MaxEntries: 2,
+		})
+
+		cache.Set("a", "val-a", time.Minute)
+		cache.Set("b", "val-b", time.Second)
+		clock.Step(2 * time.Second)
+		set(cache, clock, "c")
+		assert.Equal(t, []evictedKey{{"b", EvictionReasonExpired}}, *evicted)
+	})
+
+	t.Run("max cost", func(t *testing.T) {
+		cache, clock, evicted := newCache(t, CacheOptions{
+			MaxCost: 20,
+		}, WithWeigher(func(key string, val string) int64 {
+			return int64(len(val))
+		}))
+
+		// Each value has a cost of 5
+		set(cache, clock, "a", "b", "c", "d")
+		assert.Empty(t, *evicted)
+		assert.EqualValues(t, 20, cache.evictions.cost)
+
+		// This has a cost of 6, so 2 entries are evicted
+		set(cache, clock, "ee")
+		assert.Equal(t, []evictedKey{{"a", EvictionReasonCapacity}, {"b", EvictionReasonCapacity}}, *evicted)
+		assert.EqualValues(t, 16, cache.evictions.cost)
+
+		// Entries that are larger than the maximum cost are not stored
+		*evicted = nil
+		big := "0123456789012345678901234"
+		set(cache, clock, big)
+		assert.Equal(t, []evictedKey{{big, EvictionReasonCapacity}}, *evicted)
+		_, ok := cache.Get(big)
+		assert.False(t, ok)
+		assert.EqualValues(t, 16, cache.evictions.cost)
+	})
+
+	t.Run("eviction list is kept consistent", func(t *testing.T) {
+		cache, clock, evicted := newCache(t, CacheOptions{
+			MaxEntries: 3,
+		})
+
+		// Replacing an entry doesn't cause evictions
+		set(cache, clock, "a", "b", "c", "a")
+		assert.Equal(t, []evictedKey{{"a", EvictionReasonReplaced}}, *evicted)
+		assert.Equal(t, 3, cache.evictions.len)
+
+		*evicted = nil
+		cache.Delete("b")
+		assert.Equal(t, []evictedKey{{"b", EvictionReasonDeleted}}, *evicted)
+		assert.Equal(t, 2, cache.evictions.len)
+
+		*evicted = nil
+		cache.Set("d", "val-d", time.Second)
+		clock.Step(time.Second)
+		cache.Cleanup()
+		assert.Equal(t, []evictedKey{{"d", EvictionReasonExpired}}, *evicted)
+		assert.Equal(t, 2, cache.evictions.len)
+		assert.EqualValues(t, 2, cache.m.Len())
+
+		*evicted = nil
+		cache.Reset()
+		assert.ElementsMatch(t, []evictedKey{{"a", EvictionReasonDeleted}, {"c", EvictionReasonDeleted}}, *evicted)
+		assert.Equal(t, 0, cache.evictions.len)
+		assert.EqualValues(t, 0, cache.m.Len())
+
+		*evicted = nil
+
+		set(cache, clock, "x", "y", "z")
+		assert.Empty(t, *evicted)
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		cache := NewCache[int, int](&CacheOptions{
+			MaxEntries: 100,
+		})
+		defer cache.Stop()
+
+		var wg sync.WaitGroup
+		for i := range 8 {
+			wg.Go(func() {
+				for j := range 2000 {
+					key := (i*7919 + j) % 500
+					if _, ok := cache.Get(key); !ok {
+						cache.Set(key, j, time.Minute)
+					}
+					if j%100 == 0 {
+						cache.Delete(key)
+					}
+				}
+			})
+		}
+		wg.Wait()
+
+		assert.LessOrEqual(t, int(cache.m.Len()), 100)
+		assert.EqualValues(t, cache.m.Len(), cache.evictions.len)
+	})
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	for _, maxEntries := range []int{0, 10_000} {
+		b.Run("maxEntries="+strconv.Itoa(maxEntries), func(b *testing.B) {
+			cache := NewCache[int, int](&CacheOptions{
+				MaxEntries: maxEntries,
+			})
+			defer cache.Stop()
+			for i := range 10_000 {
+				cache.Set(i, i, time.Hour)
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					cache.Get(i % 10_000)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package ttlcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// LoadFn is a function that loads the value for a key, for GetOrLoad.
+type LoadFn[K cacheKey, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadOptions are options for GetOrLoad.
+type LoadOptions struct {
+	// TTL for the values returned by the loader.
+	// This is required, and must be at least 1ms.
+	TTL time.Duration
+
+	// TTL for the errors returned by the loader, if greater than 0.
+	// When set, errors are cached, and GetOrLoad returns them without invoking the loader again until they expire.
+	// Otherwise, errors are not cached.
+	ErrorTTL time.Duration
+
+	// Time after which values are stale, if greater than 0 and less than TTL.
+	// When GetOrLoad finds a stale value, it returns it, and refreshes it in background invoking the loader.
+	// If the refresh fails, the stale value is returned until it expires.
+	SoftTTL time.Duration
+}
+
+// Returned by GetOrLoad if the loader invoked runtime.Goexit.
+var errLoadAborted = errors.New("loader did not return")
+
+// Tracks a load that is in progress.
+type loadCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+	// Set if the loader panicked
+	panicErr *panicError
+}
+
+// Error for a loader that panicked, with the value passed to panic and the stack trace.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("loader panicked: %v\n\n%s", p.value, p.stack)
+}
+
+// Unwrap returns the value passed to panic, if it's an error.
+func (p *panicError) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+// GetOrLoad returns an item from the cache, invoking loadFn to load it if it's not in the cache or has expired.
+// Concurrent calls for the same key are deduplicated, so loadFn is invoked only once, and all callers receive its result.
+// The loader is invoked with a context that is not canceled when ctx is; if ctx is canceled while waiting, GetOrLoad returns the error from ctx, but the value is still stored in the cache once loaded.
+// If the key is set or deleted while the value is being loaded, the loaded value is returned to the callers but it's not stored in the cache.
+// If loadFn panics, the callers waiting for the load panic with the same value, wrapped in an error that includes the stack trace.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loadFn LoadFn[K, V], opts LoadOptions) (v V, err error) {
+	if opts.TTL < time.Millisecond {
+		panic("invalid TTL: must be 1ms or greater")
+	}
+
+	entry, now, ok := c.lookup(key)
+	// Cached errors count as misses
+	c.recordRead(ok && entry.err == nil)
+	if ok {
+		if entry.err != nil {
+			return v, entry.err
+		}
+
+		// If the value is stale, refresh it in background
+		if !entry.refreshAt.IsZero() && !entry.refreshAt.After(now) {
+			c.load(ctx, key, loadFn, opts)
+		}
+		return entry.val, nil
+	}
+
+	call := c.load(ctx, key, loadFn, opts)
+	select {
+	case <-call.done:
+		if call.panicErr != nil {
+			panic(call.panicErr)
+		}
+		return call.val, call.err
+	case <-ctx.Done():
+		return v, ctx.Err()
+	}
+}
+
+// Starts loading the value for a key, unless a load is already in progress, and returns the load.
+func (c *Cache[K, V]) load(ctx context.Context, key K, loadFn LoadFn[K, V], opts LoadOptions) *loadCall[V] {
+	c.loadsLock.Lock()
+	defer c.loadsLock.Unlock()
+
+	call, ok := c.loads[key]
+	if ok {
+		return call
+	}
+
+	call = &loadCall[V]{
+		done: make(chan struct{}),
+	}
+	if c.loads == nil {
+		c.loads = make(map[K]*loadCall[V])
+	}
+	c.loads[key] = call
+	c.loading.Add(1)
+
+	// The loader runs in a separate goroutine, so callers can stop waiting when their context is canceled
+	loadCtx := context.WithoutCancel(ctx)
+	go func() {
+		// This is deferred so waiters are released even if the loader invokes runtime.Goexit
+		defer c.completeLoad(key, call, opts)
+		runLoad(loadCtx, key, call, loadFn)
+	}()
+
+	return call
+}
+
+// Invokes the loader, recovering from panics.
+func runLoad[K cacheKey, V any](ctx context.Context, key K, call *loadCall[V], loadFn LoadFn[K, V]) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			call.panicErr = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+
+	// This is returned if the loader doesn't return normally
+	call.err = errLoadAborted
+	call.val, call.err = loadFn(ctx, key)
+}
+
+// Stores the result of a load in the cache, then releases the callers that are waiting for it.
+// The result is stored only if the key wasn't set or deleted while loading, in which case the load was removed from loads.
+// This is done while holding loadsLock, so the result doesn't overwrite a value that is set concurrently.
+func (c *Cache[K, V]) completeLoad(key K, call *loadCall[V], opts LoadOptions) {
+	var evicted []evictedEntry[K, V]
+	c.loadsLock.Lock()
+	if c.loads[key] == call {
+		delete(c.loads, key)
+		switch {
+		case call.panicErr != nil || errors.Is(call.err, errLoadAborted):
+			// Nop
+		case call.err == nil:
+			evicted = c.set(key, &cacheEntry[K, V]{val: call.val}, opts.TTL, opts.SoftTTL)
+		case opts.ErrorTTL >= time.Millisecond && !c.hasValue(key):
+			// Errors don't replace stale values that haven't expired yet
+			evicted = c.set(key, &cacheEntry[K, V]{err: call.err}, opts.ErrorTTL, 0)
+		}
+	}
+	c.loading.Add(-1)
+	c.loadsLock.Unlock()
+
+	close(call.done)
+	c.notifyEvicted(evicted)
+}
+
+// Removes the load in progress for a key, if any, so its result is not stored in the cache.
+// This is invoked when the key is set or deleted.
+func (c *Cache[K, V]) invalidateLoad(key K) {
+	if c.loading.Load() == 0 {
+		return
+	}
+
+	c.loadsLock.Lock()
+	delete(c.loads, key)
+	c.loadsLock.Unlock()
+}
+
+// Removes all loads in progress, so their results are not stored in the cache.
+func (c *Cache[K, V]) invalidateLoads() {
+	if c.loading.Load() == 0 {
+		return
+	}
+
+	c.loadsLock.Lock()
+	clear(c.loads)
+	c.loadsLock.Unlock()
+}
+
+// Returns true if the cache contains a value for the key that hasn't expired.
+func (c *Cache[K, V]) hasValue(key K) bool {
+	entry, ok := c.m.Get(key)
+	return ok && entry.err == nil && !entry.expired(c.clock.Now())
+}
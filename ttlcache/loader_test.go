@@ -0,0 +1,280 @@
+package ttlcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestCacheGetOrLoad(t *testing.T) {
+	newCache := func(t *testing.T) (*Cache[string, string], *clocktesting.FakeClock) {
+		t.Helper()
+
+		clock := &clocktesting.FakeClock{}
+		clock.SetTime(time.Now())
+
+		cache := NewCache[string, string](&CacheOptions{
+			CleanupInterval: time.Hour,
+			clock:           clock,
+		})
+		t.Cleanup(cache.Stop)
+
+		return cache, clock
+	}
+
+	// Returns a loader that returns "<key>-<n>", where n is the number of times it was invoked
+	newLoader := func(calls *atomic.Int32) LoadFn[string, string] {
+		return func(ctx context.Context, key string) (string, error) {
+			n := calls.Add(1)
+			return key + "-" + strconv.Itoa(int(n)), nil
+		}
+	}
+
+	t.Run("load on miss", func(t *testing.T) {
+		cache, clock := newCache(t)
+		var calls atomic.Int32
+		opts := LoadOptions{TTL: 10 * time.Second}
+
+		v, err := cache.GetOrLoad(t.Context(), "a", newLoader(&calls), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "a-1", v)
+
+		// The value is cached
+		v, err = cache.GetOrLoad(t.Context(), "a", newLoader(&calls), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "a-1", v)
+		v, ok := cache.Get("a")
+		require.True(t, ok)
+		assert.Equal(t, "a-1", v)
+
+		// The value is loaded again after it expires
+		clock.Step(10 * time.Second)
+		v, err = cache.GetOrLoad(t.Context(), "a", newLoader(&calls), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "a-2", v)
+		assert.EqualValues(t, 2, calls.Load())
+	})
+
+	t.Run("concurrent loads are deduplicated", func(t *testing.T) {
+		cache, _ := newCache(t)
+		var calls atomic.Int32
+		releaseCh := make(chan struct{})
+		loadFn := func(ctx context.Context, key string) (string, error) {
+			calls.Add(1)
+			<-releaseCh
+			return "loaded", nil
+		}
+
+		var wg sync.WaitGroup
+		results := make([]string, 10)
+		for i := range results {
+			wg.Go(func() {
+				v, err := cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute})
+				assert.NoError(t, err)
+				results[i] = v
+			})
+		}
+
+		// Wait for the load to start before releasing it
+		assert.Eventually(t, func() bool {
+			return calls.Load() > 0
+		}, time.Second, 5*time.Millisecond)
+		close(releaseCh)
+		wg.Wait()
+
+		assert.EqualValues(t, 1, calls.Load())
+		for _, v := range results {
+			assert.Equal(t, "loaded", v)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache, clock := newCache(t)
+		var calls atomic.Int32
+		errTest := errors.New("test error")
+		loadFn := func(ctx context.Context, key string) (string, error) {
+			calls.Add(1)
+			return "", errTest
+		}
+
+		// Errors are not cached by default
+		_, err := cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute})
+		require.ErrorIs(t, err, errTest)
+		_, err = cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute})
+		require.ErrorIs(t, err, errTest)
+		assert.EqualValues(t, 2, calls.Load())
+
+		// Cache errors with ErrorTTL
+		opts := LoadOptions{TTL: time.Minute, ErrorTTL: 5 * time.Second}
+		_, err = cache.GetOrLoad(t.Context(), "b", loadFn, opts)
+		require.ErrorIs(t, err, errTest)
+		_, err = cache.GetOrLoad(t.Context(), "b", loadFn, opts)
+		require.ErrorIs(t, err, errTest)
+		assert.EqualValues(t, 3, calls.Load())
+
+		// Get doesn't return cached errors
+		_, ok := cache.Get("b")
+		assert.False(t, ok)
+
+		clock.Step(5 * time.Second)
+		_, err = cache.GetOrLoad(t.Context(), "b", loadFn, opts)
+		require.ErrorIs(t, err, errTest)
+		assert.EqualValues(t, 4, calls.Load())
+	})
+
+	t.Run("stale while revalidate", func(t *testing.T) {
+		cache, clock := newCache(t)
+		var calls atomic.Int32
+		opts := LoadOptions{TTL: 10 * time.Second, SoftTTL: 5 * time.Second}
+
+		v, err := cache.GetOrLoad(t.Context(), "a", newLoader(&calls), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "a-1", v)
+
+		// The stale value is returned, and refreshed in background
+		clock.Step(6 * time.Second)
+		v, err = cache.GetOrLoad(t.Context(), "a", newLoader(&calls), opts)
+		require.NoError(t, err)
+		assert.Equal(t, "a-1", v)
+
+		assert.EventuallyWithT(t, func(c *assert.CollectT) {
+			v, ok := cache.Get("a")
+			assert.True(c, ok)
+			assert.Equal(c, "a-2", v)
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("failed refresh keeps the stale value", func(t *testing.T) {
+		cache, clock := newCache(t)
+		opts := LoadOptions{TTL: 10 * time.Second, SoftTTL: 5 * time.Second, ErrorTTL: time.Minute}
+		cache.set("a", &cacheEntry[string, string]{val: "stale"}, opts.TTL, opts.SoftTTL)
+
+		var calls atomic.Int32
+		loadFn := func(ctx context.Context, key string) (string, error) {
+			calls.Add(1)
+			return "", errors.New("test error")
+		}
+
+		clock.Step(6 * time.Second)
+		v, err := cache.GetOrLoad(t.Context(), "a", loadFn, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "stale", v)
+
+		// Wait for the refresh to complete
+		assert.Eventually(t, func() bool {
+			cache.loadsLock.Lock()
+			defer cache.loadsLock.Unlock()
+			return calls.Load() == 1 && len(cache.loads) == 0
+		}, time.Second, 5*time.Millisecond)
+
+		v, ok := cache.Get("a")
+		require.True(t, ok)
+		assert.Equal(t, "stale", v)
+	})
+
+	t.Run("set or delete while loading", func(t *testing.T) {
+		for _, op := range []string{"set", "delete", "reset"} {
+			t.Run(op, func(t *testing.T) {
+				cache, _ := newCache(t)
+				startedCh := make(chan struct{})
+				releaseCh := make(chan struct{})
+				loadFn := func(ctx context.Context, key string) (string, error) {
+					close(startedCh)
+					<-releaseCh
+					return "loaded", nil
+				}
+
+				resCh := make(chan string, 1)
+				go func() {
+					v, _ := cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute})
+					resCh <- v
+				}()
+				<-startedCh
+
+				switch op {
+				case "set":
+					cache.Set("a", "set", time.Minute)
+				case "delete":
+					cache.Set("a", "set", time.Minute)
+					cache.Delete("a")
+				case "reset":
+					cache.Set("a", "set", time.Minute)
+					cache.Reset()
+				}
+				close(releaseCh)
+
+				// The caller receives the loaded value, but it doesn't overwrite the change
+				assert.Equal(t, "loaded", <-resCh)
+				v, ok := cache.Get("a")
+				if op == "set" {
+					require.True(t, ok)
+					assert.Equal(t, "set", v)
+				} else {
+					assert.False(t, ok)
+				}
+				assert.Zero(t, cache.loading.Load())
+			})
+		}
+	})
+
+	t.Run("loader panics", func(t *testing.T) {
+		cache, _ := newCache(t)
+		var calls atomic.Int32
+		loadFn := func(ctx context.Context, key string) (string, error) {
+			if calls.Add(1) == 1 {
+				panic("simulated")
+			}
+			return "loaded", nil
+		}
+
+		// The panic is passed to the caller
+		func() {
+			defer func() {
+				r := recover()
+				require.NotNil(t, r)
+				err, ok := r.(error)
+				require.True(t, ok)
+				assert.ErrorContains(t, err, "loader panicked: simulated")
+			}()
+			_, _ = cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute, ErrorTTL: time.Minute})
+			t.Fatal("GetOrLoad should have panicked")
+		}()
+
+		// Nothing is cached, so the loader is invoked again
+		v, err := cache.GetOrLoad(t.Context(), "a", loadFn, LoadOptions{TTL: time.Minute})
+		require.NoError(t, err)
+		assert.Equal(t, "loaded", v)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		cache, _ := newCache(t)
+		releaseCh := make(chan struct{})
+		loadFn := func(ctx context.Context, key string) (string, error) {
+			<-releaseCh
+			// The context passed to the loader is not canceled
+			return "loaded", ctx.Err()
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err := cache.GetOrLoad(ctx, "a", loadFn, LoadOptions{TTL: time.Minute})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// The value is stored once loaded
+		close(releaseCh)
+		assert.EventuallyWithT(t, func(c *assert.CollectT) {
+			v, ok := cache.Get("a")
+			assert.True(c, ok)
+			assert.Equal(c, "loaded", v)
+		}, time.Second, 5*time.Millisecond)
+	})
+}
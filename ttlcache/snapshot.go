@@ -0,0 +1,197 @@
+package ttlcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Version of the snapshot format
+const snapshotVersion = 1
+
+// Codec encodes and decodes the values stored in snapshots.
+type Codec[V any] interface {
+	// Marshal encodes a value.
+	Marshal(val V) ([]byte, error)
+	// Unmarshal decodes a value.
+	Unmarshal(data []byte) (V, error)
+}
+
+// GobCodec is a Codec that encodes values with encoding/gob.
+type GobCodec[V any] struct{}
+
+// Marshal implements Codec.
+func (GobCodec[V]) Marshal(val V) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec.
+func (GobCodec[V]) Unmarshal(data []byte) (val V, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&val)
+	return val, err
+}
+
+// JSONCodec is a Codec that encodes values with encoding/json.
+type JSONCodec[V any] struct{}
+
+// Marshal implements Codec.
+func (JSONCodec[V]) Marshal(val V) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec[V]) Unmarshal(data []byte) (val V, err error) {
+	err = json.Unmarshal(data, &val)
+	return val, err
+}
+
+// Header at the beginning of a snapshot.
+type snapshotHeader struct {
+	Version int
+}
+
+// Entry in a snapshot.
+type snapshotEntry[K cacheKey] struct {
+	Key K
+	// Expiration time, as nanoseconds since the Unix epoch
+	Exp int64
+	// TTL of the entry, used with SlidingExpiration
+	TTL time.Duration
+	// Value encoded with the codec
+	Value []byte
+}
+
+// Snapshot writes all entries in the cache that have not expired to w, including their expiration time.
+// Values are encoded with codec, while keys are encoded with encoding/gob; caches with keys of a pointer type (unsafe.Pointer) can't be snapshotted.
+// Errors cached by GetOrLoad are not included.
+// Entries that are modified while the snapshot is being written may or may not be included.
+// The snapshot can be restored with NewCacheFromSnapshot.
+func (c *Cache[K, V]) Snapshot(w io.Writer, codec Codec[V]) error {
+	err := checkSnapshotKey[K]()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := gob.NewEncoder(bw)
+	err = enc.Encode(snapshotHeader{Version: snapshotVersion})
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+
+	now := c.clock.Now()
+	c.m.ForEach(func(k K, v *cacheEntry[K, V]) bool {
+		if v.err != nil || v.expired(now) {
+			return true
+		}
+
+		var data []byte
+		data, err = codec.Marshal(v.val)
+		if err != nil {
+			err = fmt.Errorf("failed to encode value for key %v: %w", k, err)
+			return false
+		}
+		err = enc.Encode(snapshotEntry[K]{
+			Key:   k,
+			Exp:   v.exp.Load(),
+			TTL:   time.Duration(v.ttl.Load()),
+			Value: data,
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to write entry for key %v: %w", k, err)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// NewCacheFromSnapshot returns a new cache with a TTL, containing the entries from a snapshot created with Cache.Snapshot.
+// Values are decoded with codec. Entries that have already expired are skipped, and the others keep their expiration time.
+// Restored entries are not counted in the statistics, and entries that don't fit in a bounded cache are dropped without invoking the callback set with WithOnEvict.
+func NewCacheFromSnapshot[K cacheKey, V any](r io.Reader, codec Codec[V], opts *CacheOptions, options ...CacheOption[K, V]) (*Cache[K, V], error) {
+	err := checkSnapshotKey[K]()
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCache(opts, options...)
+	err = c.restore(r, codec)
+	if err != nil {
+		c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Adds the entries from a snapshot to the cache.
+// This is invoked while the cache is being created, so entries are not counted in the statistics and callbacks are not invoked.
+func (c *Cache[K, V]) restore(r io.Reader, codec Codec[V]) error {
+	dec := gob.NewDecoder(r)
+
+	var header snapshotHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", header.Version)
+	}
+
+	for {
+		var se snapshotEntry[K]
+		err = dec.Decode(&se)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read snapshot entry: %w", err)
+		}
+
+		// Skip entries that have expired (or are about to)
+		remaining := time.Unix(0, se.Exp).Sub(c.clock.Now())
+		if remaining < time.Millisecond {
+			continue
+		}
+
+		val, err := codec.Unmarshal(se.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode value for key %v: %w", se.Key, err)
+		}
+
+		entry := &cacheEntry[K, V]{val: val}
+		// Entries evicted because the cache is full are not reported nor counted in the statistics
+		_ = c.store(se.Key, entry, remaining, 0, false)
+		if se.TTL > 0 {
+			// Restore the original TTL, which is used to extend the expiration with SlidingExpiration
+			entry.ttl.Store(int64(se.TTL))
+		}
+	}
+}
+
+// Returns an error if keys of type K can't be encoded in a snapshot.
+// Keys are encoded with encoding/gob, which doesn't support unsafe.Pointer.
+func checkSnapshotKey[K cacheKey]() error {
+	if reflect.TypeFor[K]().Kind() == reflect.UnsafePointer {
+		return fmt.Errorf("keys of type %v are not supported in snapshots", reflect.TypeFor[K]())
+	}
+	return nil
+}
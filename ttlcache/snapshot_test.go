@@ -0,0 +1,156 @@
+package ttlcache
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+type snapshotValue struct {
+	Name  string
+	Count int
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	codecs := map[string]Codec[snapshotValue]{
+		"gob":  GobCodec[snapshotValue]{},
+		"json": JSONCodec[snapshotValue]{},
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			clock := &clocktesting.FakeClock{}
+			clock.SetTime(time.Now())
+
+			cache := NewCache[string, snapshotValue](&CacheOptions{
+				CleanupInterval: time.Hour,
+				clock:           clock,
+			})
+			defer cache.Stop()
+
+			cache.Set("a", snapshotValue{Name: "a", Count: 1}, time.Minute)
+			cache.Set("b", snapshotValue{Name: "b", Count: 2}, 10*time.Second)
+			cache.Set("expired", snapshotValue{Name: "expired"}, time.Second)
+			clock.Step(time.Second)
+
+			var buf bytes.Buffer
+			require.NoError(t, cache.Snapshot(&buf, codec))
+
+			// Restore after some time, so entry b expires
+			clock.Step(10 * time.Second)
+			restored, err := NewCacheFromSnapshot[string](&buf, codec, &CacheOptions{
+				CleanupInterval: time.Hour,
+				clock:           clock,
+			})
+			require.NoError(t, err)
+			defer restored.Stop()
+
+			assert.EqualValues(t, 1, restored.m.Len())
+			v, exp, ok := restored.GetWithExpiry("a")
+			require.True(t, ok)
+			assert.Equal(t, snapshotValue{Name: "a", Count: 1}, v)
+			_, expectExp, _ := cache.GetWithExpiry("a")
+			assert.True(t, expectExp.Equal(exp))
+			_, ok = restored.Get("b")
+			assert.False(t, ok)
+		})
+	}
+
+	t.Run("sliding expiration keeps the original TTL", func(t *testing.T) {
+		clock := &clocktesting.FakeClock{}
+		clock.SetTime(time.Now())
+		opts := func() *CacheOptions {
+			return &CacheOptions{
+				CleanupInterval:   time.Hour,
+				SlidingExpiration: true,
+				clock:             clock,
+			}
+		}
+
+		cache := NewCache[int, string](opts())
+		defer cache.Stop()
+		cache.Set(1, "one", time.Minute)
+		clock.Step(50 * time.Second)
+
+		var buf bytes.Buffer
+		require.NoError(t, cache.Snapshot(&buf, JSONCodec[string]{}))
+		restored, err := NewCacheFromSnapshot[int](&buf, JSONCodec[string]{}, opts())
+		require.NoError(t, err)
+		defer restored.Stop()
+
+		ttl, ok := restored.TTL(1)
+		require.True(t, ok)
+		assert.Equal(t, 10*time.Second, ttl)
+
+		_, ok = restored.Get(1)
+		require.True(t, ok)
+		ttl, _ = restored.TTL(1)
+		assert.Equal(t, time.Minute, ttl)
+	})
+
+	t.Run("restored entries are not counted and don't invoke callbacks", func(t *testing.T) {
+		cache := NewCache[int, string](nil)
+		defer cache.Stop()
+		for i := range 3 {
+			cache.Set(i, strconv.Itoa(i), time.Minute)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, cache.Snapshot(&buf, JSONCodec[string]{}))
+
+		var evicted atomic.Int32
+		restored, err := NewCacheFromSnapshot[int](&buf, JSONCodec[string]{}, &CacheOptions{
+			MaxEntries: 2,
+		}, WithOnEvict(func(int, string, EvictionReason) {
+			evicted.Add(1)
+		}))
+		require.NoError(t, err)
+		defer restored.Stop()
+
+		assert.Zero(t, evicted.Load())
+		assert.Equal(t, Stats{Size: 2}, restored.Stats())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := NewCacheFromSnapshot[string, string](bytes.NewReader([]byte("invalid")), JSONCodec[string]{}, nil)
+		require.ErrorContains(t, err, "failed to read snapshot header")
+
+		cache := NewCache[string, string](nil)
+		defer cache.Stop()
+		cache.Set("a", "not a number", time.Minute)
+
+		var buf bytes.Buffer
+		require.NoError(t, cache.Snapshot(&buf, JSONCodec[string]{}))
+		_, err = NewCacheFromSnapshot[string](&buf, JSONCodec[int]{}, &CacheOptions{})
+		require.ErrorContains(t, err, "failed to decode value for key a")
+
+		err = cache.Snapshot(&buf, failingCodec{})
+		require.ErrorContains(t, err, "failed to encode value for key a")
+
+		// Pointer keys can't be encoded
+		ptrCache := NewCache[unsafe.Pointer, string](nil)
+		defer ptrCache.Stop()
+		err = ptrCache.Snapshot(&buf, JSONCodec[string]{})
+		require.ErrorContains(t, err, "not supported in snapshots")
+		_, err = NewCacheFromSnapshot[unsafe.Pointer, string](&buf, JSONCodec[string]{}, nil)
+		require.ErrorContains(t, err, "not supported in snapshots")
+	})
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Marshal(string) ([]byte, error) {
+	return nil, errors.New("simulated")
+}
+
+func (failingCodec) Unmarshal([]byte) (string, error) {
+	return "", errors.New("simulated")
+}
@@ -0,0 +1,137 @@
+package ttlcache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const attrName = attribute.Key("ttlcache.name")
+
+// Stats contains statistics about the usage of a cache.
+type Stats struct {
+	// Number of reads that found a value in the cache
+	Hits uint64
+	// Number of reads that did not find a value in the cache
+	Misses uint64
+	// Number of values stored in the cache, including those stored by GetOrLoad
+	Sets uint64
+	// Number of entries evicted because the cache was full
+	Evictions uint64
+	// Number of entries removed because they expired
+	Expirations uint64
+	// Current number of entries in the cache, including those that have expired but have not been removed yet
+	Size int
+}
+
+// HitRatio returns the ratio of reads that found a value in the cache, or 0 if there were no reads.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// cacheStats contains the counters for Stats.
+type cacheStats struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Stats returns a snapshot of the statistics of the cache.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Sets:        c.stats.sets.Load(),
+		Evictions:   c.stats.evictions.Load(),
+		Expirations: c.stats.expirations.Load(),
+		Size:        int(c.m.Len()), //nolint:gosec
+	}
+}
+
+// Records a read in the statistics.
+func (c *Cache[K, V]) recordRead(hit bool) {
+	if hit {
+		c.stats.hits.Add(1)
+	} else {
+		c.stats.misses.Add(1)
+	}
+}
+
+// Registers observable instruments on the meter, which report the statistics of the cache.
+func (c *Cache[K, V]) registerMetrics(meter metric.Meter, name string) (metric.Registration, error) {
+	counters := []struct {
+		name        string
+		description string
+		unit        string
+		value       *atomic.Uint64
+		instrument  metric.Int64ObservableCounter
+	}{
+		{"ttlcache.hits", "Number of reads that found a value in the cache", "{request}", &c.stats.hits, nil},
+		{"ttlcache.misses", "Number of reads that did not find a value in the cache", "{request}", &c.stats.misses, nil},
+		{"ttlcache.sets", "Number of values stored in the cache", "{entry}", &c.stats.sets, nil},
+		{"ttlcache.evictions", "Number of entries evicted because the cache was full", "{entry}", &c.stats.evictions, nil},
+		{"ttlcache.expirations", "Number of entries removed because they expired", "{entry}", &c.stats.expirations, nil},
+	}
+
+	var err error
+	instruments := make([]metric.Observable, 0, len(counters)+1)
+	for i := range counters {
+		counters[i].instrument, err = meter.Int64ObservableCounter(
+			counters[i].name,
+			metric.WithDescription(counters[i].description),
+			metric.WithUnit(counters[i].unit),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s counter: %w", counters[i].name, err)
+		}
+		instruments = append(instruments, counters[i].instrument)
+	}
+
+	size, err := meter.Int64ObservableGauge(
+		"ttlcache.size",
+		metric.WithDescription("Number of entries in the cache"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ttlcache.size gauge: %w", err)
+	}
+	instruments = append(instruments, size)
+
+	attrs := metric.WithAttributes(attrName.String(name))
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, ctr := range counters {
+			o.ObserveInt64(ctr.instrument, int64(ctr.value.Load()), attrs) //nolint:gosec
+		}
+		o.ObserveInt64(size, int64(c.m.Len()), attrs) //nolint:gosec
+		return nil
+	}, instruments...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register callback for ttlcache metrics: %w", err)
+	}
+	return reg, nil
+}
+
+// Registers the metrics for the cache if a meter is set.
+// If the instruments can't be created, metrics are not reported, since NewCache can't return an error.
+func (c *Cache[K, V]) initMetrics(meter metric.Meter, name string) {
+	if meter == nil {
+		return
+	}
+
+	reg, err := c.registerMetrics(meter, name)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	c.metricsReg = reg
+}
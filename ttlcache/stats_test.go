@@ -0,0 +1,122 @@
+package ttlcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestCacheStats(t *testing.T) {
+	reader := sdkMetric.NewManualReader()
+	mp := sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader))
+
+	clock := &clocktesting.FakeClock{}
+	clock.SetTime(time.Now())
+
+	cache := NewCache[string, string](&CacheOptions{
+		CleanupInterval: time.Hour,
+		MaxEntries:      3,
+		Name:            "test",
+		Meter:           mp.Meter("test"),
+		clock:           clock,
+	})
+	defer cache.Stop()
+
+	assert.Equal(t, Stats{}, cache.Stats())
+	assert.Zero(t, cache.Stats().HitRatio())
+
+	// 5 sets, 2 of which cause evictions
+	cache.Set("a", "1", time.Second)
+	cache.Set("b", "2", time.Minute)
+	cache.Set("c", "3", time.Minute)
+	clock.Step(time.Millisecond)
+	cache.Set("d", "4", time.Minute)
+	cache.Set("e", "5", time.Minute)
+
+	// 3 hits and 2 misses, including one from GetOrLoad
+	cache.Get("d")
+	cache.GetWithExpiry("e")
+	cache.Get("missing")
+	_, err := cache.GetOrLoad(t.Context(), "d", func(ctx context.Context, key string) (string, error) {
+		return "", errors.New("not invoked")
+	}, LoadOptions{TTL: time.Minute})
+	require.NoError(t, err)
+	_, err = cache.GetOrLoad(t.Context(), "f", func(ctx context.Context, key string) (string, error) {
+		return "6", nil
+	}, LoadOptions{TTL: time.Second})
+	require.NoError(t, err)
+
+	// Entry f expires
+	clock.Step(time.Second)
+	cache.Cleanup()
+
+	stats := cache.Stats()
+	assert.Equal(t, Stats{
+		Hits:        3,
+		Misses:      2,
+		Sets:        6,
+		Evictions:   3,
+		Expirations: 1,
+		Size:        2,
+	}, stats)
+	assert.InDelta(t, 0.6, stats.HitRatio(), 0.001)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(t.Context(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	found := map[string]int64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		var dp metricdata.DataPoint[int64]
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			require.Len(t, data.DataPoints, 1)
+			assert.True(t, data.IsMonotonic)
+			dp = data.DataPoints[0]
+		case metricdata.Gauge[int64]:
+			require.Len(t, data.DataPoints, 1)
+			dp = data.DataPoints[0]
+		default:
+			t.Fatalf("unexpected data type for %s: %T", m.Name, m.Data)
+		}
+		name, _ := dp.Attributes.Value(attrName)
+		assert.Equal(t, attribute.StringValue("test"), name)
+		found[m.Name] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{
+		"ttlcache.hits":        3,
+		"ttlcache.misses":      2,
+		"ttlcache.sets":        6,
+		"ttlcache.evictions":   3,
+		"ttlcache.expirations": 1,
+		"ttlcache.size":        2,
+	}, found)
+}
+
+func TestCacheStatsCachedErrors(t *testing.T) {
+	cache := NewCache[string, string](&CacheOptions{
+		CleanupInterval: time.Hour,
+	})
+	defer cache.Stop()
+
+	// Errors returned from the cache count as misses
+	loadErr := errors.New("simulated")
+	for range 2 {
+		_, err := cache.GetOrLoad(t.Context(), "a", func(ctx context.Context, key string) (string, error) {
+			return "", loadErr
+		}, LoadOptions{TTL: time.Minute, ErrorTTL: time.Minute})
+		require.ErrorIs(t, err, loadErr)
+	}
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(0), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
@@ -4,14 +4,19 @@
 
 // Package ttlcache implements an efficient cache with a TTL.
 // Items in the cache are periodically purged in background.
+// The size of the cache can be bounded, evicting entries with an approximated LRU or LFU policy.
+// Values can be loaded on demand with GetOrLoad, which deduplicates concurrent loads and supports stale-while-revalidate.
+// The contents of a cache can be saved with Snapshot and restored with NewCacheFromSnapshot.
 package ttlcache
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/alphadose/haxmap"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/exp/constraints"
 	kclock "k8s.io/utils/clock"
 )
@@ -22,15 +27,38 @@ type cacheKey interface {
 
 // Cache is an efficient cache with a TTL.
 type Cache[K cacheKey, V any] struct {
-	m         *haxmap.Map[K, cacheEntry[V]]
+	m         *haxmap.Map[K, *cacheEntry[K, V]]
 	clock     kclock.WithTicker
 	stopped   atomic.Bool
 	runningCh chan struct{}
 	stopCh    chan struct{}
 	maxTTL    time.Duration
+	sliding   bool
+
+	// When the cache is bounded or has an OnEvict callback, writes acquire lock
+	// When the cache is unbounded, evictions is nil
+	locked     bool
+	lock       sync.Mutex
+	evictions  *evictionList[K]
+	maxEntries int
+	maxCost    int64
+	weigher    func(key K, val V) int64
+	policy     EvictionPolicy
+	onEvict    func(key K, val V, reason EvictionReason)
+
+	// Loads in progress for GetOrLoad
+	// A load is removed from loads when its key is set or deleted, so its result is not stored
+	loadsLock sync.Mutex
+	loads     map[K]*loadCall[V]
+	// Number of loads in progress, so writes don't need to acquire loadsLock when there are none
+	loading atomic.Int32
+
+	stats      cacheStats
+	metricsReg metric.Registration
 }
 
 // CacheOptions are options for NewCache.
+// Callbacks that receive the keys and values of the cache are set with CacheOption values, such as WithWeigher and WithOnEvict.
 type CacheOptions struct {
 	// Initial size for the cache.
 	// This is optional, and if empty will be left to the underlying library to decide.
@@ -43,22 +71,68 @@ type CacheOptions struct {
 	// Maximum TTL value, if greater than 0
 	MaxTTL time.Duration
 
+	// If true, reading an entry with Get, GetWithExpiry or GetOrLoad extends its expiration by its TTL.
+	// Entries that are read frequently may never expire, even if their TTL was capped by MaxTTL.
+	SlidingExpiration bool
+
+	// Maximum number of entries in the cache, if greater than 0.
+	// When the cache is full, entries are evicted according to EvictionPolicy.
+	MaxEntries int
+
+	// Maximum total cost of the entries in the cache, if greater than 0.
+	// The cost of each entry is returned by the function passed to WithWeigher, or is 1 if there's none.
+	// Entries whose cost is greater than MaxCost are not stored.
+	MaxCost int64
+
+	// Policy used to choose the entries to evict when the cache is full.
+	// Eviction is approximated by sampling a few entries, so reads don't need to acquire locks.
+	// This is optional, and defaults to EvictLRU.
+	EvictionPolicy EvictionPolicy
+
+	// Name of the cache, added as an attribute to metrics
+	Name string
+
+	// Optional meter used to report metrics with the statistics of the cache, such as the one returned by observability.InitMetrics
+	Meter metric.Meter
+
 	// Internal clock property, used for testing
 	clock kclock.WithTicker
 }
 
+// CacheOption sets a callback that receives the keys and values of the cache.
+// It is passed to NewCache or NewCacheFromSnapshot after the CacheOptions.
+type CacheOption[K cacheKey, V any] func(c *Cache[K, V])
+
+// WithWeigher sets the function that returns the cost of an entry, which must not be negative.
+// It is used with CacheOptions.MaxCost.
+func WithWeigher[K cacheKey, V any](fn func(key K, val V) int64) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.weigher = fn
+	}
+}
+
+// WithOnEvict sets a callback invoked when entries are removed from the cache, with the reason.
+// It is invoked synchronously by the method that removed the entries (including Cleanup in the background goroutine), after internal locks are released.
+// Errors cached by GetOrLoad are not reported.
+// Note that when this is set, writes to the cache acquire a lock.
+func WithOnEvict[K cacheKey, V any](fn func(key K, val V, reason EvictionReason)) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = fn
+	}
+}
+
 // NewCache returns a new cache with a TTL.
-func NewCache[K cacheKey, V any](opts *CacheOptions) *Cache[K, V] {
-	var m *haxmap.Map[K, cacheEntry[V]]
+func NewCache[K cacheKey, V any](opts *CacheOptions, options ...CacheOption[K, V]) *Cache[K, V] {
+	var m *haxmap.Map[K, *cacheEntry[K, V]]
 
 	if opts == nil {
 		opts = &CacheOptions{}
 	}
 
 	if opts.InitialSize > 0 {
-		m = haxmap.New[K, cacheEntry[V]](uintptr(opts.InitialSize))
+		m = haxmap.New[K, *cacheEntry[K, V]](uintptr(opts.InitialSize))
 	} else {
-		m = haxmap.New[K, cacheEntry[V]]()
+		m = haxmap.New[K, *cacheEntry[K, V]]()
 	}
 
 	if opts.CleanupInterval <= 0 {
@@ -70,24 +144,112 @@ func NewCache[K cacheKey, V any](opts *CacheOptions) *Cache[K, V] {
 	}
 
 	c := &Cache[K, V]{
-		m:      m,
-		clock:  opts.clock,
-		maxTTL: opts.MaxTTL,
-		stopCh: make(chan struct{}),
+		m:       m,
+		clock:   opts.clock,
+		maxTTL:  opts.MaxTTL,
+		sliding: opts.SlidingExpiration,
+		stopCh:  make(chan struct{}),
+	}
+	if opts.MaxEntries > 0 || opts.MaxCost > 0 {
+		c.evictions = &evictionList[K]{}
+		c.maxEntries = opts.MaxEntries
+		c.maxCost = opts.MaxCost
+		c.policy = opts.EvictionPolicy
 	}
+	for _, o := range options {
+		o(c)
+	}
+	c.locked = c.evictions != nil || c.onEvict != nil
+	c.initMetrics(opts.Meter, opts.Name)
 	c.startBackgroundCleanup(opts.CleanupInterval)
 
 	return c
 }
 
 // Get returns an item from the cache.
-// Items that have expired are not returned.
+// Items that have expired are not returned, nor are errors cached by GetOrLoad.
 func (c *Cache[K, V]) Get(key K) (v V, ok bool) {
-	val, ok := c.m.Get(key)
-	if !ok || !val.exp.After(c.clock.Now()) {
+	entry, _, ok := c.lookup(key)
+	ok = ok && entry.err == nil
+	c.recordRead(ok)
+	if !ok {
 		return v, false
 	}
-	return val.val, true
+	return entry.val, true
+}
+
+// GetWithExpiry is like Get, but it also returns the time the item expires at.
+func (c *Cache[K, V]) GetWithExpiry(key K) (v V, exp time.Time, ok bool) {
+	entry, _, ok := c.lookup(key)
+	ok = ok && entry.err == nil
+	c.recordRead(ok)
+	if !ok {
+		return v, exp, false
+	}
+	return entry.val, entry.expiration(), true
+}
+
+// TTL returns the remaining TTL of an item in the cache.
+// Unlike Get, this doesn't count as a read, so it doesn't extend the expiration with SlidingExpiration.
+func (c *Cache[K, V]) TTL(key K) (time.Duration, bool) {
+	entry, ok := c.m.Get(key)
+	if !ok || entry.err != nil {
+		return 0, false
+	}
+	now := c.clock.Now()
+	if entry.expired(now) {
+		return 0, false
+	}
+	return entry.expiration().Sub(now), true
+}
+
+// UpdateTTL sets a new TTL for an item in the cache, without replacing its value.
+// The new TTL is counted from now, and must be at least 1ms.
+// Returns false if the item is not in the cache or has expired.
+func (c *Cache[K, V]) UpdateTTL(key K, ttl time.Duration) bool {
+	if ttl < time.Millisecond {
+		panic("invalid TTL: must be 1ms or greater")
+	}
+
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+
+	entry, ok := c.m.Get(key)
+	if !ok || entry.err != nil {
+		return false
+	}
+	now := c.clock.Now()
+	if entry.expired(now) {
+		return false
+	}
+
+	// The expiration is atomic, so this doesn't need a lock
+	entry.ttl.Store(int64(ttl))
+	entry.exp.Store(now.Add(ttl).UnixNano())
+	return true
+}
+
+// Returns the entry for a key if it's in the cache and hasn't expired, recording that it was read.
+// This doesn't acquire locks.
+func (c *Cache[K, V]) lookup(key K) (*cacheEntry[K, V], time.Time, bool) {
+	entry, ok := c.m.Get(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	now := c.clock.Now()
+	if entry.expired(now) {
+		return nil, now, false
+	}
+
+	// These only update atomic fields
+	if entry.node != nil {
+		entry.node.touch(now.UnixNano())
+	}
+	if c.sliding && entry.err == nil {
+		entry.exp.Store(now.Add(time.Duration(entry.ttl.Load())).UnixNano())
+	}
+	return entry, now, true
 }
 
 // Set an item in the cache.
@@ -97,23 +259,97 @@ func (c *Cache[K, V]) Set(key K, val V, ttl time.Duration) {
 		panic("invalid TTL: must be 1ms or greater")
 	}
 
+	c.invalidateLoad(key)
+	c.notifyEvicted(c.set(key, &cacheEntry[K, V]{val: val}, ttl, 0))
+}
+
+// Stores an entry in the cache, setting its expiration time, and counts it in the statistics.
+// If softTTL is greater than 0, the entry is refreshed by GetOrLoad after softTTL.
+// Returns the entries that were evicted, which callers must pass to notifyEvicted.
+func (c *Cache[K, V]) set(key K, entry *cacheEntry[K, V], ttl time.Duration, softTTL time.Duration) []evictedEntry[K, V] {
+	c.stats.sets.Add(1)
+	return c.store(key, entry, ttl, softTTL, true)
+}
+
+// Like set, but it doesn't count the entry in the statistics.
+// If countStats is false, entries that are replaced or evicted are not counted in the statistics either.
+func (c *Cache[K, V]) store(key K, entry *cacheEntry[K, V], ttl time.Duration, softTTL time.Duration, countStats bool) []evictedEntry[K, V] {
 	if c.maxTTL > 0 && ttl > c.maxTTL {
 		ttl = c.maxTTL
 	}
 
-	exp := c.clock.Now().Add(ttl)
-	c.m.Set(key, cacheEntry[V]{
-		val: val,
-		exp: exp,
-	})
+	now := c.clock.Now()
+	entry.ttl.Store(int64(ttl))
+	entry.exp.Store(now.Add(ttl).UnixNano())
+	if softTTL > 0 && softTTL < ttl {
+		entry.refreshAt = now.Add(softTTL)
+	}
+	if !c.locked {
+		c.m.Set(key, entry)
+		return nil
+	}
+
+	var node *evictionNode[K]
+	if c.evictions != nil {
+		node = &evictionNode[K]{
+			key:  key,
+			cost: 1,
+			exp:  &entry.exp,
+		}
+		if c.weigher != nil && entry.err == nil {
+			node.cost = c.weigher(key, entry.val)
+		}
+		node.lastAccess.Store(now.UnixNano())
+	}
+
+	c.lock.Lock()
+	var evicted []evictedEntry[K, V]
+	if old, ok := c.detach(key, now, EvictionReasonReplaced, countStats); ok {
+		evicted = append(evicted, old)
+	}
+	switch {
+	case node == nil:
+		c.m.Set(key, entry)
+	case c.maxCost > 0 && node.cost > c.maxCost:
+		// The entry can never fit in the cache
+		c.m.Del(key)
+		if countStats {
+			c.stats.evictions.Add(1)
+		}
+		if entry.err == nil {
+			evicted = append(evicted, evictedEntry[K, V]{key: key, val: entry.val, reason: EvictionReasonCapacity})
+		}
+	default:
+		c.evictions.add(node)
+		entry.node = node
+		c.m.Set(key, entry)
+		evicted = c.evictOverflow(now, node, evicted, countStats)
+	}
+	c.lock.Unlock()
+
+	return evicted
 }
 
 // Delete an item from the cache
 func (c *Cache[K, V]) Delete(key K) {
+	c.invalidateLoad(key)
+	if !c.locked {
+		c.m.Del(key)
+		return
+	}
+
+	c.lock.Lock()
+	old, ok := c.detach(key, c.clock.Now(), EvictionReasonDeleted, true)
 	c.m.Del(key)
+	c.lock.Unlock()
+
+	if ok {
+		c.notifyEvicted([]evictedEntry[K, V]{old})
+	}
 }
 
 // Cleanup removes all expired entries from the cache.
+// When invoked by the background cleanup goroutine, OnEvict callbacks are invoked in that goroutine.
 func (c *Cache[K, V]) Cleanup() {
 	now := c.clock.Now()
 
@@ -123,24 +359,52 @@ func (c *Cache[K, V]) Cleanup() {
 	// This is considered acceptable in this case as this is just a cache.
 	// We could check each key before deleting it, however it is more efficient to make a single call to Del to delete all keys in bulk, so we just accept the small tradeoff
 	keys := make([]K, 0)
-	c.m.ForEach(func(k K, v cacheEntry[V]) bool {
-		if !v.exp.After(now) {
+	c.m.ForEach(func(k K, v *cacheEntry[K, V]) bool {
+		if v.expired(now) {
 			keys = append(keys, k)
 		}
 		return true
 	})
 
-	c.m.Del(keys...)
+	if !c.locked {
+		c.m.Del(keys...)
+		c.stats.expirations.Add(uint64(len(keys)))
+		return
+	}
+
+	// When writes are locked, check each key again while holding the lock, so the eviction list and the callbacks are consistent
+	var evicted []evictedEntry[K, V]
+	c.lock.Lock()
+	for _, k := range keys {
+		v, ok := c.m.Get(k)
+		if !ok || !v.expired(now) {
+			continue
+		}
+		old, ok := c.detach(k, now, EvictionReasonExpired, true)
+		if ok {
+			evicted = append(evicted, old)
+		}
+		c.m.Del(k)
+	}
+	c.lock.Unlock()
+
+	c.notifyEvicted(evicted)
 }
 
 // Reset removes all entries from the cache.
 func (c *Cache[K, V]) Reset() {
+	c.invalidateLoads()
+	if c.locked {
+		c.reset()
+		return
+	}
+
 	// Look for all keys and then remove them in bulk
 	// This is more efficient than removing keys one-by-one
 	// However, this could lead to a race condition where keys that are updated after ForEach ends are deleted nevertheless.
 	// This is considered acceptable in this case as this is just a cache.
 	keys := make([]K, 0, c.m.Len())
-	c.m.ForEach(func(k K, v cacheEntry[V]) bool {
+	c.m.ForEach(func(k K, v *cacheEntry[K, V]) bool {
 		keys = append(keys, k)
 		return true
 	})
@@ -148,6 +412,32 @@ func (c *Cache[K, V]) Reset() {
 	c.m.Del(keys...)
 }
 
+// Removes all entries from the cache while holding the lock.
+func (c *Cache[K, V]) reset() {
+	now := c.clock.Now()
+	var evicted []evictedEntry[K, V]
+
+	c.lock.Lock()
+	keys := make([]K, 0, c.m.Len())
+	c.m.ForEach(func(k K, v *cacheEntry[K, V]) bool {
+		keys = append(keys, k)
+		return true
+	})
+	for _, k := range keys {
+		old, ok := c.detach(k, now, EvictionReasonDeleted, true)
+		if ok {
+			evicted = append(evicted, old)
+		}
+	}
+	c.m.Del(keys...)
+	if c.evictions != nil {
+		c.evictions.reset()
+	}
+	c.lock.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
 func (c *Cache[K, V]) startBackgroundCleanup(d time.Duration) {
 	c.runningCh = make(chan struct{})
 	go func() {
@@ -167,16 +457,102 @@ func (c *Cache[K, V]) startBackgroundCleanup(d time.Duration) {
 	}()
 }
 
-// Stop the cache, stopping the background garbage collection process.
+// Stop the cache, stopping the background garbage collection process and unregistering the metrics.
 func (c *Cache[K, V]) Stop() {
 	if c.stopped.CompareAndSwap(false, true) {
 		close(c.stopCh)
+		if c.metricsReg != nil {
+			_ = c.metricsReg.Unregister()
+		}
 	}
 	<-c.runningCh
 }
 
+// Removes the node of the entry with the given key from the eviction list, and returns the entry to report to OnEvict, if any.
+// The entry is not removed from the map.
+// Entries that have expired are reported with EvictionReasonExpired, and cached errors are not reported.
+// If countStats is true, expirations and evictions are counted in the statistics.
+// This must be invoked while the caller has a lock.
+func (c *Cache[K, V]) detach(key K, now time.Time, reason EvictionReason, countStats bool) (evictedEntry[K, V], bool) {
+	old, ok := c.m.Get(key)
+	if !ok {
+		return evictedEntry[K, V]{}, false
+	}
+	if old.node != nil {
+		c.evictions.remove(old.node)
+	}
+	if old.expired(now) {
+		reason = EvictionReasonExpired
+	}
+	if countStats {
+		switch reason {
+		case EvictionReasonExpired:
+			c.stats.expirations.Add(1)
+		case EvictionReasonCapacity:
+			c.stats.evictions.Add(1)
+		}
+	}
+	if old.err != nil {
+		return evictedEntry[K, V]{}, false
+	}
+	return evictedEntry[K, V]{key: key, val: old.val, reason: reason}, true
+}
+
+// Evicts entries until the cache is within its limits, and appends the evicted entries to evicted.
+// The entry for added is evicted only if it's the last one.
+// This must be invoked while the caller has a lock.
+func (c *Cache[K, V]) evictOverflow(now time.Time, added *evictionNode[K], evicted []evictedEntry[K, V], countStats bool) []evictedEntry[K, V] {
+	for (c.maxEntries > 0 && c.evictions.len > c.maxEntries) || (c.maxCost > 0 && c.evictions.cost > c.maxCost) {
+		node := c.evictions.victim(c.policy, now.UnixNano(), added)
+		old, ok := c.detach(node.key, now, EvictionReasonCapacity, countStats)
+		if ok {
+			evicted = append(evicted, old)
+		}
+		c.m.Del(node.key)
+	}
+	return evicted
+}
+
+// Invokes the OnEvict callback for the evicted entries.
+// This must be invoked after releasing the lock.
+func (c *Cache[K, V]) notifyEvicted(evicted []evictedEntry[K, V]) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		c.onEvict(e.key, e.val, e.reason)
+	}
+}
+
 // Each item in the cache is stored in a cacheEntry, which includes the value as well as its expiration time.
-type cacheEntry[V any] struct {
+// The expiration time and TTL are atomic, so they can be updated without replacing the entry.
+type cacheEntry[K cacheKey, V any] struct {
 	val V
-	exp time.Time
+	// Expiration time, as nanoseconds since the Unix epoch
+	exp atomic.Int64
+	// TTL of the entry, used to extend the expiration with SlidingExpiration
+	ttl atomic.Int64
+	// Node in the eviction list, only when the cache is bounded
+	node *evictionNode[K]
+	// For entries stored by GetOrLoad, the error returned by the loader, which is cached instead of the value
+	err error
+	// For entries stored by GetOrLoad, the time after which the value is stale and is refreshed in background
+	refreshAt time.Time
+}
+
+// Returns the time the entry expires at.
+func (e *cacheEntry[K, V]) expiration() time.Time {
+	return time.Unix(0, e.exp.Load())
+}
+
+// Returns true if the entry has expired at the given time.
+func (e *cacheEntry[K, V]) expired(now time.Time) bool {
+	return e.exp.Load() <= now.UnixNano()
+}
+
+// An entry that was evicted from the cache.
+type evictedEntry[K cacheKey, V any] struct {
+	key    K
+	val    V
+	reason EvictionReason
 }
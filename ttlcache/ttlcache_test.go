@@ -6,6 +6,7 @@ package ttlcache
 
 import (
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -108,3 +109,138 @@ func TestCacheCleanupRemovesExpiredEntriesAtBoundary(t *testing.T) {
 
 	assert.EqualValues(t, 0, cache.m.Len())
 }
+
+func TestCacheOnEvict(t *testing.T) {
+	clock := &clocktesting.FakeClock{}
+	clock.SetTime(time.Now())
+
+	var (
+		lock    sync.Mutex
+		evicted = map[string]EvictionReason{}
+		cache   *Cache[string, string]
+	)
+	cache = NewCache[string, string](&CacheOptions{
+		CleanupInterval: 10 * time.Second,
+		clock:           clock,
+	}, WithOnEvict(func(key string, val string, reason EvictionReason) {
+		// The callback is invoked without holding internal locks, so it can use the cache
+		cache.Get(key)
+		assert.Equal(t, "val-"+key, val)
+		lock.Lock()
+		evicted[key] = reason
+		lock.Unlock()
+	}))
+	defer cache.Stop()
+
+	cache.Set("replaced", "val-replaced", time.Minute)
+	cache.Set("replaced", "val-replaced", time.Minute)
+	cache.Set("deleted", "val-deleted", time.Minute)
+	cache.Delete("deleted")
+	cache.Delete("missing")
+	cache.Set("expired", "val-expired", 5*time.Second)
+
+	// The expired entry is removed by the background cleanup
+	assert.Eventually(t, clock.HasWaiters, time.Second, 10*time.Millisecond)
+	clock.Step(10 * time.Second)
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(c, map[string]EvictionReason{
+			"replaced": EvictionReasonReplaced,
+			"deleted":  EvictionReasonDeleted,
+			"expired":  EvictionReasonExpired,
+		}, evicted)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCacheExpiration(t *testing.T) {
+	newCache := func(t *testing.T, sliding bool) (*Cache[string, string], *clocktesting.FakeClock) {
+		t.Helper()
+
+		clock := &clocktesting.FakeClock{}
+		clock.SetTime(time.Now())
+
+		cache := NewCache[string, string](&CacheOptions{
+			CleanupInterval:   time.Hour,
+			MaxTTL:            time.Minute,
+			SlidingExpiration: sliding,
+			clock:             clock,
+		})
+		t.Cleanup(cache.Stop)
+
+		return cache, clock
+	}
+
+	t.Run("inspect and update TTL", func(t *testing.T) {
+		cache, clock := newCache(t, false)
+		start := clock.Now()
+
+		cache.Set("key", "val", 10*time.Second)
+		clock.Step(4 * time.Second)
+
+		v, exp, ok := cache.GetWithExpiry("key")
+		require.True(t, ok)
+		assert.Equal(t, "val", v)
+		assert.True(t, start.Add(10*time.Second).Equal(exp))
+
+		ttl, ok := cache.TTL("key")
+		require.True(t, ok)
+		assert.Equal(t, 6*time.Second, ttl)
+
+		// Update the TTL, which is counted from now
+		require.True(t, cache.UpdateTTL("key", 20*time.Second))
+		ttl, ok = cache.TTL("key")
+		require.True(t, ok)
+		assert.Equal(t, 20*time.Second, ttl)
+
+		// TTL is capped at MaxTTL
+		require.True(t, cache.UpdateTTL("key", time.Hour))
+		ttl, _ = cache.TTL("key")
+		assert.Equal(t, time.Minute, ttl)
+
+		clock.Step(time.Minute)
+		_, ok = cache.TTL("key")
+		assert.False(t, ok)
+		_, _, ok = cache.GetWithExpiry("key")
+		assert.False(t, ok)
+		assert.False(t, cache.UpdateTTL("key", time.Second))
+		assert.False(t, cache.UpdateTTL("missing", time.Second))
+
+		assert.Panics(t, func() {
+			cache.UpdateTTL("key", 0)
+		})
+	})
+
+	t.Run("sliding expiration", func(t *testing.T) {
+		cache, clock := newCache(t, true)
+
+		cache.Set("read", "val", 10*time.Second)
+		cache.Set("unread", "val", 10*time.Second)
+
+		// Reading the entry extends its expiration by its TTL
+		for range 5 {
+			clock.Step(6 * time.Second)
+			_, ok := cache.Get("read")
+			require.True(t, ok)
+		}
+		ttl, ok := cache.TTL("read")
+		require.True(t, ok)
+		assert.Equal(t, 10*time.Second, ttl)
+		_, ok = cache.Get("unread")
+		assert.False(t, ok)
+
+		// TTL doesn't extend the expiration, and UpdateTTL changes the TTL used when reading
+		clock.Step(6 * time.Second)
+		ttl, _ = cache.TTL("read")
+		assert.Equal(t, 4*time.Second, ttl)
+		require.True(t, cache.UpdateTTL("read", 30*time.Second))
+		clock.Step(20 * time.Second)
+		_, exp, ok := cache.GetWithExpiry("read")
+		require.True(t, ok)
+		assert.True(t, clock.Now().Add(30*time.Second).Equal(exp))
+
+		cache.Cleanup()
+		assert.EqualValues(t, 1, cache.m.Len())
+	})
+}